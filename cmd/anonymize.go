@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Parts of the timestamps that anonymize can preserve.
+const (
+	preserveNone      = "none"
+	preserveTimeOfDay = "time-of-day"
+	preserveWeekday   = "weekday"
+)
+
+// pseudonymPrefix starts every pseudonymized ID.
+const pseudonymPrefix = "anon-"
+
+// anonDateLayouts are the timestamp and date layouts shifted in untyped
+// values. Dates are shifted from midnight UTC and keep their layout.
+var anonDateLayouts = []string{"2006-01-02 15:04:05 -0700", time.RFC3339Nano, time.DateOnly}
+
+var (
+	anonSource   string
+	anonExport   string
+	anonKeyFile  string
+	anonPreserve string
+	anonMaxShift time.Duration
+)
+
+// anonymizeCmd writes a pseudonymized export for sharing
+var anonymizeCmd = &cobra.Command{
+	Use:   "anonymize",
+	Short: "Write a pseudonymized export for sharing with researchers",
+	Long: `Process a health export like the process command, but pseudonymize it first:
+
+  - every timestamp is shifted by the same random offset, chosen once per
+    dataset, optionally in whole days (keeping the time of day) or whole
+    weeks (keeping the weekday and time of day)
+  - workout, state of mind and other record IDs are replaced with salted
+    hashes
+  - workout locations and routes, coordinates, and device and app names are
+    removed, along with the source file name and hash in the manifest
+
+The offset, the salt and the table from pseudonyms back to the original IDs
+are written to a separate key file, which is not part of the export and
+should stay with the data owner. An existing key file is reused, so further
+exports of the same dataset are shifted and pseudonymized consistently.`,
+	Example: `  # Pseudonymize an export, keeping weekdays and times of day
+  apple-health-export-parser anonymize --source export.json --export shared/ --key-file private/anonymization-key.json --preserve weekday`,
+	Args: cobra.NoArgs,
+	RunE: runAnonymize,
+}
+
+func init() {
+	rootCmd.AddCommand(anonymizeCmd)
+
+	anonymizeCmd.Flags().StringVarP(&anonSource, "source", "s", "", "source export file, as for process (required)")
+	anonymizeCmd.Flags().StringVarP(&anonExport, "export", "e", "exports", "directory to write the pseudonymized export to")
+	anonymizeCmd.Flags().StringVarP(&anonKeyFile, "key-file", "k", "", "file holding the time offset, salt and ID table, created if missing; keep it private (required)")
+	anonymizeCmd.Flags().StringVar(&anonPreserve, "preserve", preserveNone, "part of timestamps to keep: none, time-of-day or weekday")
+	anonymizeCmd.Flags().DurationVar(&anonMaxShift, "max-shift", 365*24*time.Hour, "largest time offset chosen for a new key")
+	anonymizeCmd.Flags().StringVar(&inputFormat, "input-format", formatAuto, "input format: "+formatAuto+" (detect), "+strings.Join(formatNames(), ", "))
+	anonymizeCmd.Flags().IntVar(&exportWorkers, "workers", runtime.NumCPU(), "number of records exported concurrently")
+	anonymizeCmd.Flags().BoolVar(&exportClean, "clean", false, "also remove files in the export subdirectories that earlier runs left untracked")
+	addEncryptionFlags(anonymizeCmd)
+
+	anonymizeCmd.MarkFlagRequired("source")
+	anonymizeCmd.MarkFlagRequired("key-file")
+}
+
+// AnonymizationKey re-identifies a pseudonymized export.
+type AnonymizationKey struct {
+	CreatedAt     time.Time         `json:"createdAt"`
+	OffsetSeconds int64             `json:"offsetSeconds"` // Added to every timestamp
+	Preserve      string            `json:"preserve"`      // none, time-of-day or weekday
+	Salt          string            `json:"salt"`          // Random HMAC-SHA256 key for IDs, in hex
+	IDs           map[string]string `json:"ids"`           // Original ID by pseudonym
+}
+
+// runAnonymize executes the anonymize command
+func runAnonymize(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(anonSource); anonSource != stdinSource && os.IsNotExist(err) {
+		return fmt.Errorf("source file '%s' does not exist", anonSource)
+	}
+	if inside, err := isInside(anonKeyFile, anonExport); err != nil {
+		return err
+	} else if inside {
+		return fmt.Errorf("key file '%s' must not be inside the export directory '%s'", anonKeyFile, anonExport)
+	}
+	if err := configureExport(); err != nil {
+		return err
+	}
+
+	key, err := loadOrCreateAnonymizationKey(anonKeyFile, anonPreserve, anonMaxShift)
+	if err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("preserve") && key.Preserve != anonPreserve {
+		slog.Warn("Keeping the offset of the existing key file", "key_file", anonKeyFile, "preserve", key.Preserve)
+	}
+
+	healthData, err := loadHealthData(anonSource, inputFormat)
+	if err != nil {
+		return err
+	}
+	healthData.Data = key.anonymize(healthData.Data)
+	healthData.Extras = key.anonymizeExtras(healthData.Extras)
+
+	// Locations and sources go through the redaction policy, which records
+	// them as removed in the manifest
+	previous := redaction
+	redaction.GPS, redaction.DropSources = gpsDrop, true
+	defer func() { redaction = previous }()
+
+	// Write the key first: an export without its key could not be traced back
+	if err := key.save(anonKeyFile); err != nil {
+		return err
+	}
+	if err := exportData(context.Background(), healthData, exportSource{}, anonExport); err != nil {
+		return fmt.Errorf("failed to export pseudonymized data: %w", err)
+	}
+
+	slog.Info("Pseudonymized export completed",
+		"export_dir", anonExport,
+		"key_file", anonKeyFile,
+		"preserve", key.Preserve,
+		"ids", len(key.IDs))
+	return nil
+}
+
+// loadOrCreateAnonymizationKey reads the key file, or creates a key with a
+// random offset of at most maxShift, in whole units of what preserve keeps,
+// and a random salt.
+func loadOrCreateAnonymizationKey(filename, preserve string, maxShift time.Duration) (*AnonymizationKey, error) {
+	key := &AnonymizationKey{}
+	err := readJSONFile(filename, key)
+	if err == nil {
+		if _, err := hex.DecodeString(key.Salt); err != nil || key.Salt == "" {
+			return nil, fmt.Errorf("key file '%s' has no valid salt", filename)
+		}
+		if key.IDs == nil {
+			key.IDs = make(map[string]string)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+
+	unit := time.Second
+	switch preserve {
+	case preserveNone:
+	case preserveTimeOfDay:
+		unit = 24 * time.Hour
+	case preserveWeekday:
+		unit = 7 * 24 * time.Hour
+	default:
+		return nil, fmt.Errorf("invalid preserve: %s (valid: %s, %s, %s)", preserve, preserveNone, preserveTimeOfDay, preserveWeekday)
+	}
+	units := int64(maxShift / unit)
+	if units < 1 {
+		return nil, fmt.Errorf("--max-shift %s is shorter than one %s, which preserve %s shifts by", maxShift, unit, preserve)
+	}
+
+	// A non-zero offset of 1 to units units, earlier or later
+	n, err := rand.Int(rand.Reader, big.NewInt(2*units))
+	if err != nil {
+		return nil, fmt.Errorf("choosing time offset: %w", err)
+	}
+	offset := n.Int64() - units
+	if offset >= 0 {
+		offset++
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("choosing salt: %w", err)
+	}
+
+	slog.Info("Created anonymization key", "key_file", filename, "preserve", preserve)
+	return &AnonymizationKey{
+		CreatedAt:     time.Now().UTC(),
+		OffsetSeconds: offset * int64(unit/time.Second),
+		Preserve:      preserve,
+		Salt:          hex.EncodeToString(salt),
+		IDs:           make(map[string]string),
+	}, nil
+}
+
+// save writes the key to filename, readable by its owner only.
+func (k *AnonymizationKey) save(filename string) error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding key file: %w", err)
+	}
+	if dir := filepath.Dir(filename); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("creating key file directory: %w", err)
+		}
+	}
+	if err := writeFileAtomic(filename, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("writing key file: %w", err)
+	}
+	return nil
+}
+
+// shift moves t by the key's offset.
+func (k *AnonymizationKey) shift(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.Add(time.Duration(k.OffsetSeconds) * time.Second)
+}
+
+// pseudonym returns the salted hash standing in for id and records it in
+// the key.
+func (k *AnonymizationKey) pseudonym(id string) string {
+	if id == "" || strings.HasPrefix(id, pseudonymPrefix) {
+		return id
+	}
+	salt, _ := hex.DecodeString(k.Salt) // Checked when the key is loaded
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(id))
+	p := pseudonymPrefix + hex.EncodeToString(mac.Sum(nil))[:16]
+	k.IDs[p] = id
+	return p
+}
+
+// anonymize returns data with its timestamps shifted and IDs replaced. data
+// itself is not modified.
+func (k *AnonymizationKey) anonymize(data Data) Data {
+	out := data
+
+	out.Metrics = make([]Metric, len(data.Metrics))
+	for i, metric := range data.Metrics {
+		metric.Data = slices.Clone(metric.Data)
+		for j := range metric.Data {
+			metric.Data[j].Date = k.shift(metric.Data[j].Date)
+			metric.Data[j].Extras = k.anonymizeExtras(metric.Data[j].Extras)
+		}
+		metric.Extras = k.anonymizeExtras(metric.Extras)
+		out.Metrics[i] = metric
+	}
+	out.Extras = k.anonymizeExtras(data.Extras)
+
+	out.Workouts = make([]Workout, len(data.Workouts))
+	for i, w := range data.Workouts {
+		w.ID = k.pseudonym(w.ID)
+		w.Start, w.End = k.shift(w.Start), k.shift(w.End)
+		w.ActiveEnergy = slices.Clone(w.ActiveEnergy)
+		for j := range w.ActiveEnergy {
+			w.ActiveEnergy[j].Date = k.shift(w.ActiveEnergy[j].Date)
+			w.ActiveEnergy[j].Extras = k.anonymizeExtras(w.ActiveEnergy[j].Extras)
+		}
+		w.HeartRateData = k.anonymizeHeartRates(w.HeartRateData)
+		w.HeartRateRecovery = k.anonymizeHeartRates(w.HeartRateRecovery)
+		w.StepCount = slices.Clone(w.StepCount)
+		for j := range w.StepCount {
+			w.StepCount[j].Date = k.shift(w.StepCount[j].Date)
+			w.StepCount[j].Extras = k.anonymizeExtras(w.StepCount[j].Extras)
+		}
+		w.WalkingAndRunningDistance = slices.Clone(w.WalkingAndRunningDistance)
+		for j := range w.WalkingAndRunningDistance {
+			w.WalkingAndRunningDistance[j].Date = k.shift(w.WalkingAndRunningDistance[j].Date)
+			w.WalkingAndRunningDistance[j].Extras = k.anonymizeExtras(w.WalkingAndRunningDistance[j].Extras)
+		}
+		if w.Metadata != nil {
+			w.Metadata = k.anonymizeValue("", toJSONValue(w.Metadata))
+		}
+		w.Extras = k.anonymizeExtras(w.Extras)
+		out.Workouts[i] = w
+	}
+
+	out.StateOfMind = make([]StateOfMind, len(data.StateOfMind))
+	for i, som := range data.StateOfMind {
+		som.ID = k.pseudonym(som.ID)
+		som.Start, som.End = k.shift(som.Start), k.shift(som.End)
+		som.Extras = k.anonymizeExtras(som.Extras)
+		out.StateOfMind[i] = som
+	}
+
+	out.ECG = k.anonymizeRecords(data.ECG)
+	out.HeartRateNotifications = k.anonymizeRecords(data.HeartRateNotifications)
+	out.Symptoms = k.anonymizeRecords(data.Symptoms)
+	return out
+}
+
+func (k *AnonymizationKey) anonymizeHeartRates(records []HeartRateData) []HeartRateData {
+	records = slices.Clone(records)
+	for i := range records {
+		records[i].Date = k.shift(records[i].Date)
+		records[i].Extras = k.anonymizeExtras(records[i].Extras)
+	}
+	return records
+}
+
+// anonymizeRecords anonymizes untyped records, such as ECGs.
+func (k *AnonymizationKey) anonymizeRecords(records []interface{}) []interface{} {
+	if records == nil {
+		return nil
+	}
+	out := make([]interface{}, len(records))
+	for i, record := range records {
+		out[i] = k.anonymizeValue("", toJSONValue(record))
+	}
+	return out
+}
+
+// anonymizeExtras anonymizes the unrecognized fields of a record, returning a
+// new map.
+func (k *AnonymizationKey) anonymizeExtras(extras Extras) Extras {
+	if len(extras) == 0 {
+		return extras
+	}
+	out := make(Extras, len(extras))
+	for key, raw := range extras {
+		data, err := json.Marshal(k.anonymizeValue(key, decodeJSONValue(raw)))
+		if err != nil {
+			continue
+		}
+		out[key] = data
+	}
+	return out
+}
+
+// anonymizeValue anonymizes a generic JSON value found under key in place
+// and returns it: timestamps are shifted and IDs replaced.
+func (k *AnonymizationKey) anonymizeValue(key string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for field, value := range v {
+			v[field] = k.anonymizeValue(field, value)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = k.anonymizeValue(key, v[i])
+		}
+	case string:
+		if strings.EqualFold(key, "id") || strings.EqualFold(key, "uuid") {
+			return k.pseudonym(v)
+		}
+		for _, layout := range anonDateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return k.shift(t).Format(layout)
+			}
+		}
+	}
+	return v
+}
+
+// isInside reports whether path is inside, or is, the directory dir.
+func isInside(path, dir string) (bool, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return false, nil
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))), nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateAnonymizationKey(t *testing.T) {
+	tests := []struct {
+		preserve string
+		maxShift time.Duration
+		unit     time.Duration
+		wantErr  bool
+	}{
+		{preserve: preserveNone, maxShift: time.Hour, unit: time.Second},
+		{preserve: preserveTimeOfDay, maxShift: 30 * 24 * time.Hour, unit: 24 * time.Hour},
+		{preserve: preserveWeekday, maxShift: 365 * 24 * time.Hour, unit: 7 * 24 * time.Hour},
+		{preserve: preserveWeekday, maxShift: 24 * time.Hour, wantErr: true},
+		{preserve: "month", maxShift: time.Hour, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		key, err := loadOrCreateAnonymizationKey(filepath.Join(t.TempDir(), "key.json"), tt.preserve, tt.maxShift)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("preserve %s: error = %v, wantErr %v", tt.preserve, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		offset := time.Duration(key.OffsetSeconds) * time.Second
+		if offset == 0 || offset%tt.unit != 0 || offset > tt.maxShift || offset < -tt.maxShift {
+			t.Errorf("preserve %s: offset %s, want a non-zero multiple of %s within %s", tt.preserve, offset, tt.unit, tt.maxShift)
+		}
+	}
+
+	// An existing key is reused
+	filename := filepath.Join(t.TempDir(), "key.json")
+	key, err := loadOrCreateAnonymizationKey(filename, preserveWeekday, 365*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.pseudonym("W1")
+	if err := key.save(filename); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := loadOrCreateAnonymizationKey(filename, preserveNone, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.OffsetSeconds != key.OffsetSeconds || reloaded.Salt != key.Salt || reloaded.pseudonym("W1") != key.pseudonym("W1") {
+		t.Errorf("reloaded key = %+v, want %+v", reloaded, key)
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	key := &AnonymizationKey{OffsetSeconds: -3 * 7 * 24 * 3600, Salt: "00112233", IDs: map[string]string{}}
+	data := testHealthData()
+	data.Symptoms = []interface{}{map[string]interface{}{"id": "X1", "name": "Headache", "start": "2025-11-10 07:00:00 -0500", "date": "2025-11-10"}}
+
+	got := key.anonymize(data)
+
+	for i, w := range got.Workouts {
+		original := data.Workouts[i]
+		if !strings.HasPrefix(w.ID, pseudonymPrefix) || key.IDs[w.ID] != original.ID {
+			t.Errorf("workout ID %s -> %s, want a pseudonym mapped back in the key", original.ID, w.ID)
+		}
+		if w.Start.Weekday() != original.Start.Weekday() || w.Start.Hour() != original.Start.Hour() || !w.Start.Before(original.Start) {
+			t.Errorf("workout start %s -> %s, want three weeks earlier", original.Start, w.Start)
+		}
+	}
+	if got.Workouts[1].HeartRateData[0].Date.Equal(data.Workouts[1].HeartRateData[0].Date) {
+		t.Error("workout heart rate dates were not shifted")
+	}
+	if got.Metrics[0].Data[0].Date.Equal(data.Metrics[0].Data[0].Date) {
+		t.Error("anonymize() did not shift metric dates, or modified its input")
+	}
+	if key.IDs[got.StateOfMind[0].ID] != "S2" {
+		t.Errorf("state of mind ID = %s, want a pseudonym of S2", got.StateOfMind[0].ID)
+	}
+
+	symptom := got.Symptoms[0].(map[string]interface{})
+	if symptom["start"] != "2025-10-20 07:00:00 -0500" || symptom["date"] != "2025-10-20" || key.IDs[symptom["id"].(string)] != "X1" || symptom["name"] != "Headache" {
+		t.Errorf("symptom = %v, want shifted start and date and pseudonymized id", symptom)
+	}
+
+	// The same ID gets the same pseudonym every time
+	if key.pseudonym("W1") != got.Workouts[1].ID {
+		t.Error("pseudonym() is not stable")
+	}
+}
+
+func TestRunAnonymize(t *testing.T) {
+	dir := t.TempDir()
+	data := testHealthData()
+	for i := range data.Metrics[0].Data {
+		data.Metrics[0].Data[i].Source = "Jane's iPhone"
+	}
+	source, err := json.Marshal(HealthData{Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "source.json", string(source))
+
+	previous := []string{anonSource, anonExport, anonKeyFile, anonPreserve}
+	previousMaxShift := anonMaxShift
+	defer func() {
+		anonSource, anonExport, anonKeyFile, anonPreserve = previous[0], previous[1], previous[2], previous[3]
+		anonMaxShift = previousMaxShift
+	}()
+	anonSource = filepath.Join(dir, "source.json")
+	anonExport = filepath.Join(dir, "shared")
+	anonKeyFile = filepath.Join(dir, "shared", "key.json")
+	anonPreserve = preserveWeekday
+	anonMaxShift = 365 * 24 * time.Hour
+
+	if err := runAnonymize(anonymizeCmd, nil); err == nil {
+		t.Fatal("runAnonymize() accepted a key file inside the export directory")
+	}
+
+	anonKeyFile = filepath.Join(dir, "private", "key.json")
+	if err := runAnonymize(anonymizeCmd, nil); err != nil {
+		t.Fatalf("runAnonymize() error = %v", err)
+	}
+
+	manifest, exported, err := loadExportDir(anonExport)
+	if err != nil {
+		t.Fatalf("loadExportDir() error = %v", err)
+	}
+	if manifest.SourceFile != "" || manifest.SourceSHA256 != "" || manifest.Redaction == nil || !manifest.Redaction.DropSources {
+		t.Errorf("manifest source %q %q, redaction %+v; want no source and sources dropped", manifest.SourceFile, manifest.SourceSHA256, manifest.Redaction)
+	}
+	if len(exported.Workouts) != len(data.Workouts) {
+		t.Fatalf("exported %d workouts, want %d", len(exported.Workouts), len(data.Workouts))
+	}
+
+	key := &AnonymizationKey{}
+	if err := readJSONFile(anonKeyFile, key); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range exported.Workouts {
+		if _, ok := key.IDs[w.ID]; !ok {
+			t.Errorf("exported workout ID %s is not in the key file", w.ID)
+		}
+	}
+	if info, err := os.Stat(anonKeyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, %v; want 0600", info, err)
+	}
+
+	for _, rel := range append(manifest.Metrics, manifest.Workouts...) {
+		content, err := os.ReadFile(filepath.Join(anonExport, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, leak := range []string{`"W1"`, "Jane", "2025-11-10"} {
+			if strings.Contains(string(content), leak) {
+				t.Errorf("%s contains %s", rel, leak)
+			}
+		}
+	}
+}
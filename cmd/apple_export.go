@@ -0,0 +1,712 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Apple Health "Export All Health Data" archives contain export.xml, the
+// workout routes it references as GPX files, and one CSV per ECG recording.
+// export_cda.xml duplicates clinical records in HL7 CDA form and is not read.
+const (
+	appleExportXML  = "export.xml"
+	appleECGDir     = "electrocardiograms"
+	appleRouteExt   = ".gpx"
+	appleDateFormat = "2006-01-02"
+)
+
+// Prefixes of the HealthKit identifiers used in export.xml.
+const (
+	hkQuantityPrefix = "HKQuantityTypeIdentifier"
+	hkCategoryPrefix = "HKCategoryTypeIdentifier"
+	hkWorkoutPrefix  = "HKWorkoutActivityType"
+)
+
+// appleMetricNames maps HealthKit quantity types to the metric names Health
+// Auto Export uses where they differ from the snake-cased identifier.
+var appleMetricNames = map[string]string{
+	"ActiveEnergyBurned":       "active_energy",
+	"DistanceWalkingRunning":   "walking_running_distance",
+	"DistanceCycling":          "cycling_distance",
+	"DistanceSwimming":         "swimming_distance",
+	"HeartRateVariabilitySDNN": "heart_rate_variability",
+	"OxygenSaturation":         "blood_oxygen_saturation",
+	"BodyMass":                 "weight_body_mass",
+}
+
+// appleWorkoutNames shortens activity types that Health Auto Export prefixes
+// with "Indoor" or "Outdoor".
+var appleWorkoutNames = map[string]string{
+	"Walking": "Walk",
+	"Running": "Run",
+	"Cycling": "Cycling",
+}
+
+// appleHeartRateEvents maps heart rate event categories to notification types.
+var appleHeartRateEvents = map[string]string{
+	"HighHeartRateEvent":        "high_heart_rate",
+	"LowHeartRateEvent":         "low_heart_rate",
+	"IrregularHeartRhythmEvent": "irregular_rhythm",
+}
+
+// appleRecord is a Record element of export.xml.
+type appleRecord struct {
+	Type       string               `xml:"type,attr"`
+	SourceName string               `xml:"sourceName,attr"`
+	Unit       string               `xml:"unit,attr"`
+	StartDate  string               `xml:"startDate,attr"`
+	EndDate    string               `xml:"endDate,attr"`
+	Value      string               `xml:"value,attr"`
+	Metadata   []appleMetadataEntry `xml:"MetadataEntry"`
+}
+
+// appleMetadataEntry is a MetadataEntry element.
+type appleMetadataEntry struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// appleWorkout is a Workout element of export.xml. Exports from iOS 16 on
+// carry totals only in WorkoutStatistics; older ones use the total attributes.
+type appleWorkout struct {
+	ActivityType          string               `xml:"workoutActivityType,attr"`
+	Duration              string               `xml:"duration,attr"`
+	DurationUnit          string               `xml:"durationUnit,attr"`
+	TotalDistance         string               `xml:"totalDistance,attr"`
+	TotalDistanceUnit     string               `xml:"totalDistanceUnit,attr"`
+	TotalEnergyBurned     string               `xml:"totalEnergyBurned,attr"`
+	TotalEnergyBurnedUnit string               `xml:"totalEnergyBurnedUnit,attr"`
+	SourceName            string               `xml:"sourceName,attr"`
+	StartDate             string               `xml:"startDate,attr"`
+	EndDate               string               `xml:"endDate,attr"`
+	Metadata              []appleMetadataEntry `xml:"MetadataEntry"`
+	Statistics            []struct {
+		Type string `xml:"type,attr"`
+		Sum  string `xml:"sum,attr"`
+		Unit string `xml:"unit,attr"`
+	} `xml:"WorkoutStatistics"`
+	Routes []struct {
+		File struct {
+			Path string `xml:"path,attr"`
+		} `xml:"FileReference"`
+	} `xml:"WorkoutRoute"`
+}
+
+// appleActivitySummary is an ActivitySummary element: one day of activity rings.
+type appleActivitySummary struct {
+	Date                   string `xml:"dateComponents,attr"`
+	ActiveEnergyBurned     string `xml:"activeEnergyBurned,attr"`
+	ActiveEnergyBurnedGoal string `xml:"activeEnergyBurnedGoal,attr"`
+	ActiveEnergyBurnedUnit string `xml:"activeEnergyBurnedUnit,attr"`
+	ExerciseTime           string `xml:"appleExerciseTime,attr"`
+	ExerciseTimeGoal       string `xml:"appleExerciseTimeGoal,attr"`
+	StandHours             string `xml:"appleStandHours,attr"`
+	StandHoursGoal         string `xml:"appleStandHoursGoal,attr"`
+}
+
+// AppleECG is an electrocardiogram read from an Apple Health ECG CSV. The
+// name and date of birth in the CSV header are deliberately not kept.
+type AppleECG struct {
+	Start                       time.Time `json:"start"`
+	End                         time.Time `json:"end"`
+	Classification              string    `json:"classification"`
+	Symptoms                    string    `json:"symptoms,omitempty"`
+	Source                      string    `json:"source"` // Recording device
+	Lead                        string    `json:"lead,omitempty"`
+	SamplingFrequency           float64   `json:"samplingFrequency"` // Hz
+	Units                       string    `json:"units"`
+	NumberOfVoltageMeasurements int       `json:"numberOfVoltageMeasurements"`
+	VoltageMeasurements         []float64 `json:"voltageMeasurements"`
+}
+
+// RoutePoint is a GPS location of a workout route.
+type RoutePoint struct {
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Altitude  float64   `json:"altitude"`
+	Timestamp time.Time `json:"timestamp"`
+	Speed     float64   `json:"speed,omitempty"` // m/s
+}
+
+// appleImporter accumulates Apple Health export data into the Data model.
+type appleImporter struct {
+	metrics       map[string]*Metric
+	workouts      []Workout
+	routeRefs     []string // Route file of each workout, if any
+	ecg           []interface{}
+	notifications []interface{}
+	symptoms      []interface{}
+	skipped       map[string]int // Unsupported record types and their counts
+}
+
+// newAppleImporter creates an empty importer.
+func newAppleImporter() *appleImporter {
+	return &appleImporter{
+		metrics: make(map[string]*Metric),
+		skipped: make(map[string]int),
+	}
+}
+
+// isAppleExportEntry reports whether a zip entry is an Apple Health export.xml.
+func isAppleExportEntry(name string) bool {
+	return path.Base(name) == appleExportXML
+}
+
+// decodeAppleZip imports an Apple Health export archive: export.xml, the GPX
+// routes its workouts reference and the ECG CSVs.
+func decodeAppleZip(zr *zip.Reader) (HealthData, error) {
+	imp := newAppleImporter()
+	routes := make(map[string]*zip.File)
+
+	for _, entry := range zr.File {
+		name := entry.Name
+		switch {
+		case isAppleExportEntry(name):
+			if err := readZipEntry(entry, imp.readExportXML); err != nil {
+				return HealthData{}, fmt.Errorf("zip entry '%s': %w", name, err)
+			}
+		case path.Base(path.Dir(name)) == appleECGDir && strings.EqualFold(path.Ext(name), ".csv"):
+			if err := readZipEntry(entry, imp.readECG); err != nil {
+				slog.Warn("Skipping unreadable ECG recording", "entry", name, "error", err)
+			}
+		case strings.EqualFold(path.Ext(name), appleRouteExt):
+			routes[path.Base(name)] = entry
+		}
+	}
+
+	for i, ref := range imp.routeRefs {
+		entry, ok := routes[path.Base(ref)]
+		if ref == "" || !ok {
+			continue
+		}
+		var points []RoutePoint
+		err := readZipEntry(entry, func(r io.Reader) (err error) {
+			points, err = readGPX(r)
+			return err
+		})
+		if err != nil {
+			slog.Warn("Skipping unreadable workout route", "entry", entry.Name, "error", err)
+			continue
+		}
+		imp.workouts[i].Route = points
+	}
+
+	return HealthData{Data: imp.data()}, nil
+}
+
+// decodeAppleXML imports a bare export.xml, without routes or ECGs.
+func decodeAppleXML(r io.Reader) (HealthData, error) {
+	imp := newAppleImporter()
+	if err := imp.readExportXML(r); err != nil {
+		return HealthData{}, err
+	}
+	return HealthData{Data: imp.data()}, nil
+}
+
+// readZipEntry opens a zip entry and passes it to read.
+func readZipEntry(entry *zip.File, read func(io.Reader) error) error {
+	rc, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return read(rc)
+}
+
+// readExportXML streams export.xml, decoding Record, Workout and
+// ActivitySummary elements one at a time. Records nested in Correlation
+// elements are read like top-level ones.
+func (imp *appleImporter) readExportXML(r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("parsing export.xml: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "Record":
+			var record appleRecord
+			if err := decoder.DecodeElement(&record, &start); err != nil {
+				return fmt.Errorf("parsing Record: %w", err)
+			}
+			imp.addRecord(record)
+		case "Workout":
+			var workout appleWorkout
+			if err := decoder.DecodeElement(&workout, &start); err != nil {
+				return fmt.Errorf("parsing Workout: %w", err)
+			}
+			imp.addWorkout(workout)
+		case "ActivitySummary":
+			var summary appleActivitySummary
+			if err := decoder.DecodeElement(&summary, &start); err != nil {
+				return fmt.Errorf("parsing ActivitySummary: %w", err)
+			}
+			imp.addActivitySummary(summary)
+		}
+	}
+	return nil
+}
+
+// addRecord maps a quantity record onto a metric and a category record onto
+// a metric, symptom or heart rate notification. Other records are counted as
+// skipped.
+func (imp *appleImporter) addRecord(record appleRecord) {
+	start, err := parseDate(record.StartDate)
+	if err != nil {
+		imp.skipped[record.Type]++
+		return
+	}
+	end, err := parseDate(record.EndDate)
+	if err != nil {
+		end = start
+	}
+
+	if identifier, ok := strings.CutPrefix(record.Type, hkQuantityPrefix); ok {
+		qty, err := strconv.ParseFloat(record.Value, 64)
+		if err != nil {
+			imp.skipped[record.Type]++
+			return
+		}
+		units := record.Unit
+		if units == "%" {
+			qty *= 100 // HealthKit stores percentages as fractions
+		}
+		imp.addMetricRecord(appleMetricName(identifier), units, MetricRecord{Date: start, Qty: qty, Source: record.SourceName})
+		return
+	}
+
+	identifier, ok := strings.CutPrefix(record.Type, hkCategoryPrefix)
+	if !ok {
+		imp.skipped[record.Type]++
+		return
+	}
+	switch {
+	case identifier == "SleepAnalysis":
+		// Only asleep stages count; in bed and awake intervals are not sleep
+		if strings.Contains(record.Value, "Asleep") {
+			imp.addMetricRecord("sleep_analysis", "hr", MetricRecord{Date: start, Qty: end.Sub(start).Hours(), Source: record.SourceName})
+		}
+	case identifier == "MindfulSession":
+		imp.addMetricRecord("mindful_minutes", "min", MetricRecord{Date: start, Qty: end.Sub(start).Minutes(), Source: record.SourceName})
+	case appleHeartRateEvents[identifier] != "":
+		imp.notifications = append(imp.notifications, map[string]interface{}{
+			"type":     appleHeartRateEvents[identifier],
+			"start":    start,
+			"end":      end,
+			"source":   record.SourceName,
+			"metadata": appleMetadataMap(record.Metadata),
+		})
+	case strings.HasPrefix(record.Value, "HKCategoryValueSeverity"):
+		imp.symptoms = append(imp.symptoms, map[string]interface{}{
+			"name":     snakeCase(identifier),
+			"severity": strings.TrimPrefix(record.Value, "HKCategoryValueSeverity"),
+			"start":    start,
+			"end":      end,
+			"source":   record.SourceName,
+		})
+	default:
+		imp.skipped[record.Type]++
+	}
+}
+
+// addMetricRecord appends a record to the named metric.
+func (imp *appleImporter) addMetricRecord(name, units string, record MetricRecord) {
+	metric, ok := imp.metrics[name]
+	if !ok {
+		metric = &Metric{Name: name, Units: units}
+		imp.metrics[name] = metric
+	}
+	metric.Data = append(metric.Data, record)
+}
+
+// addWorkout maps a workout, taking totals from its attributes or, in newer
+// exports, from its WorkoutStatistics.
+func (imp *appleImporter) addWorkout(aw appleWorkout) {
+	start, err := parseDate(aw.StartDate)
+	if err != nil {
+		imp.skipped["Workout"]++
+		return
+	}
+	end, err := parseDate(aw.EndDate)
+	if err != nil {
+		end = start
+	}
+
+	metadata := appleMetadataMap(aw.Metadata)
+	workout := Workout{
+		ID:       appleWorkoutID(aw.ActivityType, aw.StartDate, aw.EndDate, aw.SourceName),
+		Name:     appleWorkoutName(aw.ActivityType, metadata["HKIndoorWorkout"]),
+		Start:    start,
+		End:      end,
+		Duration: end.Sub(start).Seconds(),
+	}
+	if metadata != nil {
+		workout.Metadata = metadata
+	}
+
+	if duration, err := strconv.ParseFloat(aw.Duration, 64); err == nil {
+		switch aw.DurationUnit {
+		case "min":
+			workout.Duration = duration * 60
+		case "hr":
+			workout.Duration = duration * 3600
+		case "s":
+			workout.Duration = duration
+		}
+	}
+	if qty, err := strconv.ParseFloat(aw.TotalEnergyBurned, 64); err == nil {
+		workout.ActiveEnergyBurned = EnergyValue{Qty: qty, Units: aw.TotalEnergyBurnedUnit}
+	}
+	if qty, err := strconv.ParseFloat(aw.TotalDistance, 64); err == nil {
+		workout.Distance = ValueWithUnits{Qty: qty, Units: aw.TotalDistanceUnit}
+	}
+	for _, stat := range aw.Statistics {
+		qty, err := strconv.ParseFloat(stat.Sum, 64)
+		if err != nil {
+			continue
+		}
+		identifier := strings.TrimPrefix(stat.Type, hkQuantityPrefix)
+		switch {
+		case identifier == "ActiveEnergyBurned" && workout.ActiveEnergyBurned.Units == "":
+			workout.ActiveEnergyBurned = EnergyValue{Qty: qty, Units: stat.Unit}
+		case strings.HasPrefix(identifier, "Distance") && workout.Distance.Units == "":
+			workout.Distance = ValueWithUnits{Qty: qty, Units: stat.Unit}
+		}
+	}
+
+	if value, ok := metadata["HKElevationAscended"]; ok {
+		workout.ElevationUp = parseAppleQuantity(value)
+		if workout.ElevationUp.Units == "cm" {
+			workout.ElevationUp = ValueWithUnits{Qty: workout.ElevationUp.Qty / 100, Units: "m"}
+		}
+	}
+	if value, ok := metadata["HKWeatherTemperature"]; ok {
+		workout.Temperature = parseAppleQuantity(value)
+	}
+	if value, ok := metadata["HKWeatherHumidity"]; ok {
+		workout.Humidity = parseAppleQuantity(value)
+		if workout.Humidity.Qty > 100 {
+			workout.Humidity.Qty /= 100 // Stored in hundredths of a percent
+		}
+	}
+	if value, ok := metadata["HKAverageMETs"]; ok {
+		workout.Intensity = parseAppleQuantity(value)
+	}
+
+	routeRef := ""
+	if len(aw.Routes) > 0 {
+		routeRef = aw.Routes[0].File.Path
+	}
+	imp.workouts = append(imp.workouts, workout)
+	imp.routeRefs = append(imp.routeRefs, routeRef)
+}
+
+// addActivitySummary maps a day of activity rings onto daily metrics.
+func (imp *appleImporter) addActivitySummary(summary appleActivitySummary) {
+	day, err := time.ParseInLocation(appleDateFormat, summary.Date, time.Local)
+	if err != nil {
+		imp.skipped["ActivitySummary"]++
+		return
+	}
+
+	energyUnits := summary.ActiveEnergyBurnedUnit
+	if energyUnits == "" {
+		energyUnits = "kcal"
+	}
+	values := []struct {
+		name, units, value string
+	}{
+		{"activity_active_energy", energyUnits, summary.ActiveEnergyBurned},
+		{"activity_active_energy_goal", energyUnits, summary.ActiveEnergyBurnedGoal},
+		{"activity_exercise_time", "min", summary.ExerciseTime},
+		{"activity_exercise_time_goal", "min", summary.ExerciseTimeGoal},
+		{"activity_stand_hours", "hr", summary.StandHours},
+		{"activity_stand_hours_goal", "hr", summary.StandHoursGoal},
+	}
+	for _, v := range values {
+		if qty, err := strconv.ParseFloat(v.value, 64); err == nil {
+			imp.addMetricRecord(v.name, v.units, MetricRecord{Date: day, Qty: qty, Source: "Activity"})
+		}
+	}
+}
+
+// readECG reads an ECG CSV: "key,value" header rows followed by one voltage
+// sample per row.
+func (imp *appleImporter) readECG(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header := make(map[string]string)
+	var samples []float64
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(row) == 1 {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(row[0]), 64); err == nil {
+				samples = append(samples, v)
+			}
+			continue
+		}
+		if key := strings.TrimSpace(row[0]); key != "" {
+			header[key] = strings.TrimSpace(row[1])
+		}
+	}
+
+	start, err := parseDate(header["Recorded Date"])
+	if err != nil {
+		return fmt.Errorf("parsing recorded date: %w", err)
+	}
+	frequency := parseAppleQuantity(header["Sample Rate"]).Qty
+
+	ecg := AppleECG{
+		Start:                       start,
+		End:                         start,
+		Classification:              header["Classification"],
+		Symptoms:                    header["Symptoms"],
+		Source:                      header["Device"],
+		Lead:                        header["Lead"],
+		SamplingFrequency:           frequency,
+		Units:                       header["Unit"],
+		NumberOfVoltageMeasurements: len(samples),
+		VoltageMeasurements:         samples,
+	}
+	if frequency > 0 {
+		ecg.End = start.Add(time.Duration(float64(len(samples)) / frequency * float64(time.Second)))
+	}
+	imp.ecg = append(imp.ecg, ecg)
+	return nil
+}
+
+// data returns the imported data. Metric records are sorted and
+// de-duplicated, and each workout gets the heart rate, energy, step and
+// distance records recorded during it.
+func (imp *appleImporter) data() Data {
+	var data Data
+
+	names := make([]string, 0, len(imp.metrics))
+	for name := range imp.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		metric := imp.metrics[name]
+		metric.Data = dedupeMetricRecords(metric.Data)
+		data.Metrics = append(data.Metrics, *metric)
+	}
+
+	for _, workout := range imp.workouts {
+		for _, record := range imp.metricRecords("heart_rate", workout.Start, workout.End) {
+			workout.HeartRateData = append(workout.HeartRateData, HeartRateData{
+				Avg: record.Qty, Min: record.Qty, Max: record.Qty,
+				Date: record.Date, Source: record.Source, Units: imp.metrics["heart_rate"].Units,
+			})
+		}
+		for _, record := range imp.metricRecords("active_energy", workout.Start, workout.End) {
+			workout.ActiveEnergy = append(workout.ActiveEnergy, EnergyRecord{
+				Date: record.Date, Qty: record.Qty, Source: record.Source, Units: imp.metrics["active_energy"].Units,
+			})
+		}
+		for _, record := range imp.metricRecords("step_count", workout.Start, workout.End) {
+			workout.StepCount = append(workout.StepCount, StepRecord{
+				Date: record.Date, Qty: record.Qty, Source: record.Source, Units: imp.metrics["step_count"].Units,
+			})
+		}
+		for _, record := range imp.metricRecords("walking_running_distance", workout.Start, workout.End) {
+			workout.WalkingAndRunningDistance = append(workout.WalkingAndRunningDistance, DistanceRecord{
+				Date: record.Date, Qty: record.Qty, Source: record.Source, Units: imp.metrics["walking_running_distance"].Units,
+			})
+		}
+		data.Workouts = append(data.Workouts, workout)
+	}
+
+	data.ECG = imp.ecg
+	data.HeartRateNotifications = imp.notifications
+	data.Symptoms = imp.symptoms
+
+	if len(imp.skipped) > 0 {
+		slog.Info("Skipped unsupported Apple Health records", "types", imp.skipped)
+	}
+	slog.Debug("Imported Apple Health export",
+		"metrics", len(data.Metrics),
+		"workouts", len(data.Workouts),
+		"ecg", len(data.ECG))
+	return data
+}
+
+// metricRecords returns the records of a sorted metric dated within [from, to].
+func (imp *appleImporter) metricRecords(name string, from, to time.Time) []MetricRecord {
+	metric, ok := imp.metrics[name]
+	if !ok {
+		return nil
+	}
+	records := metric.Data
+	i := sort.Search(len(records), func(i int) bool { return !records[i].Date.Before(from) })
+	j := sort.Search(len(records), func(j int) bool { return records[j].Date.After(to) })
+	if i >= j {
+		return nil
+	}
+	return records[i:j]
+}
+
+// dedupeMetricRecords sorts records by date and drops exact duplicates, such
+// as records listed both on their own and inside a Correlation.
+func dedupeMetricRecords(records []MetricRecord) []MetricRecord {
+	sort.SliceStable(records, func(a, b int) bool { return records[a].Date.Before(records[b].Date) })
+	seen := make(map[metricRecordKey]bool, len(records))
+	deduped := records[:0]
+	for _, record := range records {
+		key := newMetricRecordKey(record)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, record)
+	}
+	return deduped
+}
+
+// readGPX reads the track points of a workout route.
+func readGPX(r io.Reader) ([]RoutePoint, error) {
+	var gpx struct {
+		Tracks []struct {
+			Segments []struct {
+				Points []struct {
+					Lat        float64   `xml:"lat,attr"`
+					Lon        float64   `xml:"lon,attr"`
+					Ele        float64   `xml:"ele"`
+					Time       time.Time `xml:"time"`
+					Extensions struct {
+						Speed float64 `xml:"speed"`
+					} `xml:"extensions"`
+				} `xml:"trkpt"`
+			} `xml:"trkseg"`
+		} `xml:"trk"`
+	}
+	if err := xml.NewDecoder(r).Decode(&gpx); err != nil {
+		return nil, fmt.Errorf("parsing GPX: %w", err)
+	}
+
+	var points []RoutePoint
+	for _, track := range gpx.Tracks {
+		for _, segment := range track.Segments {
+			for _, p := range segment.Points {
+				points = append(points, RoutePoint{
+					Latitude:  p.Lat,
+					Longitude: p.Lon,
+					Altitude:  p.Ele,
+					Timestamp: p.Time,
+					Speed:     p.Extensions.Speed,
+				})
+			}
+		}
+	}
+	return points, nil
+}
+
+// appleMetricName returns the metric name for a HealthKit quantity type
+// identifier without its prefix.
+func appleMetricName(identifier string) string {
+	if name, ok := appleMetricNames[identifier]; ok {
+		return name
+	}
+	return snakeCase(identifier)
+}
+
+// appleWorkoutName returns a display name for a workout activity type, with
+// "Indoor" or "Outdoor" for walks, runs and rides that record it.
+func appleWorkoutName(activityType, indoor string) string {
+	activity := strings.TrimPrefix(activityType, hkWorkoutPrefix)
+	if short, ok := appleWorkoutNames[activity]; ok && indoor != "" {
+		if indoor == "1" {
+			return "Indoor " + short
+		}
+		return "Outdoor " + short
+	}
+	return strings.Join(camelWords(activity), " ")
+}
+
+// appleWorkoutID derives a stable workout ID, since export.xml has none, so
+// re-imports of the same workout de-duplicate.
+func appleWorkoutID(activityType, start, end, source string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{activityType, start, end, source}, "|")))
+	return "apple-" + hex.EncodeToString(sum[:8])
+}
+
+// appleMetadataMap returns metadata entries as a map.
+func appleMetadataMap(entries []appleMetadataEntry) map[string]string {
+	if len(entries) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		metadata[entry.Key] = entry.Value
+	}
+	return metadata
+}
+
+// parseAppleQuantity parses a metadata quantity such as "68 degF" or
+// "512 hertz".
+func parseAppleQuantity(s string) ValueWithUnits {
+	value, units, _ := strings.Cut(strings.TrimSpace(s), " ")
+	qty, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return ValueWithUnits{}
+	}
+	return ValueWithUnits{Qty: qty, Units: strings.TrimSpace(units)}
+}
+
+// snakeCase converts a CamelCase identifier to snake_case, keeping acronyms
+// together: "HeartRateVariabilitySDNN" becomes "heart_rate_variability_sdnn"
+// and "VO2Max" becomes "vo2_max".
+func snakeCase(s string) string {
+	return strings.ToLower(strings.Join(camelWords(s), "_"))
+}
+
+// camelWords splits a CamelCase identifier into its words.
+func camelWords(s string) []string {
+	runes := []rune(s)
+	var words []string
+	begin := 0
+	for i := 1; i < len(runes); i++ {
+		if !unicode.IsUpper(runes[i]) {
+			continue
+		}
+		prev := runes[i-1]
+		nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+			words = append(words, string(runes[begin:i]))
+			begin = i
+		}
+	}
+	if begin < len(runes) {
+		words = append(words, string(runes[begin:]))
+	}
+	return words
+}
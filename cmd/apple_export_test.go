@@ -0,0 +1,231 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAppleExportXML = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE HealthData [
+<!ELEMENT HealthData (ExportDate,Me,(Record|Correlation|Workout|ActivitySummary)*)>
+]>
+<HealthData locale="en_US">
+ <ExportDate value="2025-11-17 10:00:00 -0500"/>
+ <Me HKCharacteristicTypeIdentifierBiologicalSex="HKBiologicalSexNotSet"/>
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" startDate="2025-11-10 17:05:00 -0500" endDate="2025-11-10 17:10:00 -0500" value="600"/>
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" startDate="2025-11-10 08:00:00 -0500" endDate="2025-11-10 08:10:00 -0500" value="1000"/>
+ <Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Watch" unit="count/min" startDate="2025-11-10 17:01:00 -0500" endDate="2025-11-10 17:01:00 -0500" value="100">
+  <MetadataEntry key="HKMetadataKeyHeartRateMotionContext" value="0"/>
+ </Record>
+ <Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Watch" unit="count/min" startDate="2025-11-10 20:00:00 -0500" endDate="2025-11-10 20:00:00 -0500" value="60"/>
+ <Record type="HKQuantityTypeIdentifierOxygenSaturation" sourceName="Watch" unit="%" startDate="2025-11-10 03:00:00 -0500" endDate="2025-11-10 03:00:00 -0500" value="0.97"/>
+ <Correlation type="HKCorrelationTypeIdentifierBloodPressure" startDate="2025-11-10 09:00:00 -0500" endDate="2025-11-10 09:00:00 -0500">
+  <Record type="HKQuantityTypeIdentifierBloodPressureSystolic" sourceName="Cuff" unit="mmHg" startDate="2025-11-10 09:00:00 -0500" endDate="2025-11-10 09:00:00 -0500" value="120"/>
+ </Correlation>
+ <Record type="HKQuantityTypeIdentifierBloodPressureSystolic" sourceName="Cuff" unit="mmHg" startDate="2025-11-10 09:00:00 -0500" endDate="2025-11-10 09:00:00 -0500" value="120"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" startDate="2025-11-10 00:00:00 -0500" endDate="2025-11-10 06:30:00 -0500" value="HKCategoryValueSleepAnalysisAsleepCore"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" startDate="2025-11-09 23:30:00 -0500" endDate="2025-11-10 07:00:00 -0500" value="HKCategoryValueSleepAnalysisInBed"/>
+ <Record type="HKCategoryTypeIdentifierHeadache" sourceName="iPhone" startDate="2025-11-10 12:00:00 -0500" endDate="2025-11-10 13:00:00 -0500" value="HKCategoryValueSeverityMild"/>
+ <Record type="HKCategoryTypeIdentifierHighHeartRateEvent" sourceName="Watch" startDate="2025-11-10 14:00:00 -0500" endDate="2025-11-10 14:10:00 -0500" value="HKCategoryValueNotApplicable">
+  <MetadataEntry key="HKHeartRateEventThreshold" value="120 count/min"/>
+ </Record>
+ <Record type="HKCategoryTypeIdentifierAppleStandHour" sourceName="Watch" startDate="2025-11-10 10:00:00 -0500" endDate="2025-11-10 11:00:00 -0500" value="HKCategoryValueAppleStandHourStood"/>
+ <Workout workoutActivityType="HKWorkoutActivityTypeWalking" duration="30" durationUnit="min" sourceName="Watch" startDate="2025-11-10 17:00:00 -0500" endDate="2025-11-10 17:30:00 -0500">
+  <MetadataEntry key="HKIndoorWorkout" value="0"/>
+  <MetadataEntry key="HKElevationAscended" value="1250 cm"/>
+  <MetadataEntry key="HKWeatherTemperature" value="68 degF"/>
+  <MetadataEntry key="HKWeatherHumidity" value="5400 %"/>
+  <WorkoutEvent type="HKWorkoutEventTypeSegment" date="2025-11-10 17:00:00 -0500"/>
+  <WorkoutStatistics type="HKQuantityTypeIdentifierActiveEnergyBurned" startDate="2025-11-10 17:00:00 -0500" endDate="2025-11-10 17:30:00 -0500" sum="120" unit="kcal"/>
+  <WorkoutStatistics type="HKQuantityTypeIdentifierDistanceWalkingRunning" startDate="2025-11-10 17:00:00 -0500" endDate="2025-11-10 17:30:00 -0500" sum="1.5" unit="mi"/>
+  <WorkoutStatistics type="HKQuantityTypeIdentifierHeartRate" startDate="2025-11-10 17:00:00 -0500" endDate="2025-11-10 17:30:00 -0500" average="100" minimum="90" maximum="110" unit="count/min"/>
+  <WorkoutRoute sourceName="Watch" startDate="2025-11-10 17:00:00 -0500" endDate="2025-11-10 17:30:00 -0500">
+   <FileReference path="/workout-routes/route_2025-11-10_5.00pm.gpx"/>
+  </WorkoutRoute>
+ </Workout>
+ <Workout workoutActivityType="HKWorkoutActivityTypeTraditionalStrengthTraining" duration="45" durationUnit="min" totalEnergyBurned="200" totalEnergyBurnedUnit="kcal" sourceName="Watch" startDate="2025-11-11 07:00:00 -0500" endDate="2025-11-11 07:45:00 -0500"/>
+ <ActivitySummary dateComponents="2025-11-10" activeEnergyBurned="450" activeEnergyBurnedGoal="500" activeEnergyBurnedUnit="kcal" appleExerciseTime="35" appleExerciseTimeGoal="30" appleStandHours="10" appleStandHoursGoal="12"/>
+</HealthData>
+`
+
+const testAppleECG = `Name,Jane Doe
+Date of Birth,"Jan 1, 1980"
+Recorded Date,2025-11-10 08:15:22 -0500
+Classification,Sinus Rhythm
+Symptoms,
+Software Version,2.0
+Device,"Watch6,1"
+Sample Rate,512 hertz
+,
+Lead,Lead I
+Unit,µV
+
+-3.951
+-5.12
+12.5
+20
+`
+
+const testAppleGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="Apple Health Export" xmlns="http://www.topografix.com/GPX/1/1">
+ <trk><name>Route 2025-11-10 5:00pm</name><trkseg>
+  <trkpt lon="-77.0365" lat="38.8977"><ele>20.5</ele><time>2025-11-10T22:00:01Z</time><extensions><speed>1.4</speed></extensions></trkpt>
+  <trkpt lon="-77.0366" lat="38.8978"><ele>21.0</ele><time>2025-11-10T22:00:02Z</time><extensions><speed>1.5</speed></extensions></trkpt>
+ </trkseg></trk>
+</gpx>
+`
+
+func TestLoadAppleExportZip(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"apple_health_export/export.xml":                                    testAppleExportXML,
+		"apple_health_export/export_cda.xml":                                "<ClinicalDocument/>",
+		"apple_health_export/electrocardiograms/ecg_2025-11-10.csv":         testAppleECG,
+		"apple_health_export/workout-routes/route_2025-11-10_5.00pm.gpx":    testAppleGPX,
+		"apple_health_export/workout-routes/route_2025-01-01_unmatched.gpx": "<gpx/>",
+	} {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	w.Close()
+
+	source := filepath.Join(t.TempDir(), "export.zip")
+	if err := os.WriteFile(source, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	healthData, err := loadHealthData(source, formatAuto)
+	if err != nil {
+		t.Fatalf("loadHealthData() error = %v", err)
+	}
+	data := healthData.Data
+
+	metrics := make(map[string]Metric)
+	for _, metric := range data.Metrics {
+		metrics[metric.Name] = metric
+	}
+	metricTests := []struct {
+		name      string
+		units     string
+		count     int
+		firstQty  float64
+		firstDate string
+	}{
+		{"step_count", "count", 2, 1000, "2025-11-10T08:00:00-05:00"},
+		{"heart_rate", "count/min", 2, 100, "2025-11-10T17:01:00-05:00"},
+		{"blood_oxygen_saturation", "%", 1, 97, "2025-11-10T03:00:00-05:00"},
+		{"blood_pressure_systolic", "mmHg", 1, 120, "2025-11-10T09:00:00-05:00"},
+		{"sleep_analysis", "hr", 1, 6.5, "2025-11-10T00:00:00-05:00"},
+		{"activity_stand_hours", "hr", 1, 10, ""},
+		{"activity_active_energy_goal", "kcal", 1, 500, ""},
+	}
+	for _, tt := range metricTests {
+		metric, ok := metrics[tt.name]
+		if !ok {
+			t.Errorf("metric %s missing; have %v", tt.name, data.Metrics)
+			continue
+		}
+		if metric.Units != tt.units || len(metric.Data) != tt.count {
+			t.Errorf("%s: units %q, %d records, want %q, %d", tt.name, metric.Units, len(metric.Data), tt.units, tt.count)
+			continue
+		}
+		first := metric.Data[0]
+		if diff := first.Qty - tt.firstQty; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("%s: first qty = %v, want %v", tt.name, first.Qty, tt.firstQty)
+		}
+		if tt.firstDate != "" && first.Date.Format(time.RFC3339) != tt.firstDate {
+			t.Errorf("%s: first date = %s, want %s", tt.name, first.Date.Format(time.RFC3339), tt.firstDate)
+		}
+	}
+
+	if len(data.Workouts) != 2 {
+		t.Fatalf("imported %d workouts, want 2", len(data.Workouts))
+	}
+	walk := data.Workouts[0]
+	if walk.Name != "Outdoor Walk" || walk.Duration != 1800 || walk.ID == "" {
+		t.Errorf("walk = %q, duration %v, id %q, want Outdoor Walk, 1800, an ID", walk.Name, walk.Duration, walk.ID)
+	}
+	if walk.ActiveEnergyBurned != (EnergyValue{Qty: 120, Units: "kcal"}) || walk.Distance != (ValueWithUnits{Qty: 1.5, Units: "mi"}) {
+		t.Errorf("walk totals = %+v, %+v, want 120 kcal, 1.5 mi", walk.ActiveEnergyBurned, walk.Distance)
+	}
+	if walk.ElevationUp != (ValueWithUnits{Qty: 12.5, Units: "m"}) || walk.Humidity.Qty != 54 || walk.Temperature.Units != "degF" {
+		t.Errorf("walk conditions = %+v, %+v, %+v", walk.ElevationUp, walk.Humidity, walk.Temperature)
+	}
+	if len(walk.HeartRateData) != 1 || walk.HeartRateData[0].Avg != 100 || len(walk.StepCount) != 1 {
+		t.Errorf("walk series: %d heart rate, %d steps, want 1, 1", len(walk.HeartRateData), len(walk.StepCount))
+	}
+	route, ok := walk.Route.([]RoutePoint)
+	if !ok || len(route) != 2 || route[0].Latitude != 38.8977 || route[1].Speed != 1.5 {
+		t.Errorf("walk route = %+v, want 2 GPX points", walk.Route)
+	}
+	strength := data.Workouts[1]
+	if strength.Name != "Traditional Strength Training" || strength.ActiveEnergyBurned.Qty != 200 || strength.Route != nil {
+		t.Errorf("strength workout = %q, %v kcal, route %v", strength.Name, strength.ActiveEnergyBurned.Qty, strength.Route)
+	}
+
+	if len(data.ECG) != 1 {
+		t.Fatalf("imported %d ECGs, want 1", len(data.ECG))
+	}
+	ecg := data.ECG[0].(AppleECG)
+	if ecg.Classification != "Sinus Rhythm" || ecg.Source != "Watch6,1" || ecg.SamplingFrequency != 512 ||
+		ecg.NumberOfVoltageMeasurements != 4 || ecg.Units != "µV" {
+		t.Errorf("ecg = %+v", ecg)
+	}
+	if len(data.Symptoms) != 1 || len(data.HeartRateNotifications) != 1 {
+		t.Errorf("imported %d symptoms, %d notifications, want 1, 1", len(data.Symptoms), len(data.HeartRateNotifications))
+	}
+
+	// The whole pipeline runs on the imported data
+	if err := exportData(context.Background(), healthData, exportSource{}, t.TempDir()); err != nil {
+		t.Errorf("exportData() error = %v", err)
+	}
+}
+
+func TestLoadAppleExportXML(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "export.xml")
+	if err := os.WriteFile(source, []byte(testAppleExportXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	healthData, err := loadHealthData(source, formatAuto)
+	if err != nil {
+		t.Fatalf("loadHealthData() error = %v", err)
+	}
+	if len(healthData.Data.Workouts) != 2 || healthData.Data.Workouts[0].Route != nil {
+		t.Errorf("imported %d workouts, want 2 without routes", len(healthData.Data.Workouts))
+	}
+
+	again, _ := loadHealthData(source, formatAuto)
+	if again.Data.Workouts[0].ID != healthData.Data.Workouts[0].ID {
+		t.Error("workout IDs differ between imports of the same file")
+	}
+
+	if _, err := decodeAppleXML(strings.NewReader("<HealthData><Record")); err == nil {
+		t.Error("decodeAppleXML() of truncated XML succeeded, want error")
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"StepCount":                     "step_count",
+		"HeartRateVariabilitySDNN":      "heart_rate_variability_sdnn",
+		"VO2Max":                        "vo2_max",
+		"UVExposure":                    "uv_exposure",
+		"AppleSleepingWristTemperature": "apple_sleeping_wrist_temperature",
+	}
+	for in, want := range tests {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// ageSuffix is appended to the name of every file written encrypted.
+const ageSuffix = ".age"
+
+// identityFileName is the passphrase-encrypted key that the files of an
+// export encrypted with a passphrase are encrypted to.
+const identityFileName = "identity.age"
+
+// passphraseWorkFactor is the scrypt work factor (log2 N) protecting the key
+// of passphrase-encrypted exports.
+var passphraseWorkFactor = 18
+
+var (
+	decryptDir        string
+	decryptOut        string
+	decryptIdentities []string
+)
+
+// decryptCmd writes a decrypted copy of an encrypted export
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Write a decrypted copy of an encrypted export",
+	Long: `Decrypt every file of an export written with --encrypt into a new
+directory. Files that are not encrypted, such as import.sh, are copied as they
+are. The copy is an ordinary export: it can be verified, served, imported and
+tracked with import status.
+
+Files are decrypted with the age identities in --identity, or with the
+passphrase in AHEP_PASSPHRASE for exports encrypted with a passphrase.`,
+	Example: `  # Decrypt an export encrypted to an age key
+  apple-health-export-parser decrypt --export exports/2025-11-17 --output /tmp/2025-11-17 --identity ~/.config/age/key.txt
+
+  # Decrypt an export encrypted with a passphrase
+  AHEP_PASSPHRASE=... apple-health-export-parser decrypt --export exports/2025-11-17 --output /tmp/2025-11-17`,
+	Args: cobra.NoArgs,
+	RunE: runDecrypt,
+}
+
+// catCmd prints export files, decrypting encrypted ones
+var catCmd = &cobra.Command{
+	Use:   "cat FILE...",
+	Short: "Print export files, decrypting encrypted ones",
+	Long: `Write the content of export files to standard output. Files ending in .age
+are decrypted with the age identities in --identity, or with the passphrase in
+AHEP_PASSPHRASE; other files are printed as they are.`,
+	Example: `  # Read one workout of an encrypted export
+  apple-health-export-parser cat --identity key.txt exports/2025-11-17/workouts/2025-11-10_07-00-00_Outdoor_Walk_4f6a8b1c_summary.json.age`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runCat,
+}
+
+func init() {
+	rootCmd.AddCommand(decryptCmd)
+	rootCmd.AddCommand(catCmd)
+
+	decryptCmd.Flags().StringVarP(&decryptDir, "export", "e", "exports", "encrypted export directory")
+	decryptCmd.Flags().StringVarP(&decryptOut, "output", "o", "", "directory to write the decrypted copy to (required)")
+	decryptCmd.Flags().StringSliceVarP(&decryptIdentities, "identity", "i", []string{}, "age identity file (repeatable; default: passphrase in AHEP_PASSPHRASE)")
+	decryptCmd.MarkFlagRequired("output")
+
+	catCmd.Flags().StringSliceVarP(&decryptIdentities, "identity", "i", []string{}, "age identity file (repeatable; default: passphrase in AHEP_PASSPHRASE)")
+
+	viper.BindEnv("passphrase", "AHEP_PASSPHRASE")
+}
+
+var (
+	encryptExport         bool
+	encryptRecipients     []string
+	encryptRecipientsFile string
+	encryptPlainManifest  bool
+)
+
+// exportEncryption encrypts the files of an export, or is nil when exports
+// are written in plain text. It is set by configureExport.
+var exportEncryption *exportEncrypter
+
+// exportEncrypter holds the recipients export files are encrypted to.
+type exportEncrypter struct {
+	recipients    []age.Recipient
+	identity      []byte        // Passphrase-encrypted key written as identity.age, if any
+	passphrase    age.Recipient // Passphrase recipient, in passphrase mode
+	plainManifest bool          // Write manifest.json unencrypted
+}
+
+// addEncryptionFlags registers the flags that turn on export encryption.
+func addEncryptionFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&encryptExport, "encrypt", false, "encrypt export and import batch files with age (to --recipient, or AHEP_PASSPHRASE); file names, with record times and workout and state of mind types, stay readable")
+	cmd.Flags().StringSliceVar(&encryptRecipients, "recipient", []string{}, "age public key (age1...) to encrypt to (repeatable)")
+	cmd.Flags().StringVar(&encryptRecipientsFile, "recipients-file", "", "file of age public keys to encrypt to, one per line")
+	cmd.Flags().BoolVar(&encryptPlainManifest, "plain-manifest", false, "keep manifest.json readable when encrypting; it lists every file name")
+}
+
+// newExportEncrypter returns the encrypter for the encryption flags, or nil
+// when --encrypt is not set. Without recipients the passphrase in
+// AHEP_PASSPHRASE is used: a key is generated for the run, stored encrypted
+// with the passphrase as identity.age in each export, and the files are
+// encrypted to it, so scrypt runs once per export rather than once per file.
+func newExportEncrypter(enabled bool, recipients []string, recipientsFile, passphrase string, plainManifest bool) (*exportEncrypter, error) {
+	if !enabled {
+		if len(recipients) > 0 || recipientsFile != "" {
+			return nil, fmt.Errorf("--recipient and --recipients-file require --encrypt")
+		}
+		return nil, nil
+	}
+
+	enc := &exportEncrypter{plainManifest: plainManifest}
+	for _, s := range recipients {
+		recipient, err := age.ParseX25519Recipient(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient '%s': %w", s, err)
+		}
+		enc.recipients = append(enc.recipients, recipient)
+	}
+	if recipientsFile != "" {
+		f, err := os.Open(recipientsFile)
+		if err != nil {
+			return nil, fmt.Errorf("opening recipients file: %w", err)
+		}
+		defer f.Close()
+		parsed, err := age.ParseRecipients(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading recipients file '%s': %w", recipientsFile, err)
+		}
+		enc.recipients = append(enc.recipients, parsed...)
+	}
+	if len(enc.recipients) > 0 {
+		return enc, nil
+	}
+
+	if passphrase == "" {
+		return nil, fmt.Errorf("--encrypt requires --recipient, --recipients-file or a passphrase in AHEP_PASSPHRASE")
+	}
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, fmt.Errorf("generating export key: %w", err)
+	}
+	scrypt, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	scrypt.SetWorkFactor(passphraseWorkFactor)
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, scrypt)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting export key: %w", err)
+	}
+	if _, err := io.WriteString(w, identity.String()+"\n"); err != nil {
+		return nil, fmt.Errorf("encrypting export key: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("encrypting export key: %w", err)
+	}
+	enc.recipients = []age.Recipient{identity.Recipient()}
+	enc.identity = buf.Bytes()
+	enc.passphrase = scrypt
+	return enc, nil
+}
+
+// encryptFile encrypts a file stored on its own, outside an export directory,
+// such as a payload kept by receive. It is encrypted to the recipients, or
+// with the passphrase, since the key of an export is stored with the export.
+func (enc *exportEncrypter) encryptFile(data []byte) ([]byte, error) {
+	recipients := enc.recipients
+	if enc.passphrase != nil {
+		recipients = []age.Recipient{enc.passphrase}
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// storedName returns the name a file of the export is written under: name,
+// with the .age suffix when exports are encrypted. Only the content is
+// encrypted, so the time and type of each record in its name stay readable.
+func storedName(name string) string {
+	if exportEncryption == nil {
+		return name
+	}
+	return name + ageSuffix
+}
+
+// writeExportIdentity writes the passphrase-encrypted export key to the export
+// directory dir, when the export is encrypted with a passphrase.
+func writeExportIdentity(dir string) error {
+	if exportEncryption == nil || exportEncryption.identity == nil {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(dir, identityFileName), exportEncryption.identity, 0600)
+}
+
+// loadIdentities returns the age identities in identityFiles, or an scrypt
+// identity for the passphrase when no identity files are given.
+func loadIdentities(identityFiles []string, passphrase string) ([]age.Identity, error) {
+	var identities []age.Identity
+	for _, name := range identityFiles {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("opening identity file: %w", err)
+		}
+		parsed, err := age.ParseIdentities(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading identity file '%s': %w", name, err)
+		}
+		identities = append(identities, parsed...)
+	}
+	if len(identities) > 0 {
+		return identities, nil
+	}
+
+	if passphrase == "" {
+		return nil, fmt.Errorf("an identity is required: set --identity or AHEP_PASSPHRASE")
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return []age.Identity{identity}, nil
+}
+
+// unlockExport adds the key of the export directory dir to identities when
+// the export was encrypted with a passphrase and one of identities opens it.
+func unlockExport(dir string, identities []age.Identity) ([]age.Identity, error) {
+	f, err := os.Open(filepath.Join(dir, identityFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return identities, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := age.Decrypt(f, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("unlocking export key in '%s': %w", dir, err)
+	}
+	key, err := age.ParseIdentities(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading export key in '%s': %w", dir, err)
+	}
+	return append(identities, key...), nil
+}
+
+// openExportFile opens a file of an export for reading, decrypting it when
+// its name ends in .age.
+func openExportFile(name string, identities []age.Identity) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ageSuffix) {
+		return f, nil
+	}
+	r, err := age.Decrypt(f, identities...)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("decrypting %s: %w", name, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+// decryptExport writes a decrypted copy of the export directory dir to out,
+// which must not exist or be empty. Unencrypted files are copied as they are
+// and the manifest's file hashes are recomputed, so the copy verifies and can
+// be served, imported and tracked like any export.
+func decryptExport(dir, out string, identities []age.Identity) (int, error) {
+	if entries, err := os.ReadDir(out); err == nil && len(entries) > 0 {
+		return 0, fmt.Errorf("output directory '%s' is not empty", out)
+	}
+	identities, err := unlockExport(dir, identities)
+	if err != nil {
+		return 0, err
+	}
+
+	decrypted := 0
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), stagingPrefix) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if filepath.ToSlash(rel) == identityFileName {
+			return nil
+		}
+
+		target := filepath.Join(out, strings.TrimSuffix(rel, ageSuffix))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := copyExportFile(path, target, info.Mode().Perm(), identities); err != nil {
+			return err
+		}
+		if strings.HasSuffix(rel, ageSuffix) {
+			decrypted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	manifestFile := filepath.Join(out, manifestFileName)
+	manifest := &ExportManifest{}
+	if err := readJSONFile(manifestFile, manifest); err != nil {
+		return 0, err
+	}
+	manifest.Encrypted = false
+	if manifest.Files, err = hashExportFiles(out); err != nil {
+		return 0, fmt.Errorf("hashing decrypted files: %w", err)
+	}
+	if err := writeJSONFile(manifest, manifestFile, nil); err != nil {
+		return 0, fmt.Errorf("writing decrypted manifest: %w", err)
+	}
+	return decrypted, nil
+}
+
+// copyExportFile copies the export file src to dst, decrypting it when its
+// name ends in .age.
+func copyExportFile(src, dst string, perm os.FileMode, identities []age.Identity) error {
+	r, err := openExportFile(src, identities)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return fmt.Errorf("copying %s: %w", src, err)
+	}
+	return w.Close()
+}
+
+// runDecrypt executes the decrypt command
+func runDecrypt(cmd *cobra.Command, args []string) error {
+	identities, err := loadIdentities(decryptIdentities, viper.GetString("passphrase"))
+	if err != nil {
+		return err
+	}
+	count, err := decryptExport(decryptDir, decryptOut, identities)
+	if err != nil {
+		return err
+	}
+	slog.Info("Decrypted export", "export", decryptDir, "output", decryptOut, "files", count)
+	return nil
+}
+
+// runCat executes the cat command
+func runCat(cmd *cobra.Command, args []string) error {
+	identities, err := loadIdentities(decryptIdentities, viper.GetString("passphrase"))
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	for _, name := range args {
+		fileIdentities, err := unlockExport(findExportRoot(name), identities)
+		if err != nil {
+			return err
+		}
+		r, err := openExportFile(name, fileIdentities)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// findExportRoot returns the export directory holding the file name: the
+// nearest parent directory with a manifest or an export key, or the file's
+// own directory if there is none.
+func findExportRoot(name string) string {
+	start := filepath.Dir(name)
+	for dir := start; ; dir = filepath.Dir(dir) {
+		for _, marker := range []string{manifestFileName, manifestFileName + ageSuffix, identityFileName} {
+			if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+				return dir
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return start
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestExportDataEncrypted(t *testing.T) {
+	key := mustIdentity(t)
+	previousWorkFactor := passphraseWorkFactor
+	passphraseWorkFactor = 10
+	defer func() { passphraseWorkFactor = previousWorkFactor }()
+
+	tests := []struct {
+		name          string
+		recipients    []string
+		passphrase    string
+		plainManifest bool
+		identities    func(t *testing.T) []age.Identity
+	}{
+		{
+			name:          "recipient",
+			recipients:    []string{key.Recipient().String()},
+			plainManifest: true,
+			identities:    func(t *testing.T) []age.Identity { return []age.Identity{key} },
+		},
+		{
+			name:       "passphrase",
+			passphrase: "correct horse battery staple",
+			identities: func(t *testing.T) []age.Identity {
+				identities, err := loadIdentities(nil, "correct horse battery staple")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return identities
+			},
+		},
+	}
+
+	plainDir := t.TempDir()
+	if err := exportData(context.Background(), HealthData{Data: testHealthData()}, exportSource{}, plainDir); err != nil {
+		t.Fatalf("exportData() error = %v", err)
+	}
+	_, want, err := loadExportDir(plainDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := newExportEncrypter(true, tt.recipients, "", tt.passphrase, tt.plainManifest)
+			if err != nil {
+				t.Fatalf("newExportEncrypter() error = %v", err)
+			}
+			exportEncryption = enc
+			dir := t.TempDir()
+			err = exportData(context.Background(), HealthData{Data: testHealthData()}, exportSource{}, dir)
+			exportEncryption = nil
+			if err != nil {
+				t.Fatalf("exportData() error = %v", err)
+			}
+
+			var plain []string
+			filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() && !strings.HasSuffix(path, ageSuffix) {
+					plain = append(plain, path)
+				}
+				return err
+			})
+			wantPlain := []string(nil)
+			if tt.plainManifest {
+				wantPlain = []string{filepath.Join(dir, manifestFileName)}
+			}
+			if !reflect.DeepEqual(plain, wantPlain) {
+				t.Errorf("unencrypted files = %v, want %v", plain, wantPlain)
+			}
+
+			if _, _, err := loadExportDir(dir); err == nil {
+				t.Error("loadExportDir() of an encrypted export succeeded")
+			}
+			if tt.plainManifest {
+				if result, err := verifyExport(dir, ""); err != nil || !result.OK() {
+					t.Errorf("verifyExport() = %+v, %v; want OK", result, err)
+				}
+			}
+
+			out := filepath.Join(t.TempDir(), "decrypted")
+			if _, err := decryptExport(dir, out, tt.identities(t)); err != nil {
+				t.Fatalf("decryptExport() error = %v", err)
+			}
+			_, got, err := loadExportDir(out)
+			if err != nil {
+				t.Fatalf("loadExportDir() of decrypted copy error = %v", err)
+			}
+			if len(got.Metrics) != len(want.Metrics) || len(got.Workouts) != len(want.Workouts) || len(got.StateOfMind) != len(want.StateOfMind) {
+				t.Errorf("decrypted copy has %d metrics, %d workouts, %d state of mind; want %d, %d, %d",
+					len(got.Metrics), len(got.Workouts), len(got.StateOfMind), len(want.Metrics), len(want.Workouts), len(want.StateOfMind))
+			}
+			if result, err := verifyExport(out, ""); err != nil || !result.OK() {
+				t.Errorf("verifyExport() of decrypted copy = %+v, %v; want OK", result, err)
+			}
+
+			if _, err := decryptExport(dir, filepath.Join(t.TempDir(), "wrong"), []age.Identity{mustIdentity(t)}); err == nil {
+				t.Error("decryptExport() with the wrong identity succeeded")
+			}
+		})
+	}
+}
+
+func TestRunCat(t *testing.T) {
+	key := mustIdentity(t)
+	dir := t.TempDir()
+	writeTestFile(t, dir, "plain.json", "{}\n")
+	if err := writeJSONFile(map[string]int{"n": 1}, filepath.Join(dir, "secret.json"+ageSuffix), []age.Recipient{key.Recipient()}); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "key.txt", key.String()+"\n")
+
+	previous := decryptIdentities
+	decryptIdentities = []string{filepath.Join(dir, "key.txt")}
+	defer func() { decryptIdentities = previous }()
+
+	var out bytes.Buffer
+	catCmd.SetOut(&out)
+	if err := runCat(catCmd, []string{filepath.Join(dir, "plain.json"), filepath.Join(dir, "secret.json"+ageSuffix)}); err != nil {
+		t.Fatalf("runCat() error = %v", err)
+	}
+	if want := "{}\n{\n  \"n\": 1\n}\n"; out.String() != want {
+		t.Errorf("runCat() output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestNewExportEncrypterErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		recipients []string
+	}{
+		{"recipient without encrypt", false, []string{"age1xyz"}},
+		{"invalid recipient", true, []string{"age1xyz"}},
+		{"no recipient or passphrase", true, nil},
+	}
+	for _, tt := range tests {
+		if _, err := newExportEncrypter(tt.enabled, tt.recipients, "", "", false); err == nil {
+			t.Errorf("%s: newExportEncrypter() succeeded", tt.name)
+		}
+	}
+}
+
+func TestConfigureExportRejectsEncryptedImportScript(t *testing.T) {
+	previousEncrypt, previousRecipients, previousScript := encryptExport, encryptRecipients, generateImportScript
+	defer func() {
+		encryptExport, encryptRecipients, generateImportScript = previousEncrypt, previousRecipients, previousScript
+		exportEncryption = nil
+	}()
+	encryptExport, encryptRecipients, generateImportScript = true, []string{mustIdentity(t).Recipient().String()}, true
+
+	if err := configureExport(); err == nil {
+		t.Error("configureExport() accepted --encrypt with --generate-import-script")
+	}
+}
+
+func mustIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	key, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
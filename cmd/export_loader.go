@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LoadedExport is health data loaded from a source file or a processed export directory.
+type LoadedExport struct {
+	Path     string          `json:"path"`
+	Kind     string          `json:"kind"`               // "source" or "export"
+	Manifest *ExportManifest `json:"manifest,omitempty"` // Only for export directories
+	Data     Data            `json:"-"`
+}
+
+// Kinds of loaded exports.
+const (
+	exportKindSource = "source"
+	exportKindDir    = "export"
+)
+
+// loadExport loads health data from a source file, standard input ("-") or, if
+// path is a directory, from an export directory written by the process command.
+func loadExport(path string) (*LoadedExport, error) {
+	isDir := false
+	if path != stdinSource {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading '%s': %w", path, err)
+		}
+		isDir = info.IsDir()
+	}
+
+	if !isDir {
+		healthData, err := loadHealthData(path, formatAuto)
+		if err != nil {
+			return nil, fmt.Errorf("loading '%s': %w", path, err)
+		}
+		return &LoadedExport{Path: path, Kind: exportKindSource, Data: healthData.Data}, nil
+	}
+
+	manifest, data, err := loadExportDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading export directory '%s': %w", path, err)
+	}
+	return &LoadedExport{Path: path, Kind: exportKindDir, Manifest: manifest, Data: data}, nil
+}
+
+// readManifest reads the manifest of the export directory dir into manifest.
+func readManifest(dir string, manifest *ExportManifest) error {
+	err := readJSONFile(filepath.Join(dir, manifestFileName), manifest)
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, statErr := os.Stat(filepath.Join(dir, manifestFileName+ageSuffix)); statErr == nil {
+			return fmt.Errorf("manifest in '%s' is encrypted; read a copy made by the decrypt command", dir)
+		}
+	}
+	return err
+}
+
+// loadExportDir rebuilds health data from an export directory's manifest,
+// metric, workout summary, workout detail and state of mind files. Workout
+// location, route and distance series are not exported and stay empty.
+func loadExportDir(dir string) (*ExportManifest, Data, error) {
+	var data Data
+
+	manifest := &ExportManifest{}
+	if err := readManifest(dir, manifest); err != nil {
+		return nil, data, err
+	}
+	if manifest.Encrypted {
+		return nil, data, fmt.Errorf("export '%s' is encrypted; read a copy made by the decrypt command", dir)
+	}
+
+	for _, rel := range manifest.Metrics {
+		var metric Metric
+		if err := readJSONFile(filepath.Join(dir, rel), &metric); err != nil {
+			return nil, data, err
+		}
+		data.Metrics = append(data.Metrics, metric)
+	}
+
+	for _, rel := range manifest.Workouts {
+		workout, err := loadExportedWorkout(dir, rel)
+		if err != nil {
+			return nil, data, err
+		}
+		data.Workouts = append(data.Workouts, workout)
+	}
+
+	for _, rel := range manifest.StateOfMind {
+		var som StateOfMind
+		if err := readJSONFile(filepath.Join(dir, rel), &som); err != nil {
+			return nil, data, err
+		}
+		data.StateOfMind = append(data.StateOfMind, som)
+	}
+
+	slog.Debug("Loaded export directory",
+		"dir", dir,
+		"metrics", len(data.Metrics),
+		"workouts", len(data.Workouts),
+		"state_of_mind", len(data.StateOfMind),
+	)
+	return manifest, data, nil
+}
+
+// loadExportedWorkout rebuilds a workout from its summary file and the detail
+// files exported next to it under workout_details/.
+func loadExportedWorkout(dir, relSummary string) (Workout, error) {
+	var summary WorkoutSummary
+	if err := readJSONFile(filepath.Join(dir, relSummary), &summary); err != nil {
+		return Workout{}, err
+	}
+
+	workout := Workout{
+		ID:                 summary.ID,
+		Name:               summary.Name,
+		Start:              summary.Start,
+		End:                summary.End,
+		Duration:           summary.Duration,
+		Temperature:        summary.Temperature,
+		Humidity:           summary.Humidity,
+		Intensity:          summary.Intensity,
+		ActiveEnergyBurned: summary.TotalEnergyBurned,
+		Distance:           summary.TotalDistance,
+		ElevationUp:        summary.ElevationUp,
+		Metadata:           summary.Metadata,
+		Extras:             summary.Extras,
+	}
+
+	base := strings.TrimSuffix(filepath.Base(relSummary), "_summary.json")
+	detailsDir := filepath.Join(dir, "workout_details", base)
+	details := []struct {
+		file   string
+		target interface{}
+	}{
+		{"heart_rate.json", &workout.HeartRateData},
+		{"heart_rate_recovery.json", &workout.HeartRateRecovery},
+		{"active_energy.json", &workout.ActiveEnergy},
+		{"step_count.json", &workout.StepCount},
+	}
+	for _, detail := range details {
+		filename := filepath.Join(detailsDir, detail.file)
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			continue
+		}
+		if err := readJSONFile(filename, detail.target); err != nil {
+			return Workout{}, err
+		}
+	}
+	return workout, nil
+}
+
+// readJSONFile decodes the JSON file at filename into v.
+func readJSONFile(filename string, v interface{}) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", filename, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	return nil
+}
+
+// mergeData combines the data of several exports. Workouts and state of mind
+// entries are de-duplicated by ID and metric records by time, value and source,
+// so overlapping exports can be loaded together.
+func mergeData(exports []*LoadedExport) Data {
+	var merged Data
+	seenWorkouts := make(map[string]bool)
+	seenMoods := make(map[string]bool)
+	metricIndex := make(map[string]int)
+	seenRecords := make(map[string]map[metricRecordKey]bool)
+
+	for _, export := range exports {
+		for _, workout := range export.Data.Workouts {
+			if workout.ID != "" && seenWorkouts[workout.ID] {
+				continue
+			}
+			seenWorkouts[workout.ID] = true
+			merged.Workouts = append(merged.Workouts, workout)
+		}
+
+		for _, som := range export.Data.StateOfMind {
+			if som.ID != "" && seenMoods[som.ID] {
+				continue
+			}
+			seenMoods[som.ID] = true
+			merged.StateOfMind = append(merged.StateOfMind, som)
+		}
+
+		for _, metric := range export.Data.Metrics {
+			key := metricKey(metric.Name)
+			i, ok := metricIndex[key]
+			if !ok {
+				i = len(merged.Metrics)
+				metricIndex[key] = i
+				seenRecords[key] = make(map[metricRecordKey]bool)
+				m := metric
+				m.Data = nil
+				merged.Metrics = append(merged.Metrics, m)
+			}
+			for _, record := range metric.Data {
+				recordKey := newMetricRecordKey(record)
+				if seenRecords[key][recordKey] {
+					continue
+				}
+				seenRecords[key][recordKey] = true
+				merged.Metrics[i].Data = append(merged.Metrics[i].Data, record)
+			}
+		}
+
+		merged.ECG = append(merged.ECG, export.Data.ECG...)
+		merged.HeartRateNotifications = append(merged.HeartRateNotifications, export.Data.HeartRateNotifications...)
+		merged.Symptoms = append(merged.Symptoms, export.Data.Symptoms...)
+		merged.Extras = mergeExtras(merged.Extras, export.Data.Extras)
+	}
+
+	for i := range merged.Metrics {
+		records := merged.Metrics[i].Data
+		sort.SliceStable(records, func(a, b int) bool { return records[a].Date.Before(records[b].Date) })
+	}
+	return merged
+}
+
+// metricRecordKey identifies a metric record for de-duplication.
+type metricRecordKey struct {
+	unixNano int64
+	qty      float64
+	source   string
+}
+
+// newMetricRecordKey returns the de-duplication key of record.
+func newMetricRecordKey(record MetricRecord) metricRecordKey {
+	return metricRecordKey{record.Date.UnixNano(), record.Qty, record.Source}
+}
+
+// loadExports loads and merges the given source files and export directories.
+func loadExports(paths []string) ([]*LoadedExport, Data, error) {
+	exports := make([]*LoadedExport, 0, len(paths))
+	for _, path := range paths {
+		start := time.Now()
+		export, err := loadExport(path)
+		if err != nil {
+			return nil, Data{}, err
+		}
+		slog.Info("Loaded export", "path", path, "kind", export.Kind, "duration", time.Since(start))
+		exports = append(exports, export)
+	}
+	return exports, mergeData(exports), nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoadExportDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := exportData(context.Background(), HealthData{Data: testHealthData()}, exportSource{}, dir); err != nil {
+		t.Fatalf("exportData() error = %v", err)
+	}
+
+	export, err := loadExport(dir)
+	if err != nil {
+		t.Fatalf("loadExport() error = %v", err)
+	}
+	if export.Kind != exportKindDir || export.Manifest == nil {
+		t.Fatalf("loadExport() kind = %v, manifest = %v, want export with manifest", export.Kind, export.Manifest)
+	}
+
+	data := export.Data
+	if len(data.Workouts) != 3 || len(data.Metrics) != 2 || len(data.StateOfMind) != 2 {
+		t.Fatalf("loaded %d workouts, %d metrics, %d state of mind, want 3, 2, 2",
+			len(data.Workouts), len(data.Metrics), len(data.StateOfMind))
+	}
+
+	// Detail series are read back from workout_details/
+	idx := newHealthIndex(data)
+	workout, summary, ok := idx.workout("W1")
+	if !ok {
+		t.Fatal("workout W1 not loaded")
+	}
+	if len(workout.HeartRateData) != 1 || summary.HeartRateStats == nil || summary.HeartRateStats.Avg != 100 {
+		t.Errorf("W1 heart rate = %+v, stats = %+v, want 1 record with avg 100", workout.HeartRateData, summary.HeartRateStats)
+	}
+
+	want := newHealthIndex(testHealthData())
+	got, _ := idx.metricSeries("step_count", timeRange{}, bucketDay)
+	wantSeries, _ := want.metricSeries("step_count", timeRange{}, bucketDay)
+	if len(got.Points) != len(wantSeries.Points) || got.Points[0].Sum != wantSeries.Points[0].Sum {
+		t.Errorf("step_count series = %+v, want %+v", got.Points, wantSeries.Points)
+	}
+}
+
+func TestMergeData(t *testing.T) {
+	est := time.FixedZone("EST", -5*3600)
+	first := testHealthData()
+	second := Data{
+		Workouts:    []Workout{first.Workouts[0], {ID: "W4", Name: "Swimming", Start: time.Date(2025, 11, 20, 7, 0, 0, 0, est)}},
+		StateOfMind: []StateOfMind{first.StateOfMind[0]},
+		Metrics: []Metric{{
+			Name:  "step_count",
+			Units: "count",
+			Data: []MetricRecord{
+				first.Metrics[0].Data[0],
+				{Date: time.Date(2025, 11, 9, 8, 0, 0, 0, est), Qty: 42},
+			},
+		}},
+	}
+
+	merged := mergeData([]*LoadedExport{{Data: first}, {Data: second}})
+
+	if len(merged.Workouts) != 4 {
+		t.Errorf("merged %d workouts, want 4", len(merged.Workouts))
+	}
+	if len(merged.StateOfMind) != 2 {
+		t.Errorf("merged %d state of mind entries, want 2", len(merged.StateOfMind))
+	}
+	if len(merged.Metrics) != 2 {
+		t.Fatalf("merged %d metrics, want 2", len(merged.Metrics))
+	}
+	steps := merged.Metrics[0].Data
+	if len(steps) != 5 {
+		t.Fatalf("merged %d step records, want 5", len(steps))
+	}
+	if steps[0].Qty != 42 {
+		t.Errorf("first step record = %v, want records sorted by date", steps[0])
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Extras holds the JSON fields of a record that its struct has no field for.
+// They are kept when an export is read and written back out with the record,
+// so exported files carry everything the source did.
+type Extras map[string]json.RawMessage
+
+// JSON field names of the records that keep extras.
+var (
+	metricFieldNames         = jsonFieldNames(reflect.TypeOf(Metric{}))
+	metricRecordFieldNames   = jsonFieldNames(reflect.TypeOf(MetricRecord{}))
+	stateOfMindFieldNames    = jsonFieldNames(reflect.TypeOf(StateOfMind{}))
+	workoutFieldNames        = jsonFieldNames(reflect.TypeOf(Workout{}))
+	energyRecordFieldNames   = jsonFieldNames(reflect.TypeOf(EnergyRecord{}))
+	heartRateDataFieldNames  = jsonFieldNames(reflect.TypeOf(HeartRateData{}))
+	stepRecordFieldNames     = jsonFieldNames(reflect.TypeOf(StepRecord{}))
+	distanceRecordFieldNames = jsonFieldNames(reflect.TypeOf(DistanceRecord{}))
+)
+
+// jsonFieldNames returns the lower-cased JSON names of a struct's fields, plus
+// extra names. encoding/json matches names case-insensitively.
+func jsonFieldNames(t reflect.Type, extra ...string) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	for _, name := range extra {
+		names[strings.ToLower(name)] = true
+	}
+	return names
+}
+
+// ignoredValue skips a JSON value without copying it.
+type ignoredValue struct{}
+
+func (*ignoredValue) UnmarshalJSON([]byte) error { return nil }
+
+// decodeExtras returns the fields of the JSON object data that are not in
+// known, or nil if there are none.
+func decodeExtras(data []byte, known map[string]bool) (Extras, error) {
+	// Most records have no extras, so find the keys before copying any values
+	var keys map[string]ignoredValue
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	unknown := false
+	for key := range keys {
+		if !known[strings.ToLower(key)] {
+			unknown = true
+			break
+		}
+	}
+	if !unknown {
+		return nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return extrasOf(fields, known), nil
+}
+
+// extrasOf returns the fields that are not in known, or nil if there are none.
+func extrasOf(fields map[string]json.RawMessage, known map[string]bool) Extras {
+	var extras Extras
+	for key, value := range fields {
+		if known[strings.ToLower(key)] {
+			continue
+		}
+		if extras == nil {
+			extras = make(Extras)
+		}
+		extras[key] = value
+	}
+	return extras
+}
+
+// appendExtras adds extras to the JSON object encoded in object, in key order.
+// Keys the object already has are left alone.
+func appendExtras(object []byte, extras Extras) ([]byte, error) {
+	if len(extras) == 0 {
+		return object, nil
+	}
+
+	var existing map[string]ignoredValue
+	if err := json.Unmarshal(object, &existing); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(extras))
+	for key := range extras {
+		if _, ok := existing[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	b.Write(bytes.TrimSuffix(bytes.TrimSpace(object), []byte("}")))
+	for i, key := range keys {
+		if i > 0 || len(existing) > 0 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(extras[key])
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// marshalWithExtras encodes v, a record converted to a type without a
+// MarshalJSON method, followed by its extras.
+func marshalWithExtras(v interface{}, extras Extras) ([]byte, error) {
+	object, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendExtras(object, extras)
+}
+
+// mergeExtras adds the fields of extras to into and returns it. Fields both
+// have are concatenated when both values are arrays, such as a data category
+// split across exports, and otherwise keep the value in into.
+func mergeExtras(into, extras Extras) Extras {
+	for key, value := range extras {
+		existing, ok := into[key]
+		if !ok {
+			if into == nil {
+				into = make(Extras)
+			}
+			into[key] = value
+			continue
+		}
+
+		var first, second []json.RawMessage
+		if json.Unmarshal(existing, &first) != nil || json.Unmarshal(value, &second) != nil {
+			continue
+		}
+		if merged, err := json.Marshal(append(first, second...)); err == nil {
+			into[key] = merged
+		}
+	}
+	return into
+}
+
+// countExtras counts, by record type and field, the records of healthData
+// carrying extras, such as "workouts.cadence" or "metrics.data.Avg". Unknown
+// data categories count as "data.<key>" and unknown top-level fields by name.
+func countExtras(healthData HealthData) map[string]int {
+	counts := make(map[string]int)
+	add := func(location string, extras Extras) {
+		for key := range extras {
+			counts[location+"."+key]++
+		}
+	}
+
+	data := healthData.Data
+	for key := range healthData.Extras {
+		counts[key]++
+	}
+	add("data", data.Extras)
+
+	for _, metric := range data.Metrics {
+		add("metrics", metric.Extras)
+		for _, record := range metric.Data {
+			add("metrics.data", record.Extras)
+		}
+	}
+	for _, workout := range data.Workouts {
+		add("workouts", workout.Extras)
+		for _, record := range workout.ActiveEnergy {
+			add("workouts.activeEnergy", record.Extras)
+		}
+		for _, record := range workout.HeartRateData {
+			add("workouts.heartRateData", record.Extras)
+		}
+		for _, record := range workout.HeartRateRecovery {
+			add("workouts.heartRateRecovery", record.Extras)
+		}
+		for _, record := range workout.StepCount {
+			add("workouts.stepCount", record.Extras)
+		}
+		for _, record := range workout.WalkingAndRunningDistance {
+			add("workouts.walkingAndRunningDistance", record.Extras)
+		}
+	}
+	for _, som := range data.StateOfMind {
+		add("stateOfMind", som.Extras)
+	}
+
+	if len(counts) == 0 {
+		return nil
+	}
+	return counts
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAppendExtras(t *testing.T) {
+	tests := []struct {
+		name   string
+		object string
+		extras Extras
+		want   string
+	}{
+		{"no extras", `{"a":1}`, nil, `{"a":1}`},
+		{"sorted", `{"a":1}`, Extras{"c": json.RawMessage(`3`), "b": json.RawMessage(`"x"`)}, `{"a":1,"b":"x","c":3}`},
+		{"empty object", `{}`, Extras{"b": json.RawMessage(`[1]`)}, `{"b":[1]}`},
+		{"existing key kept", `{"a":1}`, Extras{"a": json.RawMessage(`2`)}, `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := appendExtras([]byte(tt.object), tt.extras)
+			if err != nil {
+				t.Fatalf("appendExtras() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("appendExtras() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtrasRoundTrip(t *testing.T) {
+	input := `{"data": {
+		"workouts": [{
+			"id": "W1",
+			"name": "Walking",
+			"start": "2025-11-10 07:00:00 -0500",
+			"end": "2025-11-10 07:30:00 -0500",
+			"cadence": {"qty": 110, "units": "spm"},
+			"heartRateData": [{"date": "2025-11-10 07:05:00 -0500", "Avg": 98, "context": "active"}]
+		}],
+		"metrics": [{
+			"name": "heart_rate",
+			"units": "count/min",
+			"aggregation": "hour",
+			"data": [{"date": "2025-11-10 08:00:00 -0500", "Min": 55, "Avg": 62, "Max": 70}]
+		}],
+		"stateOfMind": [{"id": "S1", "start": "2025-11-10T12:00:00Z", "end": "2025-11-10T12:00:00Z", "valence": 0.5, "mood": "calm"}]
+	}}`
+
+	healthData, err := decodeHealthAutoExportJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("decodeHealthAutoExportJSON() error = %v", err)
+	}
+	dir := t.TempDir()
+	if err := exportData(context.Background(), healthData, exportSource{}, dir); err != nil {
+		t.Fatalf("exportData() error = %v", err)
+	}
+
+	manifest, data, err := loadExportDir(dir)
+	if err != nil {
+		t.Fatalf("loadExportDir() error = %v", err)
+	}
+	wantCounts := map[string]int{
+		"workouts.cadence":               1,
+		"workouts.heartRateData.context": 1,
+		"metrics.aggregation":            1,
+		"metrics.data.Min":               1,
+		"metrics.data.Avg":               1,
+		"metrics.data.Max":               1,
+		"stateOfMind.mood":               1,
+	}
+	if !reflect.DeepEqual(manifest.Extras, wantCounts) {
+		t.Errorf("manifest extras = %v, want %v", manifest.Extras, wantCounts)
+	}
+	if got := countExtras(HealthData{Data: data}); !reflect.DeepEqual(got, wantCounts) {
+		t.Errorf("reloaded extras = %v, want %v", got, wantCounts)
+	}
+
+	metricFile, err := os.ReadFile(filepath.Join(dir, manifest.Metrics[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"aggregation": "hour"`, `"Avg": 62`, `"Max": 70`} {
+		if !strings.Contains(string(metricFile), want) {
+			t.Errorf("metric file lacks %s:\n%s", want, metricFile)
+		}
+	}
+	if qty := data.Metrics[0].Data[0].Qty; qty != 62 {
+		t.Errorf("heart rate qty = %v, want 62", qty)
+	}
+	var cadence bytes.Buffer
+	if err := json.Compact(&cadence, data.Workouts[0].Extras["cadence"]); err != nil || cadence.String() != `{"qty":110,"units":"spm"}` {
+		t.Errorf("workout cadence = %s", data.Workouts[0].Extras["cadence"])
+	}
+}
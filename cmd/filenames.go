@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileTimestampLayout is the layout of the timestamp that starts export file
+// names.
+const fileTimestampLayout = "2006-01-02_15-04-05"
+
+// shortIDLength is the number of characters of a record ID used in file names.
+const shortIDLength = 8
+
+// fileNamer hands out export file names, adding a numeric suffix to a name
+// that is already taken so that records never overwrite each other. Names
+// are compared case-insensitively, as on macOS and Windows file systems.
+// Handing out names in record order keeps them deterministic.
+type fileNamer struct {
+	used map[string]bool
+}
+
+func newFileNamer() *fileNamer {
+	return &fileNamer{used: make(map[string]bool)}
+}
+
+// name returns base, or the first of base_2, base_3, ... not yet handed out
+// in dir.
+func (n *fileNamer) name(dir, base string) string {
+	name := base
+	for i := 2; n.used[strings.ToLower(dir+"/"+name)]; i++ {
+		name = base + "_" + strconv.Itoa(i)
+	}
+	n.used[strings.ToLower(dir+"/"+name)] = true
+	return name
+}
+
+// shortID returns the last shortIDLength letters and digits of id, lower
+// cased, as the end of UUIDs and hashed IDs varies the most. A record without
+// an ID is identified by a hash of its content instead.
+func shortID(id string, record interface{}) string {
+	var b strings.Builder
+	for _, r := range id {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	short := strings.ToLower(b.String())
+	if short == "" {
+		return contentHash(record)[:shortIDLength]
+	}
+	if len(short) > shortIDLength {
+		short = short[len(short)-shortIDLength:]
+	}
+	return short
+}
+
+// recordFileBase returns the file name, without extension, of a record: its
+// timestamp, name and short ID. A zero timestamp is left out.
+func recordFileBase(t time.Time, name, id string) string {
+	parts := make([]string, 0, 3)
+	if !t.IsZero() {
+		parts = append(parts, t.Format(fileTimestampLayout))
+	}
+	if name = sanitizeFilename(name); name != "" {
+		parts = append(parts, name)
+	}
+	parts = append(parts, id)
+	return strings.Join(parts, "_")
+}
+
+// recordTime returns the start or date of an untyped record, such as an ECG
+// or a symptom, or the zero time if it has neither.
+func recordTime(record interface{}) time.Time {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return time.Time{}
+	}
+	var fields struct {
+		Start string `json:"start"`
+		Date  string `json:"date"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return time.Time{}
+	}
+	for _, s := range []string{fields.Start, fields.Date} {
+		if t, err := parseDate(s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// exportTime returns the time recorded as the generation time of an export:
+// now, or the time in SOURCE_DATE_EPOCH when it is set, so that an export of
+// the same input can be reproduced byte for byte.
+func exportTime() time.Time {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now()
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		slog.Warn("Ignoring invalid SOURCE_DATE_EPOCH", "value", epoch)
+		return time.Now()
+	}
+	return time.Unix(seconds, 0).UTC()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileNamer(t *testing.T) {
+	namer := newFileNamer()
+	got := []string{
+		namer.name("workouts", "a"),
+		namer.name("workouts", "A"),
+		namer.name("workouts", "a"),
+		namer.name("metrics", "a"),
+	}
+	want := []string{"a", "A_2", "a_3", "a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+}
+
+func TestShortID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"W1", "w1"},
+		{"5F3A9C2E-1B7D-4E0A-9C3B-0D2E4F6A8B1C", "4f6a8b1c"},
+		{"apple-0123456789abcdef", "89abcdef"},
+	}
+	for _, tt := range tests {
+		if got := shortID(tt.id, nil); got != tt.want {
+			t.Errorf("shortID(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+
+	a, b := shortID("", Workout{Name: "Walk"}), shortID("", Workout{Name: "Run"})
+	if len(a) != shortIDLength || a == b {
+		t.Errorf("shortID() of records without IDs = %q, %q; want distinct %d character hashes", a, b, shortIDLength)
+	}
+}
+
+func TestExportDataFileNames(t *testing.T) {
+	start := time.Date(2025, 11, 10, 7, 0, 0, 0, time.UTC)
+	data := Data{
+		Workouts: []Workout{
+			{Name: "Outdoor Walk", Start: start, End: start.Add(time.Hour), Duration: 3600},
+			{Name: "Outdoor Walk", Start: start, End: start.Add(time.Hour), Duration: 1800},
+			{ID: "W1", Name: "Outdoor Walk", Start: start, End: start.Add(time.Hour)},
+			{ID: "w1", Name: "Outdoor Walk", Start: start, End: start.Add(time.Hour)},
+		},
+		StateOfMind: []StateOfMind{
+			{ID: "S1", Kind: "momentary_emotion", Start: start, End: start},
+			{ID: "S2", Kind: "momentary_emotion", Start: start, End: start},
+		},
+		Symptoms: []interface{}{
+			map[string]interface{}{"name": "Headache", "start": "2025-11-10 07:00:00 +0000"},
+			map[string]interface{}{"name": "Nausea"},
+		},
+	}
+
+	dir := t.TempDir()
+	if err := exportData(context.Background(), HealthData{Data: data}, exportSource{}, dir); err != nil {
+		t.Fatalf("exportData() error = %v", err)
+	}
+	manifest, _, err := loadExportDir(dir)
+	if err != nil {
+		t.Fatalf("loadExportDir() error = %v", err)
+	}
+
+	if len(manifest.Workouts) != 4 {
+		t.Fatalf("exported %d workouts, want 4: %v", len(manifest.Workouts), manifest.Workouts)
+	}
+	wantWorkouts := []string{
+		"workouts/2025-11-10_07-00-00_Outdoor_Walk_" + shortID("", data.Workouts[0]) + "_summary.json",
+		"workouts/2025-11-10_07-00-00_Outdoor_Walk_" + shortID("", data.Workouts[1]) + "_summary.json",
+		"workouts/2025-11-10_07-00-00_Outdoor_Walk_w1_summary.json",
+		"workouts/2025-11-10_07-00-00_Outdoor_Walk_w1_2_summary.json",
+	}
+	if !reflect.DeepEqual(manifest.Workouts, wantWorkouts) {
+		t.Errorf("workout files = %v, want %v", manifest.Workouts, wantWorkouts)
+	}
+	wantMoods := []string{
+		"state_of_mind/2025-11-10_07-00-00_momentary_emotion_s1.json",
+		"state_of_mind/2025-11-10_07-00-00_momentary_emotion_s2.json",
+	}
+	if !reflect.DeepEqual(manifest.StateOfMind, wantMoods) {
+		t.Errorf("state of mind files = %v, want %v", manifest.StateOfMind, wantMoods)
+	}
+
+	symptoms, _ := filepath.Glob(filepath.Join(dir, "symptoms", "*.json"))
+	wantSymptoms := []string{
+		filepath.Join(dir, "symptoms", "2025-11-10_07-00-00_symptoms_"+contentHash(data.Symptoms[0])[:shortIDLength]+".json"),
+		filepath.Join(dir, "symptoms", "symptoms_"+contentHash(data.Symptoms[1])[:shortIDLength]+".json"),
+	}
+	if !reflect.DeepEqual(symptoms, wantSymptoms) {
+		t.Errorf("symptom files = %v, want %v", symptoms, wantSymptoms)
+	}
+}
+
+func TestExportDataReproducible(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1762732800")
+	previous := exportWorkers
+	defer func() { exportWorkers = previous }()
+
+	var exports []map[string]string
+	for _, workers := range []int{1, 8} {
+		exportWorkers = workers
+		dir := t.TempDir()
+		if err := exportData(context.Background(), HealthData{Data: testHealthData()}, exportSource{}, dir); err != nil {
+			t.Fatalf("exportData() error = %v", err)
+		}
+		files := make(map[string]string)
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			content, err := os.ReadFile(path)
+			rel, _ := filepath.Rel(dir, path)
+			files[rel] = string(content)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		exports = append(exports, files)
+	}
+
+	if len(exports[0]) == 0 || !reflect.DeepEqual(exports[0], exports[1]) {
+		t.Error("exports of the same data differ")
+		for name, content := range exports[0] {
+			if exports[1][name] != content {
+				t.Logf("differs: %s", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,640 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/cobra"
+)
+
+// haeDateLayout is the timestamp layout of Health Auto Export JSON.
+const haeDateLayout = "2006-01-02 15:04:05 -0700"
+
+// Source names of generated records.
+const (
+	generatedWatch = "Synthetic Watch"
+	generatedPhone = "Synthetic iPhone"
+)
+
+// maxWorkoutsPerDay keeps the workouts of a day from overlapping.
+const maxWorkoutsPerDay = 8
+
+var (
+	generateOutput         string
+	generateSeed           int64
+	generateStart          string
+	generateDays           int
+	generateTimezone       string
+	generateMetrics        []string
+	generateWorkoutTypes   []string
+	generateWorkoutsPerDay float64
+	generateMoodsPerDay    int
+	generateRoutes         bool
+)
+
+// generateCmd writes a synthetic Health Auto Export JSON export
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Write a synthetic health export for testing and benchmarks",
+	Long: `Write a synthetic export in the Health Auto Export JSON format, for testing
+and benchmarking the pipeline without real personal data.
+
+The export covers --days days from --start, with hourly and daily metrics,
+workouts with minute-by-minute heart rate, energy, step and distance series,
+heart rate recovery and GPS routes, and state of mind entries. The same seed
+and options always produce the same export, and each kind of data has its
+own random stream, so that changing the metrics does not change the workouts.
+
+The export is written to standard output, or to --output, compressed with
+gzip or zstd when the file name ends in .gz or .zst.`,
+	Example: `  # A year of data for benchmarks
+  apple-health-export-parser generate --days 365 --output synthetic.json.gz
+
+  # A week of runs only, processed directly
+  apple-health-export-parser generate --days 7 --workout-types "Outdoor Run" --metrics heart_rate,step_count | \
+    apple-health-export-parser process --source -`,
+	Args: cobra.NoArgs,
+	RunE: runGenerate,
+}
+
+func init() {
+	rootCmd.AddCommand(generateCmd)
+
+	generateCmd.Flags().StringVarP(&generateOutput, "output", "o", stdinSource, "file to write the export to, - for standard output")
+	generateCmd.Flags().Int64Var(&generateSeed, "seed", 1, "random seed")
+	generateCmd.Flags().StringVar(&generateStart, "start", "2025-01-06", "first day (YYYY-MM-DD)")
+	generateCmd.Flags().IntVar(&generateDays, "days", 7, "number of days")
+	generateCmd.Flags().StringVar(&generateTimezone, "timezone", "UTC", "IANA time zone of the timestamps")
+	generateCmd.Flags().StringSliceVar(&generateMetrics, "metrics", metricGeneratorNames(), "metrics to generate")
+	generateCmd.Flags().StringSliceVar(&generateWorkoutTypes, "workout-types", workoutProfileNames(), "workout types to choose from")
+	generateCmd.Flags().Float64Var(&generateWorkoutsPerDay, "workouts-per-day", 1, fmt.Sprintf("average number of workouts a day (at most %d)", maxWorkoutsPerDay))
+	generateCmd.Flags().IntVar(&generateMoodsPerDay, "moods-per-day", 2, "state of mind entries a day; the last of each day is a daily mood")
+	generateCmd.Flags().BoolVar(&generateRoutes, "routes", true, "add GPS routes to outdoor workouts")
+}
+
+// GenerateOptions configures a synthetic export.
+type GenerateOptions struct {
+	Seed           int64
+	Start          time.Time // Midnight of the first day, in the time zone of the timestamps
+	Days           int
+	Metrics        []string
+	WorkoutTypes   []string
+	WorkoutsPerDay float64
+	MoodsPerDay    int
+	Routes         bool
+}
+
+// runGenerate executes the generate command
+func runGenerate(cmd *cobra.Command, args []string) error {
+	location, err := time.LoadLocation(generateTimezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+	start, err := time.ParseInLocation("2006-01-02", generateStart, location)
+	if err != nil {
+		return fmt.Errorf("invalid start date: %s (expected YYYY-MM-DD)", generateStart)
+	}
+
+	export, err := generateExport(GenerateOptions{
+		Seed:           generateSeed,
+		Start:          start,
+		Days:           generateDays,
+		Metrics:        generateMetrics,
+		WorkoutTypes:   generateWorkoutTypes,
+		WorkoutsPerDay: generateWorkoutsPerDay,
+		MoodsPerDay:    generateMoodsPerDay,
+		Routes:         generateRoutes,
+	})
+	if err != nil {
+		return err
+	}
+
+	if generateOutput == stdinSource {
+		return writeGeneratedExport(cmd.OutOrStdout(), export, "")
+	}
+	file, err := os.Create(generateOutput)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	if err := writeGeneratedExport(file, export, filepath.Ext(generateOutput)); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeGeneratedExport writes an export as compact JSON, compressed according
+// to ext (".gz", ".zst", or anything else for none).
+func writeGeneratedExport(w io.Writer, export interface{}, ext string) error {
+	var compressor io.WriteCloser
+	switch ext {
+	case ".gz":
+		compressor = gzip.NewWriter(w)
+	case ".zst":
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return fmt.Errorf("creating zstd writer: %w", err)
+		}
+		compressor = zw
+	}
+	if compressor != nil {
+		w = compressor
+	}
+
+	if err := json.NewEncoder(w).Encode(export); err != nil {
+		return fmt.Errorf("writing export: %w", err)
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return fmt.Errorf("writing export: %w", err)
+		}
+	}
+	return nil
+}
+
+// record is a generated JSON object; keys are written in sorted order.
+type record = map[string]interface{}
+
+// generator holds the options of an export being generated.
+type generator struct {
+	opts GenerateOptions
+}
+
+// generateExport builds a synthetic Health Auto Export JSON export, ready to
+// be encoded.
+func generateExport(opts GenerateOptions) (record, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	g := &generator{opts: opts}
+
+	metrics := make([]record, 0, len(opts.Metrics))
+	for _, name := range opts.Metrics {
+		m := metricGenerators[name]
+		rng := g.stream("metric/" + name)
+		var state float64
+		if m.init != nil {
+			state = m.init(rng)
+		}
+		var data []record
+		for day := 0; day < opts.Days; day++ {
+			data = append(data, m.generate(rng, g.day(day), &state)...)
+		}
+		metrics = append(metrics, record{"name": name, "units": m.units, "data": nonNil(data)})
+	}
+
+	return record{"data": record{
+		"metrics":                metrics,
+		"workouts":               nonNil(g.workouts()),
+		"stateOfMind":            nonNil(g.moods()),
+		"ecg":                    []record{},
+		"heartRateNotifications": []record{},
+		"symptoms":               []record{},
+	}}, nil
+}
+
+// validate checks the options.
+func (o GenerateOptions) validate() error {
+	if o.Days < 1 {
+		return fmt.Errorf("invalid days: %d (must be at least 1)", o.Days)
+	}
+	if o.WorkoutsPerDay < 0 || o.WorkoutsPerDay > maxWorkoutsPerDay {
+		return fmt.Errorf("invalid workouts per day: %v (must be between 0 and %d)", o.WorkoutsPerDay, maxWorkoutsPerDay)
+	}
+	if o.WorkoutsPerDay > 0 && len(o.WorkoutTypes) == 0 {
+		return fmt.Errorf("no workout types to generate workouts from")
+	}
+	if o.MoodsPerDay < 0 {
+		return fmt.Errorf("invalid moods per day: %d (must not be negative)", o.MoodsPerDay)
+	}
+	for _, name := range o.Metrics {
+		if _, ok := metricGenerators[name]; !ok {
+			return fmt.Errorf("unknown metric: %s (valid: %s)", name, strings.Join(metricGeneratorNames(), ", "))
+		}
+	}
+	for _, name := range o.WorkoutTypes {
+		if _, ok := workoutProfiles[name]; !ok {
+			return fmt.Errorf("unknown workout type: %s (valid: %s)", name, strings.Join(workoutProfileNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// stream returns the random stream of one kind of data, so that each kind
+// depends only on the seed and its own options.
+func (g *generator) stream(name string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return rand.New(rand.NewPCG(uint64(g.opts.Seed), h.Sum64()))
+}
+
+// day returns midnight of the nth day.
+func (g *generator) day(n int) time.Time {
+	return g.opts.Start.AddDate(0, 0, n)
+}
+
+// metricGenerator generates the records of one metric, a day at a time.
+type metricGenerator struct {
+	units    string
+	init     func(rng *rand.Rand) float64 // Initial state carried from day to day, if any
+	generate func(rng *rand.Rand, day time.Time, state *float64) []record
+}
+
+// metricGenerators are the metrics generate can produce.
+var metricGenerators = map[string]metricGenerator{
+	"step_count": {units: "count", generate: hourly(7, 22, func(rng *rand.Rand, hour int) record {
+		return record{"qty": math.Round(diurnal(hour) * (300 + rng.Float64()*900)), "source": generatedPhone}
+	})},
+	"active_energy": {units: "kcal", generate: hourly(7, 22, func(rng *rand.Rand, hour int) record {
+		return record{"qty": roundTo(diurnal(hour)*(10+rng.Float64()*30), 3), "source": generatedWatch}
+	})},
+	"walking_running_distance": {units: "km", generate: hourly(7, 22, func(rng *rand.Rand, hour int) record {
+		return record{"qty": roundTo(diurnal(hour)*(0.2+rng.Float64()*0.7), 3), "source": generatedPhone}
+	})},
+	"heart_rate": {units: "count/min", generate: hourly(0, 23, func(rng *rand.Rand, hour int) record {
+		avg := 66 + 16*diurnal(hour) + rng.Float64()*6
+		if hour < 7 || hour >= 23 {
+			avg = 54 + rng.Float64()*6
+		}
+		return record{
+			"Min":    math.Round(avg - 4 - rng.Float64()*6),
+			"Avg":    roundTo(avg, 1),
+			"Max":    math.Round(avg + 8 + rng.Float64()*30),
+			"source": generatedWatch,
+		}
+	})},
+	"resting_heart_rate": {units: "count/min", generate: daily(8, func(rng *rand.Rand) float64 {
+		return math.Round(56 + rng.Float64()*6)
+	})},
+	"heart_rate_variability": {units: "ms", generate: daily(6, func(rng *rand.Rand) float64 {
+		return roundTo(35+rng.Float64()*25, 1)
+	})},
+	"weight_body_mass": {
+		units: "kg",
+		init:  func(rng *rand.Rand) float64 { return 65 + rng.Float64()*20 },
+		generate: func(rng *rand.Rand, day time.Time, weight *float64) []record {
+			*weight += (rng.Float64() - 0.5) * 0.4
+			return []record{{"date": haeDate(day.Add(7 * time.Hour)), "qty": roundTo(*weight, 1), "source": generatedPhone}}
+		},
+	},
+	"sleep_analysis": {units: "hr", generate: generateSleep},
+}
+
+// metricGeneratorNames returns the names of the metrics generate can produce.
+func metricGeneratorNames() []string {
+	names := make([]string, 0, len(metricGenerators))
+	for name := range metricGenerators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hourly generates a record on the hour from the first to the last hour of a
+// day.
+func hourly(first, last int, value func(rng *rand.Rand, hour int) record) func(*rand.Rand, time.Time, *float64) []record {
+	return func(rng *rand.Rand, day time.Time, _ *float64) []record {
+		records := make([]record, 0, last-first+1)
+		for hour := first; hour <= last; hour++ {
+			r := value(rng, hour)
+			r["date"] = haeDate(day.Add(time.Duration(hour) * time.Hour))
+			records = append(records, r)
+		}
+		return records
+	}
+}
+
+// daily generates one record a day at the given hour.
+func daily(hour int, qty func(rng *rand.Rand) float64) func(*rand.Rand, time.Time, *float64) []record {
+	return func(rng *rand.Rand, day time.Time, _ *float64) []record {
+		return []record{{
+			"date":   haeDate(day.Add(time.Duration(hour) * time.Hour)),
+			"qty":    qty(rng),
+			"source": generatedWatch,
+		}}
+	}
+}
+
+// generateSleep generates the night ending on a day, split into sleep stages
+// as Health Auto Export aggregates them.
+func generateSleep(rng *rand.Rand, day time.Time, _ *float64) []record {
+	inBedStart := day.Add(-90*time.Minute + jitter(rng, time.Hour))
+	sleepStart := inBedStart.Add(10*time.Minute + jitter(rng, 15*time.Minute))
+	sleepEnd := day.Add(6*time.Hour + 30*time.Minute + jitter(rng, time.Hour))
+	inBedEnd := sleepEnd.Add(5*time.Minute + jitter(rng, 10*time.Minute))
+
+	hours := sleepEnd.Sub(sleepStart).Hours()
+	awake := hours * (0.03 + rng.Float64()*0.04)
+	deep := hours * (0.12 + rng.Float64()*0.06)
+	rem := hours * (0.18 + rng.Float64()*0.06)
+	core := hours - awake - deep - rem
+	return []record{{
+		"date":       haeDate(day),
+		"totalSleep": roundTo(core+deep+rem, 3),
+		"asleep":     0,
+		"core":       roundTo(core, 3),
+		"deep":       roundTo(deep, 3),
+		"rem":        roundTo(rem, 3),
+		"awake":      roundTo(awake, 3),
+		"inBed":      roundTo(inBedEnd.Sub(inBedStart).Hours(), 3),
+		"sleepStart": haeDate(sleepStart),
+		"sleepEnd":   haeDate(sleepEnd),
+		"inBedStart": haeDate(inBedStart),
+		"inBedEnd":   haeDate(inBedEnd),
+		"source":     generatedWatch,
+	}}
+}
+
+// workoutProfile describes how a workout type is generated.
+type workoutProfile struct {
+	outdoor    bool
+	speed      float64 // Meters per second, 0 for stationary workouts
+	cadence    float64 // Steps per minute, 0 for workouts without steps
+	heartRate  float64 // Beats per minute at steady effort
+	kcalPerMin float64 // Active energy per minute at steady effort
+	climb      float64 // Meters of elevation gained per kilometer
+}
+
+// workoutProfiles are the workout types generate can produce.
+var workoutProfiles = map[string]workoutProfile{
+	"Outdoor Walk":                  {outdoor: true, speed: 1.4, cadence: 110, heartRate: 105, kcalPerMin: 4.5, climb: 5},
+	"Outdoor Run":                   {outdoor: true, speed: 2.9, cadence: 165, heartRate: 150, kcalPerMin: 11, climb: 8},
+	"Outdoor Cycling":               {outdoor: true, speed: 6.5, heartRate: 135, kcalPerMin: 9, climb: 6},
+	"Hiking":                        {outdoor: true, speed: 1.1, cadence: 100, heartRate: 120, kcalPerMin: 7, climb: 60},
+	"Indoor Cycling":                {heartRate: 130, kcalPerMin: 8},
+	"Traditional Strength Training": {heartRate: 115, kcalPerMin: 6},
+	"Yoga":                          {heartRate: 95, kcalPerMin: 3.5},
+}
+
+// workoutProfileNames returns the workout types generate can produce.
+func workoutProfileNames() []string {
+	names := make([]string, 0, len(workoutProfiles))
+	for name := range workoutProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// workouts generates the workouts of every day, spread over the day so that
+// they never overlap.
+func (g *generator) workouts() []record {
+	rng := g.stream("workouts")
+	// Routes start and end near a home chosen by the seed
+	homeLat, homeLon := -45+rng.Float64()*100, -180+rng.Float64()*360
+
+	var workouts []record
+	for day := 0; day < g.opts.Days; day++ {
+		count := int(g.opts.WorkoutsPerDay)
+		if rng.Float64() < g.opts.WorkoutsPerDay-float64(count) {
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+		slot := 16 * time.Hour / time.Duration(count)
+		for i := 0; i < count; i++ {
+			name := g.opts.WorkoutTypes[rng.IntN(len(g.opts.WorkoutTypes))]
+			start := g.day(day).Add(6*time.Hour + time.Duration(i)*slot + jitter(rng, slot/4)).Truncate(time.Second)
+			minutes := 20 + rng.IntN(int(min(75*time.Minute, slot/2)/time.Minute)-19)
+			workouts = append(workouts, generateWorkout(rng, name, start, minutes, g.opts.Routes, homeLat, homeLon))
+		}
+	}
+	return workouts
+}
+
+// generateWorkout generates a workout with minute-by-minute series.
+func generateWorkout(rng *rand.Rand, name string, start time.Time, minutes int, routes bool, homeLat, homeLon float64) record {
+	p := workoutProfiles[name]
+	end := start.Add(time.Duration(minutes) * time.Minute)
+	resting := 60 + rng.Float64()*8
+	target := p.heartRate * (0.92 + rng.Float64()*0.16)
+	period := 6 + rng.Float64()*6
+
+	var heartRate, energy, steps, distances []record
+	var totalEnergy, totalKm, bpm float64
+	for m := 0; m < minutes; m++ {
+		at := haeDate(start.Add(time.Duration(m) * time.Minute))
+		// Warm up towards the target, then vary around it
+		bpm = resting + (target-resting)*(1-math.Exp(-float64(m)/3)) + 4*math.Sin(2*math.Pi*float64(m)/period) + rng.NormFloat64()*2
+		heartRate = append(heartRate, record{
+			"date": at, "Min": math.Round(bpm - 2 - rng.Float64()*4), "Avg": roundTo(bpm, 1), "Max": math.Round(bpm + 2 + rng.Float64()*6),
+			"source": generatedWatch, "units": "count/min",
+		})
+
+		kcal := roundTo(p.kcalPerMin*bpm/target*(0.9+rng.Float64()*0.2), 3)
+		totalEnergy += kcal
+		energy = append(energy, record{"date": at, "qty": kcal, "source": generatedWatch, "units": "kcal"})
+
+		if p.cadence > 0 {
+			steps = append(steps, record{"date": at, "qty": math.Round(p.cadence * (0.9 + rng.Float64()*0.2)), "source": generatedWatch, "units": "count"})
+		}
+		if p.speed > 0 {
+			km := roundTo(p.speed*60/1000*(0.9+rng.Float64()*0.2), 3)
+			totalKm += km
+			if p.cadence > 0 {
+				distances = append(distances, record{"date": at, "qty": km, "source": generatedWatch, "units": "km"})
+			}
+		}
+	}
+
+	// Recover from the last minute's heart rate towards resting
+	recovery := make([]record, 0, 5)
+	for m := 1; m <= 5; m++ {
+		avg := resting + (bpm-resting)*math.Exp(-float64(m)/1.5)
+		recovery = append(recovery, record{
+			"date": haeDate(end.Add(time.Duration(m) * time.Minute)), "Min": math.Round(avg - 2), "Avg": roundTo(avg, 1), "Max": math.Round(avg + 2),
+			"source": generatedWatch, "units": "count/min",
+		})
+	}
+
+	workout := record{
+		"id":                 newGeneratedID(rng),
+		"name":               name,
+		"start":              haeDate(start),
+		"end":                haeDate(end),
+		"duration":           float64(minutes * 60),
+		"activeEnergyBurned": record{"qty": roundTo(totalEnergy, 3), "units": "kcal"},
+		"intensity":          record{"qty": roundTo(p.kcalPerMin*60/70, 1), "units": "kcal/hr·kg"},
+		"heartRateData":      heartRate,
+		"heartRateRecovery":  recovery,
+		"activeEnergy":       energy,
+		"metadata":           record{},
+		"location":           "Indoor",
+	}
+	if steps != nil {
+		workout["stepCount"] = steps
+	}
+	if distances != nil {
+		workout["walkingAndRunningDistance"] = distances
+	}
+	if p.outdoor {
+		workout["location"] = "Outdoor"
+		workout["temperature"] = record{"qty": roundTo(5+rng.Float64()*20, 1), "units": "degC"}
+		workout["humidity"] = record{"qty": math.Round(40 + rng.Float64()*50), "units": "%"}
+	}
+	if totalKm > 0 {
+		workout["distance"] = record{"qty": roundTo(totalKm, 3), "units": "km"}
+		workout["elevationUp"] = record{"qty": roundTo(totalKm*p.climb*(0.8+rng.Float64()*0.4), 1), "units": "m"}
+		if routes && p.outdoor {
+			workout["route"] = generateRoute(rng, start, minutes, p.speed, homeLat, homeLon)
+		}
+	}
+	return workout
+}
+
+// generateRoute generates a GPS point every 10 seconds, wandering out from
+// and back towards home.
+func generateRoute(rng *rand.Rand, start time.Time, minutes int, speed, lat, lon float64) []record {
+	const interval = 10 * time.Second
+	n := minutes * int(time.Minute/interval)
+	points := make([]record, 0, n)
+	course := rng.Float64() * 360
+	altitude := 20 + rng.Float64()*200
+	for i := 0; i < n; i++ {
+		// Turn around halfway, then keep wandering
+		if i == n/2 {
+			course += 180
+		}
+		course = math.Mod(course+rng.NormFloat64()*10+360, 360)
+		v := speed * (0.85 + rng.Float64()*0.3)
+		meters := v * interval.Seconds()
+		lat += meters * math.Cos(course*math.Pi/180) / 111320
+		lon += meters * math.Sin(course*math.Pi/180) / (111320 * math.Cos(lat*math.Pi/180))
+		altitude += rng.NormFloat64() * 0.5
+		points = append(points, record{
+			"lat":       roundTo(lat, 6),
+			"lon":       roundTo(lon, 6),
+			"altitude":  roundTo(altitude, 1),
+			"speed":     roundTo(v, 2),
+			"course":    roundTo(course, 1),
+			"timestamp": haeDate(start.Add(time.Duration(i) * interval)),
+		})
+	}
+	return points
+}
+
+// Labels and associations of generated state of mind entries.
+var (
+	pleasantLabels   = []string{"happy", "calm", "content", "grateful", "excited", "hopeful"}
+	unpleasantLabels = []string{"stressed", "anxious", "tired", "irritated", "sad", "overwhelmed"}
+	moodAssociations = []string{"work", "family", "fitness", "health", "friends", "weather", "money", "selfCare"}
+)
+
+// moods generates the state of mind entries of every day: momentary emotions
+// during the day and a daily mood in the evening.
+func (g *generator) moods() []record {
+	rng := g.stream("moods")
+	var moods []record
+	for day := 0; day < g.opts.Days; day++ {
+		n := g.opts.MoodsPerDay
+		if n == 0 {
+			continue
+		}
+		baseline := clampValence(0.2 + rng.NormFloat64()*0.35)
+		times := make([]time.Time, n-1)
+		for i := range times {
+			times[i] = g.day(day).Add(8*time.Hour + jitter(rng, 13*time.Hour)).Truncate(time.Second)
+		}
+		slices.SortFunc(times, func(a, b time.Time) int { return a.Compare(b) })
+		times = append(times, g.day(day).Add(21*time.Hour+jitter(rng, time.Hour)).Truncate(time.Second))
+
+		for i, at := range times {
+			valence := roundTo(clampValence(baseline+rng.NormFloat64()*0.3), 3)
+			labels := pleasantLabels
+			if valence < 0 {
+				labels = unpleasantLabels
+			}
+			entry := record{
+				"id":                    newGeneratedID(rng),
+				"kind":                  "momentary_emotion",
+				"start":                 haeDate(at),
+				"end":                   haeDate(at),
+				"valence":               valence,
+				"valenceClassification": valenceClassification(valence),
+				"labels":                pick(rng, labels, 1+rng.IntN(2)),
+				"associations":          pick(rng, moodAssociations, 1+rng.IntN(2)),
+			}
+			if i == n-1 {
+				entry["kind"] = "daily_mood"
+				entry["labels"] = []string{}
+			}
+			moods = append(moods, entry)
+		}
+	}
+	return moods
+}
+
+// valenceClassification names the seventh of the valence range a valence
+// falls in, as the Health app does.
+func valenceClassification(valence float64) string {
+	classes := []string{"very unpleasant", "unpleasant", "slightly unpleasant", "neutral", "slightly pleasant", "pleasant", "very pleasant"}
+	i := int((valence + 1) / 2 * float64(len(classes)))
+	return classes[min(max(i, 0), len(classes)-1)]
+}
+
+// clampValence limits a valence to [-1, 1].
+func clampValence(v float64) float64 {
+	return min(max(v, -1), 1)
+}
+
+// pick returns n distinct random elements of values.
+func pick(rng *rand.Rand, values []string, n int) []string {
+	picked := make([]string, 0, n)
+	for _, i := range rng.Perm(len(values))[:n] {
+		picked = append(picked, values[i])
+	}
+	return picked
+}
+
+// newGeneratedID returns a random UUID in the upper case HealthKit uses.
+func newGeneratedID(rng *rand.Rand) string {
+	var b [16]byte
+	for i := range b {
+		b[i] = byte(rng.UintN(256))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+// jitter returns a random duration in [0, d).
+func jitter(rng *rand.Rand, d time.Duration) time.Duration {
+	return time.Duration(rng.Int64N(int64(d)))
+}
+
+// diurnal scales waking hour activity, peaking around noon and early evening.
+func diurnal(hour int) float64 {
+	return 0.6 + 0.4*math.Abs(math.Sin(float64(hour-7)*math.Pi/11))
+}
+
+// haeDate formats a timestamp as Health Auto Export does.
+func haeDate(t time.Time) string {
+	return t.Format(haeDateLayout)
+}
+
+// roundTo rounds v to the given number of decimals.
+func roundTo(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
+
+// nonNil returns records, or an empty list rather than JSON null.
+func nonNil(records []record) []record {
+	if records == nil {
+		return []record{}
+	}
+	return records
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func testGenerateOptions() GenerateOptions {
+	return GenerateOptions{
+		Seed:           42,
+		Start:          time.Date(2025, 3, 3, 0, 0, 0, 0, time.FixedZone("EST", -5*3600)),
+		Days:           5,
+		Metrics:        metricGeneratorNames(),
+		WorkoutTypes:   workoutProfileNames(),
+		WorkoutsPerDay: 2,
+		MoodsPerDay:    3,
+		Routes:         true,
+	}
+}
+
+// generateJSON generates an export and encodes it.
+func generateJSON(t testing.TB, opts GenerateOptions) []byte {
+	t.Helper()
+	export, err := generateExport(opts)
+	if err != nil {
+		t.Fatalf("generateExport() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writeGeneratedExport(&buf, export, ""); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerateExport(t *testing.T) {
+	opts := testGenerateOptions()
+	content := generateJSON(t, opts)
+
+	healthData, report, err := migrateHealthAutoExportJSON(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("decoding generated export: %v", err)
+	}
+	if report.Version != schemaV2 || len(report.UnknownFields) > 0 {
+		t.Errorf("schema report = %+v, want current schema without unknown fields", report)
+	}
+
+	data := healthData.Data
+	if len(data.Metrics) != len(opts.Metrics) {
+		t.Errorf("got %d metrics, want %d", len(data.Metrics), len(opts.Metrics))
+	}
+	for _, m := range data.Metrics {
+		if len(m.Data) < opts.Days {
+			t.Errorf("metric %s has %d records, want at least one a day", m.Name, len(m.Data))
+		}
+		if m.Name == "heart_rate" && m.Data[0].Qty == 0 {
+			t.Error("heart_rate records have no quantity")
+		}
+	}
+
+	if len(data.Workouts) != opts.Days*int(opts.WorkoutsPerDay) {
+		t.Errorf("got %d workouts, want %d", len(data.Workouts), opts.Days*int(opts.WorkoutsPerDay))
+	}
+	for i, w := range data.Workouts {
+		if i > 0 && w.Start.Before(data.Workouts[i-1].End) {
+			t.Errorf("workout %s starts before the previous one ends", w.ID)
+		}
+		if len(w.HeartRateData) != int(w.Duration/60) || len(w.HeartRateRecovery) == 0 || w.ActiveEnergyBurned.Qty <= 0 {
+			t.Errorf("workout %s (%s, %vs) has %d heart rate records, %d recovery records and %v kcal",
+				w.ID, w.Name, w.Duration, len(w.HeartRateData), len(w.HeartRateRecovery), w.ActiveEnergyBurned.Qty)
+		}
+		if p := workoutProfiles[w.Name]; (w.Route != nil) != (p.outdoor && p.speed > 0) {
+			t.Errorf("workout %s (%s) has route %v", w.ID, w.Name, w.Route != nil)
+		}
+	}
+
+	if len(data.StateOfMind) != opts.Days*opts.MoodsPerDay {
+		t.Errorf("got %d state of mind entries, want %d", len(data.StateOfMind), opts.Days*opts.MoodsPerDay)
+	}
+	if last := data.StateOfMind[opts.MoodsPerDay-1]; last.Kind != "daily_mood" {
+		t.Errorf("last entry of the day is %s, want daily_mood", last.Kind)
+	}
+}
+
+func TestGenerateExportDeterministic(t *testing.T) {
+	opts := testGenerateOptions()
+	first := generateJSON(t, opts)
+	if !bytes.Equal(first, generateJSON(t, opts)) {
+		t.Error("the same options generated different exports")
+	}
+
+	other := opts
+	other.Seed++
+	if bytes.Equal(first, generateJSON(t, other)) {
+		t.Error("different seeds generated the same export")
+	}
+
+	// Workouts do not depend on which metrics are generated
+	fewer := opts
+	fewer.Metrics = []string{"step_count"}
+	workouts := func(content []byte) string {
+		var export struct {
+			Data struct {
+				Workouts json.RawMessage `json:"workouts"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(content, &export); err != nil {
+			t.Fatal(err)
+		}
+		return string(export.Data.Workouts)
+	}
+	if workouts(first) != workouts(generateJSON(t, fewer)) {
+		t.Error("changing the metrics changed the workouts")
+	}
+}
+
+func TestGenerateOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *GenerateOptions)
+	}{
+		{"no days", func(o *GenerateOptions) { o.Days = 0 }},
+		{"too many workouts", func(o *GenerateOptions) { o.WorkoutsPerDay = maxWorkoutsPerDay + 1 }},
+		{"no workout types", func(o *GenerateOptions) { o.WorkoutTypes = nil }},
+		{"negative moods", func(o *GenerateOptions) { o.MoodsPerDay = -1 }},
+		{"unknown metric", func(o *GenerateOptions) { o.Metrics = []string{"blood_glucose"} }},
+		{"unknown workout type", func(o *GenerateOptions) { o.WorkoutTypes = []string{"Curling"} }},
+	}
+	for _, tt := range tests {
+		opts := testGenerateOptions()
+		tt.modify(&opts)
+		if _, err := generateExport(opts); err == nil {
+			t.Errorf("%s: generateExport() succeeded", tt.name)
+		}
+	}
+}
+
+func BenchmarkExportData(b *testing.B) {
+	opts := testGenerateOptions()
+	opts.Days = 30
+	healthData, err := decodeHealthData(bytes.NewReader(generateJSON(b, opts)), formatAuto)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := exportData(context.Background(), healthData, exportSource{}, b.TempDir()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// updateGolden rewrites the golden export directories from the current output:
+//
+//	go test ./cmd -run TestProcessGolden -update
+var updateGolden = flag.Bool("update", false, "rewrite the golden export directories in testdata/golden")
+
+// goldenEpoch is the SOURCE_DATE_EPOCH of golden exports, pinning the
+// generation time they record (2026-01-01T00:00:00Z).
+const goldenEpoch = "1767225600"
+
+// TestProcessGolden processes each source of the testdata corpus and compares
+// the export directory, byte for byte, with testdata/golden/<name>/want.
+func TestProcessGolden(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", goldenEpoch)
+	previousVersion, previousCommit, previousWorkers := Version, Commit, exportWorkers
+	previousGroupBy, previousEnvelope, previousCollections := groupBy, batchEnvelope, targetCollections
+	defer func() {
+		Version, Commit, exportWorkers = previousVersion, previousCommit, previousWorkers
+		groupBy, batchEnvelope, targetCollections = previousGroupBy, previousEnvelope, previousCollections
+	}()
+	// Several workers, so that output depending on completion order shows up
+	Version, Commit, exportWorkers = "dev", "none", 4
+
+	tests := []struct {
+		name      string
+		source    string // Relative to testdata/golden
+		configure func()
+	}{
+		{name: "healthyapps", source: "healthyapps/source.json"},
+		{
+			name:   "healthyapps-grouped",
+			source: "healthyapps/source.json",
+			configure: func() {
+				groupBy, batchEnvelope, targetCollections = groupByWeek, true, []string{"health"}
+			},
+		},
+		{name: "empty-arrays", source: "empty-arrays/source.json"},
+		{name: "missing-fields", source: "missing-fields/source.json"},
+		{name: "overlapping-sources", source: "overlapping-sources/source.json"},
+		{name: "legacy-schema", source: "legacy-schema/source.json"},
+		{name: "unknown-fields", source: "unknown-fields/source.json"},
+		{name: "hae-csv", source: "hae-csv/source.csv"},
+		{name: "apple-health", source: "apple-health/export.xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groupBy, batchEnvelope, targetCollections = "", false, []string{}
+			if tt.configure != nil {
+				tt.configure()
+			}
+			if err := configureExport(); err != nil {
+				t.Fatalf("configureExport() error = %v", err)
+			}
+
+			got := t.TempDir()
+			source := filepath.Join("testdata", "golden", tt.source)
+			if err := processHealthData(context.Background(), source, got); err != nil {
+				t.Fatalf("processHealthData() error = %v", err)
+			}
+
+			want := filepath.Join("testdata", "golden", tt.name, "want")
+			if *updateGolden {
+				if err := os.RemoveAll(want); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.CopyFS(want, os.DirFS(got)); err != nil {
+					t.Fatalf("updating golden files: %v", err)
+				}
+				return
+			}
+			compareGoldenDir(t, got, want)
+		})
+	}
+}
+
+// compareGoldenDir reports the files that differ between an export directory
+// and its golden copy.
+func compareGoldenDir(t *testing.T, got, want string) {
+	t.Helper()
+	gotFiles, wantFiles := readGoldenDir(t, got), readGoldenDir(t, want)
+
+	names := make([]string, 0, len(gotFiles)+len(wantFiles))
+	for name := range gotFiles {
+		names = append(names, name)
+	}
+	for name := range wantFiles {
+		if _, ok := gotFiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		gotContent, inGot := gotFiles[name]
+		wantContent, inWant := wantFiles[name]
+		switch {
+		case !inWant:
+			t.Errorf("%s: unexpected file", name)
+		case !inGot:
+			t.Errorf("%s: missing file", name)
+		case !bytes.Equal(gotContent, wantContent):
+			t.Errorf("%s: %s", name, firstDifference(gotContent, wantContent))
+		}
+	}
+	if t.Failed() {
+		t.Log("run with -update to accept the new output")
+	}
+}
+
+// readGoldenDir reads every file below dir, keyed by slash-separated path.
+func readGoldenDir(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = content
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("reading %s: %v", dir, err)
+	}
+	return files
+}
+
+// firstDifference describes the first line at which got differs from want.
+func firstDifference(got, want []byte) string {
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			return fmt.Sprintf("line %d: got %q, want %q", i+1, g, w)
+		}
+	}
+	return "content differs"
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Supported values for the --group-by flag.
+const (
+	groupBySequential   = ""
+	groupByWeek         = "week"
+	groupByMonth        = "month"
+	groupByWorkoutType  = "workout-type"
+	groupByMetricFamily = "metric-family"
+)
+
+// validGroupBy lists the accepted --group-by values in help-text order.
+var validGroupBy = []string{groupByWeek, groupByMonth, groupByWorkoutType, groupByMetricFamily}
+
+// validateGroupBy checks that value is a supported grouping strategy.
+// An empty value selects sequential batching.
+func validateGroupBy(value string) error {
+	if value == groupBySequential {
+		return nil
+	}
+	for _, v := range validGroupBy {
+		if value == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid group-by value: %s (valid: %s)", value, strings.Join(validGroupBy, ", "))
+}
+
+// batchPlan describes a single import batch: the filename suffix identifying
+// its group, a human-readable description, and the indices of the items it holds.
+type batchPlan struct {
+	Suffix      string
+	Description string
+	Indices     []int
+}
+
+// groupKeyFunc returns the group key (used for grouping and ordering) and the
+// display title for the item at index i. The batch file suffix is derived
+// from the key by groupSuffix.
+type groupKeyFunc func(i int) (key, title string)
+
+// planBatches splits count items into batches of at most batchSize.
+// With a nil keyOf the items are batched sequentially in input order; otherwise
+// items are grouped by key, groups are ordered by key, and groups larger than
+// batchSize are split into numbered parts. label names the data type in
+// descriptions (e.g. "Workouts").
+func planBatches(label string, count, batchSize int, keyOf groupKeyFunc) []batchPlan {
+	if count == 0 {
+		return nil
+	}
+	if batchSize <= 0 {
+		batchSize = count
+	}
+
+	if keyOf == nil {
+		plans := make([]batchPlan, 0, estimateBatches(count, batchSize))
+		for i := 0; i < count; i += batchSize {
+			end := i + batchSize
+			if end > count {
+				end = count
+			}
+			plans = append(plans, batchPlan{
+				Description: fmt.Sprintf("%s %d-%d of %d", label, i+1, end, count),
+				Indices:     indexRange(i, end),
+			})
+		}
+		return plans
+	}
+
+	// Collect items into groups, remembering each group's title
+	groups := make(map[string][]int)
+	titles := make(map[string]string)
+	for i := 0; i < count; i++ {
+		key, title := keyOf(i)
+		groups[key] = append(groups[key], i)
+		titles[key] = title
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var plans []batchPlan
+	for _, key := range keys {
+		indices := groups[key]
+		parts := estimateBatches(len(indices), batchSize)
+		for part := 0; part < parts; part++ {
+			start := part * batchSize
+			end := start + batchSize
+			if end > len(indices) {
+				end = len(indices)
+			}
+
+			description := fmt.Sprintf("%s – %s", label, titles[key])
+			if parts > 1 {
+				description = fmt.Sprintf("%s (part %d of %d)", description, part+1, parts)
+			}
+			plans = append(plans, batchPlan{
+				Suffix:      groupSuffix(key),
+				Description: description,
+				Indices:     indices[start:end],
+			})
+		}
+	}
+	return plans
+}
+
+// indexRange returns the indices in [start, end).
+func indexRange(start, end int) []int {
+	indices := make([]int, 0, end-start)
+	for i := start; i < end; i++ {
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+// importBatchName builds the batch file name for a batch number, data type and
+// optional group suffix (e.g. "batch_3_workouts_2025-W46.json").
+func importBatchName(batchNum int, dataType, suffix string) string {
+	if suffix == "" {
+		return fmt.Sprintf("batch_%d_%s.json", batchNum, dataType)
+	}
+	return fmt.Sprintf("batch_%d_%s_%s.json", batchNum, dataType, suffix)
+}
+
+// groupSuffix returns the batch file name suffix for a group key: the key
+// with spaces as underscores when that is filename-safe, as for weeks, months
+// and ASCII workout types. Other keys, such as workout types in other scripts,
+// are sanitized and given a short hash of the key, so that distinct keys keep
+// distinct suffixes.
+func groupSuffix(key string) string {
+	suffix := strings.ReplaceAll(key, " ", "_")
+	safe := strings.IndexFunc(suffix, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '_' && r != '-'
+	}) < 0
+	if safe && suffix != "" {
+		return suffix
+	}
+
+	hash := contentHash(key)[:shortIDLength]
+	if sanitized := sanitizeFilename(key); sanitized != "" {
+		return sanitized + "_" + hash
+	}
+	return hash
+}
+
+// timeGroupKey returns a groupKeyFunc that groups by ISO week or calendar month
+// of the time returned by timeOf. It returns nil for other strategies.
+func timeGroupKey(groupBy string, timeOf func(i int) time.Time) groupKeyFunc {
+	switch groupBy {
+	case groupByWeek:
+		return func(i int) (string, string) {
+			year, week := timeOf(i).ISOWeek()
+			key := fmt.Sprintf("%d-W%02d", year, week)
+			return key, "ISO week " + key
+		}
+	case groupByMonth:
+		return func(i int) (string, string) {
+			t := timeOf(i)
+			return t.Format("2006-01"), t.Format("January 2006")
+		}
+	default:
+		return nil
+	}
+}
+
+// metricFamilyRules maps substrings of metric names to metric families.
+// Rules are checked in order, so more specific families come first
+// (e.g. "walking_heart_rate_average" belongs to heart, not activity).
+var metricFamilyRules = []struct {
+	family   string
+	keywords []string
+}{
+	{"heart", []string{"heart", "cardio", "vo2", "ecg"}},
+	{"sleep", []string{"sleep"}},
+	{"respiratory", []string{"respiratory", "oxygen", "breath"}},
+	{"vitals", []string{"blood_pressure", "blood_glucose", "temperature"}},
+	{"body", []string{"weight", "body", "bmi", "height", "lean", "waist"}},
+	{"hearing", []string{"audio", "noise", "headphone", "hearing"}},
+	{"mindfulness", []string{"mindful", "daylight"}},
+	{"nutrition", []string{"dietary", "water", "caffeine", "protein", "carbohydrate", "fat", "fiber", "sugar", "sodium"}},
+	{"activity", []string{"step", "distance", "energy", "exercise", "stand", "flights", "walking", "running", "cycling", "swimming", "move", "physical_effort"}},
+}
+
+// metricFamily classifies a metric name into a broad family such as
+// "heart", "activity" or "sleep". Unrecognized metrics are classified as "other".
+func metricFamily(name string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(name, " ", "_"))
+	for _, rule := range metricFamilyRules {
+		for _, keyword := range rule.keywords {
+			if strings.Contains(normalized, keyword) {
+				return rule.family
+			}
+		}
+	}
+	return "other"
+}
+
+// workoutGroupKey returns the grouping for workout batches under the configured
+// --group-by strategy, or nil for sequential batching.
+func workoutGroupKey(summaries []WorkoutSummary) groupKeyFunc {
+	if groupBy == groupByWorkoutType {
+		return func(i int) (string, string) {
+			return summaries[i].Name, summaries[i].Name
+		}
+	}
+	return timeGroupKey(groupBy, func(i int) time.Time { return summaries[i].Start })
+}
+
+// stateOfMindGroupKey returns the grouping for state of mind batches under the
+// configured --group-by strategy, or nil for sequential batching.
+func stateOfMindGroupKey(summaries []StateOfMindSummary) groupKeyFunc {
+	return timeGroupKey(groupBy, func(i int) time.Time { return summaries[i].Start })
+}
+
+// metricGroupKey returns the grouping for metric batches under the configured
+// --group-by strategy, or nil for sequential batching. Time-based strategies
+// group metrics by the start of their date range.
+func metricGroupKey(summaries []MetricSummary) groupKeyFunc {
+	if groupBy == groupByMetricFamily {
+		return func(i int) (string, string) {
+			family := metricFamily(summaries[i].Name)
+			return family, strings.ToUpper(family[:1]) + family[1:]
+		}
+	}
+	return timeGroupKey(groupBy, func(i int) time.Time { return summaries[i].StartDate })
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateGroupBy(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "sequential", value: "", wantErr: false},
+		{name: "week", value: "week", wantErr: false},
+		{name: "month", value: "month", wantErr: false},
+		{name: "workout type", value: "workout-type", wantErr: false},
+		{name: "metric family", value: "metric-family", wantErr: false},
+		{name: "unknown", value: "year", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateGroupBy(tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("validateGroupBy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlanBatchesSequential(t *testing.T) {
+	plans := planBatches("Workouts", 5, 2, nil)
+
+	if len(plans) != 3 {
+		t.Fatalf("len(plans) = %v, want 3", len(plans))
+	}
+	if plans[0].Description != "Workouts 1-2 of 5" {
+		t.Errorf("Description = %v, want Workouts 1-2 of 5", plans[0].Description)
+	}
+	if plans[2].Suffix != "" || len(plans[2].Indices) != 1 || plans[2].Indices[0] != 4 {
+		t.Errorf("last plan = %+v, want single index 4 with no suffix", plans[2])
+	}
+}
+
+func TestPlanBatchesGrouped(t *testing.T) {
+	starts := []time.Time{
+		time.Date(2025, 11, 17, 9, 0, 0, 0, time.UTC), // 2025-W47
+		time.Date(2025, 11, 10, 9, 0, 0, 0, time.UTC), // 2025-W46
+		time.Date(2025, 11, 18, 9, 0, 0, 0, time.UTC), // 2025-W47
+		time.Date(2025, 11, 19, 9, 0, 0, 0, time.UTC), // 2025-W47
+	}
+	keyOf := timeGroupKey(groupByWeek, func(i int) time.Time { return starts[i] })
+
+	plans := planBatches("Workouts", len(starts), 2, keyOf)
+
+	want := []struct {
+		suffix      string
+		description string
+		indices     []int
+	}{
+		{"2025-W46", "Workouts – ISO week 2025-W46", []int{1}},
+		{"2025-W47", "Workouts – ISO week 2025-W47 (part 1 of 2)", []int{0, 2}},
+		{"2025-W47", "Workouts – ISO week 2025-W47 (part 2 of 2)", []int{3}},
+	}
+	if len(plans) != len(want) {
+		t.Fatalf("len(plans) = %v, want %v", len(plans), len(want))
+	}
+	for i, w := range want {
+		if plans[i].Suffix != w.suffix {
+			t.Errorf("plans[%d].Suffix = %v, want %v", i, plans[i].Suffix, w.suffix)
+		}
+		if plans[i].Description != w.description {
+			t.Errorf("plans[%d].Description = %v, want %v", i, plans[i].Description, w.description)
+		}
+		if len(plans[i].Indices) != len(w.indices) {
+			t.Errorf("plans[%d].Indices = %v, want %v", i, plans[i].Indices, w.indices)
+			continue
+		}
+		for j := range w.indices {
+			if plans[i].Indices[j] != w.indices[j] {
+				t.Errorf("plans[%d].Indices = %v, want %v", i, plans[i].Indices, w.indices)
+				break
+			}
+		}
+	}
+}
+
+func TestPlanBatchesWorkoutType(t *testing.T) {
+	previous := groupBy
+	defer func() { groupBy = previous }()
+	groupBy = groupByWorkoutType
+
+	summaries := []WorkoutSummary{{Name: "Yoga – Hatha"}, {Name: "ヨガ"}, {Name: "Yoga - Hatha"}, {Name: "Outdoor Walk"}, {Name: "ヨガ"}}
+	plans := planBatches("Workouts", len(summaries), 10, workoutGroupKey(summaries))
+
+	if len(plans) != 4 {
+		t.Fatalf("got %d plans, want one per workout type: %+v", len(plans), plans)
+	}
+	suffixes := make(map[string]bool)
+	for _, plan := range plans {
+		if plan.Suffix == "" || suffixes[plan.Suffix] {
+			t.Errorf("plan %q has an empty or repeated suffix %q", plan.Description, plan.Suffix)
+		}
+		suffixes[plan.Suffix] = true
+		name := summaries[plan.Indices[0]].Name
+		for _, i := range plan.Indices {
+			if summaries[i].Name != name {
+				t.Errorf("plan %q holds %s and %s", plan.Description, name, summaries[i].Name)
+			}
+		}
+		if plan.Description != "Workouts – "+name {
+			t.Errorf("description = %q, want Workouts – %s", plan.Description, name)
+		}
+	}
+	if !suffixes["Outdoor_Walk"] {
+		t.Errorf("suffixes = %v, want Outdoor_Walk for an ASCII name", suffixes)
+	}
+}
+
+func TestTimeGroupKeyMonth(t *testing.T) {
+	keyOf := timeGroupKey(groupByMonth, func(int) time.Time {
+		return time.Date(2025, 11, 17, 9, 0, 0, 0, time.UTC)
+	})
+
+	key, title := keyOf(0)
+	if key != "2025-11" || title != "November 2025" {
+		t.Errorf("keyOf() = %v, %v, want 2025-11, November 2025", key, title)
+	}
+}
+
+func TestImportBatchName(t *testing.T) {
+	if got := importBatchName(1, "workouts", ""); got != "batch_1_workouts.json" {
+		t.Errorf("importBatchName() = %v, want batch_1_workouts.json", got)
+	}
+	if got := importBatchName(3, "workouts", "2025-W46"); got != "batch_3_workouts_2025-W46.json" {
+		t.Errorf("importBatchName() = %v, want batch_3_workouts_2025-W46.json", got)
+	}
+}
+
+func TestMetricFamily(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "heart_rate", want: "heart"},
+		{name: "walking_heart_rate_average", want: "heart"},
+		{name: "step_count", want: "activity"},
+		{name: "Active Energy", want: "activity"},
+		{name: "sleep_analysis", want: "sleep"},
+		{name: "blood_oxygen_saturation", want: "respiratory"},
+		{name: "weight_body_mass", want: "body"},
+		{name: "environmental_audio_exposure", want: "hearing"},
+		{name: "something_new", want: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metricFamily(tt.name); got != tt.want {
+				t.Errorf("metricFamily() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvHeaderPattern splits a Health Auto Export CSV column header into its
+// name, an optional [Min], [Max] or [Avg] aggregate and its units, which the
+// app writes in brackets or parentheses: "Heart Rate [count/min]",
+// "Heart Rate [Avg] (count/min)" or "Step Count (count)".
+var csvHeaderPattern = regexp.MustCompile(`^(.*?)\s*(?:\[(Min|Max|Avg)\])?\s*(?:[\[(]([^\])]*)[\])])?\s*$`)
+
+// csvDateLayouts are the timestamp layouts of the date column without a zone,
+// read in local time.
+var csvDateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// csvColumn is a parsed CSV column header.
+type csvColumn struct {
+	Header    string
+	Name      string // Metric name, such as "heart_rate"
+	Label     string // Name as written in the header, such as "Heart Rate"
+	Aggregate string // "Min", "Max", "Avg" or ""
+	Units     string
+}
+
+// parseCSVColumn parses a column header.
+func parseCSVColumn(header string) csvColumn {
+	header = strings.TrimSpace(strings.TrimPrefix(header, "\ufeff"))
+	column := csvColumn{Header: header, Label: header}
+	if m := csvHeaderPattern.FindStringSubmatch(header); m != nil {
+		column.Label, column.Aggregate, column.Units = m[1], m[2], strings.TrimSpace(m[3])
+	}
+	column.Name = csvMetricName(column.Label)
+	return column
+}
+
+// csvMetricName converts a column label to a metric name:
+// "Walking + Running Distance" becomes "walking_running_distance".
+func csvMetricName(label string) string {
+	var b strings.Builder
+	separate := false
+	for _, r := range strings.ToLower(label) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if separate && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			separate = false
+			continue
+		}
+		separate = true
+	}
+	return b.String()
+}
+
+// healthyAppsCSVParser reads the CSV exports of Health Auto Export: a metrics
+// file with a date column followed by one column per metric, or a workouts
+// file with one row per workout.
+type healthyAppsCSVParser struct{}
+
+func (healthyAppsCSVParser) Name() string        { return "healthyapps-csv" }
+func (healthyAppsCSVParser) Description() string { return "Health Auto Export CSV" }
+
+func (healthyAppsCSVParser) Sniff(head []byte) bool {
+	line, _, _ := bytes.Cut(trimHead(head), []byte("\n"))
+	fields := strings.Split(strings.TrimSpace(string(line)), ",")
+	if len(fields) < 2 {
+		return false
+	}
+	first := strings.Trim(fields[0], `"`)
+	return first == "Date/Time" || first == "Date" || strings.Contains(string(line), "Workout Type")
+}
+
+func (healthyAppsCSVParser) Parse(r io.Reader) (HealthData, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return HealthData{}, fmt.Errorf("reading CSV header: %w", err)
+	}
+	columns := make([]csvColumn, len(header))
+	for i, h := range header {
+		columns[i] = parseCSVColumn(h)
+	}
+
+	var data Data
+	for _, column := range columns {
+		if column.Name == "workout_type" {
+			data.Workouts, err = readWorkoutsCSV(reader, columns)
+			if err != nil {
+				return HealthData{}, err
+			}
+			return HealthData{Data: data}, nil
+		}
+	}
+	data.Metrics, err = readMetricsCSV(reader, columns)
+	if err != nil {
+		return HealthData{}, err
+	}
+	return HealthData{Data: data}, nil
+}
+
+// readMetricsCSV reads metric rows: a timestamp followed by one value per
+// metric column. Empty cells are skipped. The [Min], [Max] and [Avg] columns
+// of a metric make up one record, as in the JSON export: the values are kept
+// in the record's extras as Min, Max and Avg, and the quantity is the [Avg].
+func readMetricsCSV(reader *csv.Reader, columns []csvColumn) ([]Metric, error) {
+	metrics := make([]*Metric, len(columns))
+	byName := make(map[string]*Metric)
+	var order []*Metric
+	for i, column := range columns[1:] {
+		if column.Name == "" {
+			continue
+		}
+		metric, ok := byName[column.Name]
+		if !ok {
+			metric = &Metric{Name: column.Name, Units: column.Units}
+			byName[column.Name] = metric
+			order = append(order, metric)
+		}
+		metrics[i+1] = metric
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+
+		date, err := parseCSVDate(row[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records := make(map[*Metric]*MetricRecord)
+		for i, cell := range row {
+			if i >= len(metrics) || metrics[i] == nil || strings.TrimSpace(cell) == "" {
+				continue
+			}
+			value := strings.TrimSpace(cell)
+			qty, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d, column %q: invalid number %q", line, columns[i].Header, cell)
+			}
+
+			record, ok := records[metrics[i]]
+			if !ok {
+				record = &MetricRecord{Date: date}
+				records[metrics[i]] = record
+			}
+			aggregate := columns[i].Aggregate
+			if aggregate == "" || aggregate == "Avg" {
+				record.Qty = qty
+			}
+			if aggregate != "" {
+				if record.Extras == nil {
+					record.Extras = make(Extras)
+				}
+				record.Extras[aggregate] = json.RawMessage(strconv.FormatFloat(qty, 'f', -1, 64))
+			}
+		}
+		for _, metric := range order {
+			if record, ok := records[metric]; ok {
+				metric.Data = append(metric.Data, *record)
+			}
+		}
+	}
+
+	result := make([]Metric, 0, len(order))
+	for _, metric := range order {
+		if len(metric.Data) > 0 {
+			result = append(result, *metric)
+		}
+	}
+	return result, nil
+}
+
+// readWorkoutsCSV reads workout rows. Columns the Workout type has no field
+// for, such as average heart rate or cadence, are kept in the metadata.
+func readWorkoutsCSV(reader *csv.Reader, columns []csvColumn) ([]Workout, error) {
+	var workouts []Workout
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		workout, err := csvWorkout(row, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		workouts = append(workouts, workout)
+	}
+	return workouts, nil
+}
+
+// csvWorkout maps one workout row.
+func csvWorkout(row []string, columns []csvColumn) (Workout, error) {
+	var workout Workout
+	var duration string
+	metadata := make(map[string]string)
+
+	for i, cell := range row {
+		cell = strings.TrimSpace(cell)
+		if i >= len(columns) || cell == "" {
+			continue
+		}
+		column := columns[i]
+		qty, qtyErr := strconv.ParseFloat(cell, 64)
+
+		switch {
+		case column.Name == "workout_type":
+			workout.Name = cell
+		case column.Name == "start" || column.Name == "end":
+			date, err := parseCSVDate(cell)
+			if err != nil {
+				return Workout{}, err
+			}
+			if column.Name == "start" {
+				workout.Start = date
+			} else {
+				workout.End = date
+			}
+		case column.Name == "duration":
+			duration = cell
+		case column.Name == "active_energy" && qtyErr == nil:
+			workout.ActiveEnergyBurned = EnergyValue{Qty: qty, Units: column.Units}
+		case column.Name == "distance" && qtyErr == nil:
+			workout.Distance = ValueWithUnits{Qty: qty, Units: column.Units}
+		case column.Name == "elevation_ascended" && qtyErr == nil:
+			workout.ElevationUp = ValueWithUnits{Qty: qty, Units: column.Units}
+		case column.Name == "temperature" && qtyErr == nil:
+			workout.Temperature = ValueWithUnits{Qty: qty, Units: column.Units}
+		case column.Name == "humidity" && qtyErr == nil:
+			workout.Humidity = ValueWithUnits{Qty: qty, Units: column.Units}
+		case column.Name == "intensity" && qtyErr == nil:
+			workout.Intensity = ValueWithUnits{Qty: qty, Units: column.Units}
+		default:
+			metadata[column.Header] = cell
+		}
+	}
+
+	if workout.Name == "" || workout.Start.IsZero() {
+		return Workout{}, fmt.Errorf("workout without type or start")
+	}
+	workout.Duration = workout.End.Sub(workout.Start).Seconds()
+	if seconds, err := parseCSVDuration(duration); err == nil {
+		workout.Duration = seconds
+	}
+	if len(metadata) > 0 {
+		workout.Metadata = metadata
+	}
+
+	// The CSV has no workout ID; derive a stable one so re-imports de-duplicate
+	sum := sha256.Sum256([]byte(workout.Name + "|" + workout.Start.Format(time.RFC3339) + "|" + workout.End.Format(time.RFC3339)))
+	workout.ID = "csv-" + hex.EncodeToString(sum[:8])
+	return workout, nil
+}
+
+// parseCSVDate parses a CSV timestamp, with a zone offset or in local time.
+func parseCSVDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := parseDate(s); err == nil {
+		return t, nil
+	}
+	for _, layout := range csvDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %q", s)
+}
+
+// parseCSVDuration parses a workout duration written as h:mm:ss, mm:ss or a
+// number of seconds.
+func parseCSVDuration(s string) (float64, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return seconds, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid duration: %q", s)
+	}
+	var seconds float64
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %q", s)
+		}
+		seconds = seconds*60 + v
+	}
+	return seconds, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCSVColumn(t *testing.T) {
+	tests := []struct {
+		header string
+		want   csvColumn
+	}{
+		{"Heart Rate [count/min]", csvColumn{Name: "heart_rate", Label: "Heart Rate", Units: "count/min"}},
+		{"Heart Rate [Avg] (count/min)", csvColumn{Name: "heart_rate", Label: "Heart Rate", Aggregate: "Avg", Units: "count/min"}},
+		{"Step Count (count)", csvColumn{Name: "step_count", Label: "Step Count", Units: "count"}},
+		{"Walking + Running Distance (mi)", csvColumn{Name: "walking_running_distance", Label: "Walking + Running Distance", Units: "mi"}},
+		{"\ufeffDate/Time", csvColumn{Name: "date_time", Label: "Date/Time"}},
+		{"Workout Type", csvColumn{Name: "workout_type", Label: "Workout Type"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got := parseCSVColumn(tt.header)
+			got.Header = ""
+			if got != tt.want {
+				t.Errorf("parseCSVColumn(%q) = %+v, want %+v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthyAppsCSVParserMetrics(t *testing.T) {
+	input := "Date/Time,Heart Rate [Min] (count/min),Heart Rate [Max] (count/min),Heart Rate [Avg] (count/min),Step Count [count],Blood Oxygen Saturation (%)\n" +
+		"2025-11-10 08:00:00,55,70,62,1000,\n" +
+		"2025-11-10 09:00:00,,,,2500,97\n" +
+		"\n" +
+		"2025-11-11 08:00:00 -0500,60,80,71,,\n"
+
+	healthData, err := healthyAppsCSVParser{}.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	metrics := healthData.Data.Metrics
+	if len(metrics) != 3 {
+		t.Fatalf("parsed %d metrics, want 3: %+v", len(metrics), metrics)
+	}
+	tests := []struct {
+		name    string
+		units   string
+		records []float64
+	}{
+		{"heart_rate", "count/min", []float64{62, 71}},
+		{"step_count", "count", []float64{1000, 2500}},
+		{"blood_oxygen_saturation", "%", []float64{97}},
+	}
+	for i, tt := range tests {
+		metric := metrics[i]
+		if metric.Name != tt.name || metric.Units != tt.units || len(metric.Data) != len(tt.records) {
+			t.Errorf("metric %d = %s [%s] with %d records, want %s [%s] with %d", i, metric.Name, metric.Units, len(metric.Data), tt.name, tt.units, len(tt.records))
+			continue
+		}
+		for j, want := range tt.records {
+			if metric.Data[j].Qty != want {
+				t.Errorf("%s record %d = %v, want %v", tt.name, j, metric.Data[j].Qty, want)
+			}
+		}
+	}
+
+	if extras := metrics[0].Data[1].Extras; string(extras["Min"]) != "60" || string(extras["Max"]) != "80" || string(extras["Avg"]) != "71" {
+		t.Errorf("heart_rate extras = %s, want Min 60, Max 80, Avg 71", extras)
+	}
+	if extras := metrics[1].Data[0].Extras; extras != nil {
+		t.Errorf("step_count extras = %s, want none", extras)
+	}
+
+	want := time.Date(2025, 11, 11, 8, 0, 0, 0, time.FixedZone("", -5*3600))
+	if got := metrics[0].Data[1].Date; !got.Equal(want) {
+		t.Errorf("zoned date = %v, want %v", got, want)
+	}
+	if got := metrics[0].Data[0].Date; got.Location() != time.Local || got.Hour() != 8 {
+		t.Errorf("local date = %v, want 08:00 local time", got)
+	}
+}
+
+func TestHealthyAppsCSVParserWorkouts(t *testing.T) {
+	input := "Workout Type,Start,End,Duration,Active Energy (kcal),Distance (mi),Avg Heart Rate (count/min),Elevation Ascended (ft)\n" +
+		"Outdoor Walk,2025-11-10 17:00:00 -0500,2025-11-10 17:30:00 -0500,00:30:00,120,1.5,101,40\n" +
+		"Yoga,2025-11-11 07:00:00 -0500,2025-11-11 07:45:00 -0500,,,,,\n"
+
+	healthData, err := healthyAppsCSVParser{}.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	workouts := healthData.Data.Workouts
+	if len(workouts) != 2 {
+		t.Fatalf("parsed %d workouts, want 2", len(workouts))
+	}
+	walk := workouts[0]
+	if walk.Name != "Outdoor Walk" || walk.Duration != 1800 || !strings.HasPrefix(walk.ID, "csv-") {
+		t.Errorf("walk = %q, duration %v, id %q", walk.Name, walk.Duration, walk.ID)
+	}
+	if walk.ActiveEnergyBurned != (EnergyValue{Qty: 120, Units: "kcal"}) || walk.Distance != (ValueWithUnits{Qty: 1.5, Units: "mi"}) ||
+		walk.ElevationUp != (ValueWithUnits{Qty: 40, Units: "ft"}) {
+		t.Errorf("walk totals = %+v, %+v, %+v", walk.ActiveEnergyBurned, walk.Distance, walk.ElevationUp)
+	}
+	if metadata, _ := walk.Metadata.(map[string]string); metadata["Avg Heart Rate (count/min)"] != "101" {
+		t.Errorf("walk metadata = %v, want the average heart rate", walk.Metadata)
+	}
+	if yoga := workouts[1]; yoga.Duration != 2700 || yoga.Metadata != nil {
+		t.Errorf("yoga duration = %v, metadata = %v, want 2700 from start and end, no metadata", yoga.Duration, yoga.Metadata)
+	}
+
+	if _, err := (healthyAppsCSVParser{}).Parse(strings.NewReader("Workout Type,Start\nRun,yesterday\n")); err == nil {
+		t.Error("Parse() with an invalid start succeeded, want error")
+	}
+}
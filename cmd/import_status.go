@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// importJournalFile is the append-only log of import outcomes, one JSON object
+// per line, kept in the import directory next to the batch files.
+const importJournalFile = "import_journal.jsonl"
+
+// Batch states recorded in the import journal and reported by import status.
+const (
+	batchStatusDone    = "done"
+	batchStatusPending = "pending"
+	batchStatusFailed  = "failed"
+)
+
+// Supported values for the import status --format flag.
+var validStatusFormats = []string{"text", "json", "markdown"}
+
+var (
+	importStatusDir    string
+	importStatusFormat string
+	importMarkDir      string
+	importMarkStatus   string
+	importMarkError    string
+)
+
+// importBatchTypes lists the batch data types in import order with their display labels.
+var importBatchTypes = []struct {
+	dataType string
+	label    string
+}{
+	{"workouts", "Workouts"},
+	{"state_of_mind", "State of mind"},
+	{"metrics", "Metrics"},
+}
+
+// batchFilePattern matches batch file names produced by importBatchName.
+var batchFilePattern = regexp.MustCompile(`^batch_(\d+)_(workouts|state_of_mind|metrics)(?:_(.+))?\.json$`)
+
+// importCmd groups the commands for working with generated import batches
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Track the import of generated memory batches",
+	Long: `Track which import batches generated by the process command have been
+imported into MCP Memory.
+
+Import outcomes are recorded in import/import_journal.jsonl. The generated
+import.sh script appends to the journal automatically; batches imported by
+hand can be recorded with "import mark".`,
+}
+
+// importStatusCmd reports import progress for an export directory
+var importStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which import batches are done, pending or failed",
+	Long: `Read the batch files and import journal of an export directory and report
+per-type totals, batches done/pending/failed and record counts.`,
+	Example: `  # Show import progress
+  apple-health-export-parser import status --export exports/2025-11-17
+
+  # Write a markdown progress report
+  apple-health-export-parser import status --export exports/2025-11-17 --format markdown > IMPORT_STATUS.md`,
+	Args: cobra.NoArgs,
+	RunE: runImportStatus,
+}
+
+// importMarkCmd records the outcome of manually imported batches
+var importMarkCmd = &cobra.Command{
+	Use:   "mark BATCH_FILE...",
+	Short: "Record batches as done, failed or pending in the import journal",
+	Example: `  # Record a batch imported by hand
+  apple-health-export-parser import mark --export exports/2025-11-17 batch_1_workouts.json
+
+  # Record a failure
+  apple-health-export-parser import mark --export exports/2025-11-17 --status failed --error "timeout" batch_2_metrics.json`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runImportMark,
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.AddCommand(importStatusCmd)
+	importCmd.AddCommand(importMarkCmd)
+
+	importStatusCmd.Flags().StringVarP(&importStatusDir, "export", "e", "exports", "export directory containing the import batches")
+	importStatusCmd.Flags().StringVarP(&importStatusFormat, "format", "f", "text", "output format (text, json, markdown)")
+
+	importMarkCmd.Flags().StringVarP(&importMarkDir, "export", "e", "exports", "export directory containing the import batches")
+	importMarkCmd.Flags().StringVar(&importMarkStatus, "status", batchStatusDone, "batch status to record (done, failed, pending)")
+	importMarkCmd.Flags().StringVar(&importMarkError, "error", "", "error message to record with a failed batch")
+}
+
+// ImportJournalEntry records the outcome of one import attempt.
+type ImportJournalEntry struct {
+	Time   time.Time `json:"time"`
+	Batch  string    `json:"batch"`  // Batch file name relative to the import directory
+	Status string    `json:"status"` // done, failed or pending
+	Error  string    `json:"error,omitempty"`
+}
+
+// ImportStatus summarizes import progress for an export directory.
+type ImportStatus struct {
+	ImportDir string              `json:"importDir"`
+	Types     []ImportTypeStatus  `json:"types"`
+	Total     ImportTypeStatus    `json:"total"`
+	Batches   []ImportBatchStatus `json:"batches"`
+}
+
+// ImportTypeStatus holds batch and record counts for one data type.
+type ImportTypeStatus struct {
+	Type            string `json:"type"`
+	Batches         int    `json:"batches"`
+	Done            int    `json:"done"`
+	Pending         int    `json:"pending"`
+	Failed          int    `json:"failed"`
+	Records         int    `json:"records"`
+	RecordsImported int    `json:"recordsImported"`
+}
+
+// ImportBatchStatus is the import state of a single batch file.
+type ImportBatchStatus struct {
+	File      string     `json:"file"`
+	Type      string     `json:"type"`
+	Batch     int        `json:"batch"`
+	Records   int        `json:"records"`
+	Status    string     `json:"status"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"` // Time of the latest journal entry
+	Error     string     `json:"error,omitempty"`
+}
+
+// runImportStatus executes the import status command
+func runImportStatus(cmd *cobra.Command, args []string) error {
+	if !containsString(validStatusFormats, importStatusFormat) {
+		return fmt.Errorf("invalid format: %s (valid: %s)", importStatusFormat, strings.Join(validStatusFormats, ", "))
+	}
+
+	status, err := loadImportStatus(resolveImportDir(importStatusDir))
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	switch importStatusFormat {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	case "markdown":
+		return writeImportStatusMarkdown(out, status)
+	default:
+		return writeImportStatusText(out, status)
+	}
+}
+
+// runImportMark executes the import mark command
+func runImportMark(cmd *cobra.Command, args []string) error {
+	switch importMarkStatus {
+	case batchStatusDone, batchStatusFailed, batchStatusPending:
+	default:
+		return fmt.Errorf("invalid status: %s (valid: done, failed, pending)", importMarkStatus)
+	}
+
+	importDir := resolveImportDir(importMarkDir)
+	if err := checkImportDirEncrypted(importDir); err != nil {
+		return err
+	}
+	batches, err := listBatchFiles(importDir)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	entries := make([]ImportJournalEntry, 0, len(args))
+	for _, arg := range args {
+		name := filepath.Base(arg)
+		if !batchFilePattern.MatchString(name) {
+			return fmt.Errorf("'%s' is not an import batch file", arg)
+		}
+		if !containsString(batches, name) {
+			return fmt.Errorf("batch file '%s' not found in '%s'", name, importDir)
+		}
+		entries = append(entries, ImportJournalEntry{Time: now, Batch: name, Status: importMarkStatus, Error: importMarkError})
+	}
+
+	if err := appendImportJournal(importDir, entries); err != nil {
+		return err
+	}
+	slog.Info("Recorded import journal entries", "status", importMarkStatus, "batches", len(entries))
+	return nil
+}
+
+// resolveImportDir returns the import directory of an export directory. A path
+// that already is an import directory (it holds batch_summary.json) is used as is.
+func resolveImportDir(dir string) string {
+	for _, name := range []string{"batch_summary.json", "batch_summary.json" + ageSuffix} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return dir
+		}
+	}
+	return filepath.Join(dir, "import")
+}
+
+// checkImportDirEncrypted returns an error if the batch files in importDir
+// were written by an export with --encrypt, as they cannot be read.
+func checkImportDirEncrypted(importDir string) error {
+	encrypted, _ := filepath.Glob(filepath.Join(importDir, "batch_*.json"+ageSuffix))
+	if len(encrypted) > 0 {
+		return fmt.Errorf("import batches in '%s' are encrypted; use a copy made by the decrypt command", importDir)
+	}
+	return nil
+}
+
+// listBatchFiles returns the names of the batch files in importDir, as
+// listed in batch_summary.json. Without a summary listing them, as written
+// before batch file lists were recorded, the directory is listed instead.
+func listBatchFiles(importDir string) ([]string, error) {
+	var summary BatchSummary
+	err := readJSONFile(filepath.Join(importDir, "batch_summary.json"), &summary)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading batch summary in '%s': %w", importDir, err)
+	}
+	names := append(append(append([]string{}, summary.WorkoutBatchFiles...), summary.StateOfMindBatchFiles...), summary.MetricBatchFiles...)
+	if len(names) > 0 {
+		return names, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(importDir, "batch_*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("listing batch files in '%s': %w", importDir, err)
+	}
+	for _, file := range files {
+		names = append(names, filepath.Base(file))
+	}
+	return names, nil
+}
+
+// loadImportStatus reads the batch files and import journal in importDir.
+func loadImportStatus(importDir string) (*ImportStatus, error) {
+	if err := checkImportDirEncrypted(importDir); err != nil {
+		return nil, err
+	}
+	names, err := listBatchFiles(importDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []ImportBatchStatus
+	for _, name := range names {
+		match := batchFilePattern.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		batchNum, _ := strconv.Atoi(match[1])
+		records, err := countBatchRecords(filepath.Join(importDir, name))
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, ImportBatchStatus{
+			File:    name,
+			Type:    match[2],
+			Batch:   batchNum,
+			Records: records,
+			Status:  batchStatusPending,
+		})
+	}
+	if len(batches) == 0 {
+		return nil, fmt.Errorf("no import batches found in '%s'", importDir)
+	}
+
+	journal, err := readImportJournal(importDir)
+	if err != nil {
+		return nil, err
+	}
+	applyImportJournal(batches, journal)
+
+	typeOrder := make(map[string]int, len(importBatchTypes))
+	for i, t := range importBatchTypes {
+		typeOrder[t.dataType] = i
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		if batches[i].Type != batches[j].Type {
+			return typeOrder[batches[i].Type] < typeOrder[batches[j].Type]
+		}
+		return batches[i].Batch < batches[j].Batch
+	})
+
+	return summarizeImportStatus(importDir, batches), nil
+}
+
+// countBatchRecords returns the number of memories in a batch file, which may
+// be a bare array or an ImportBatch envelope.
+func countBatchRecords(filename string) (int, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, fmt.Errorf("reading batch file '%s': %w", filename, err)
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var memories []json.RawMessage
+		if err := json.Unmarshal(data, &memories); err != nil {
+			return 0, fmt.Errorf("parsing batch file '%s': %w", filename, err)
+		}
+		return len(memories), nil
+	}
+
+	var envelope struct {
+		Memories []json.RawMessage `json:"memories"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return 0, fmt.Errorf("parsing batch file '%s': %w", filename, err)
+	}
+	return len(envelope.Memories), nil
+}
+
+// readImportJournal reads the import journal in importDir. A missing journal
+// means nothing has been imported yet. Malformed lines, such as one cut short
+// by an interrupted import, are skipped with a warning.
+func readImportJournal(importDir string) ([]ImportJournalEntry, error) {
+	path := filepath.Join(importDir, importJournalFile)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening import journal: %w", err)
+	}
+	defer file.Close()
+
+	var entries []ImportJournalEntry
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry ImportJournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil || entry.Batch == "" {
+			slog.Warn("Skipping malformed import journal entry", "file", path, "line", lineNum)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading import journal: %w", err)
+	}
+	return entries, nil
+}
+
+// appendImportJournal appends entries to the import journal in importDir.
+func appendImportJournal(importDir string, entries []ImportJournalEntry) error {
+	file, err := os.OpenFile(filepath.Join(importDir, importJournalFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening import journal: %w", err)
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			return fmt.Errorf("writing import journal: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("writing import journal: %w", err)
+	}
+	return nil
+}
+
+// applyImportJournal sets each batch's status from its latest journal entry.
+// Entries for unknown batches, e.g. from an earlier export, are ignored.
+func applyImportJournal(batches []ImportBatchStatus, journal []ImportJournalEntry) {
+	index := make(map[string]int, len(batches))
+	for i, batch := range batches {
+		index[batch.File] = i
+	}
+
+	for _, entry := range journal {
+		i, ok := index[entry.Batch]
+		if !ok {
+			slog.Debug("Ignoring journal entry for unknown batch", "batch", entry.Batch)
+			continue
+		}
+		switch entry.Status {
+		case batchStatusDone, batchStatusFailed, batchStatusPending:
+		default:
+			slog.Warn("Ignoring journal entry with unknown status", "batch", entry.Batch, "status", entry.Status)
+			continue
+		}
+
+		entryTime := entry.Time
+		batches[i].Status = entry.Status
+		batches[i].UpdatedAt = &entryTime
+		batches[i].Error = ""
+		if entry.Status == batchStatusFailed {
+			batches[i].Error = entry.Error
+		}
+	}
+}
+
+// summarizeImportStatus totals batch and record counts per data type.
+func summarizeImportStatus(importDir string, batches []ImportBatchStatus) *ImportStatus {
+	status := &ImportStatus{
+		ImportDir: importDir,
+		Total:     ImportTypeStatus{Type: "total"},
+		Batches:   batches,
+	}
+
+	for _, t := range importBatchTypes {
+		totals := ImportTypeStatus{Type: t.dataType}
+		for _, batch := range batches {
+			if batch.Type == t.dataType {
+				totals.add(batch)
+				status.Total.add(batch)
+			}
+		}
+		if totals.Batches > 0 {
+			status.Types = append(status.Types, totals)
+		}
+	}
+	return status
+}
+
+// add counts a batch towards the totals.
+func (s *ImportTypeStatus) add(batch ImportBatchStatus) {
+	s.Batches++
+	s.Records += batch.Records
+	switch batch.Status {
+	case batchStatusDone:
+		s.Done++
+		s.RecordsImported += batch.Records
+	case batchStatusFailed:
+		s.Failed++
+	default:
+		s.Pending++
+	}
+}
+
+// percentImported returns the share of records imported, from 0 to 100.
+func (s ImportTypeStatus) percentImported() float64 {
+	if s.Records == 0 {
+		return 0
+	}
+	return float64(s.RecordsImported) / float64(s.Records) * 100
+}
+
+// importTypeLabel returns the display label for a batch data type.
+func importTypeLabel(dataType string) string {
+	for _, t := range importBatchTypes {
+		if t.dataType == dataType {
+			return t.label
+		}
+	}
+	return titleCase(dataType)
+}
+
+// writeImportStatusText writes a plain-text progress report.
+func writeImportStatusText(w io.Writer, status *ImportStatus) error {
+	fmt.Fprintf(w, "Import status: %s\n\n", status.ImportDir)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tBATCHES\tDONE\tPENDING\tFAILED\tRECORDS\tIMPORTED")
+	for _, t := range append(status.Types, status.Total) {
+		label := importTypeLabel(t.Type)
+		if t.Type == "total" {
+			label = "Total"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n", label, t.Batches, t.Done, t.Pending, t.Failed, t.Records, t.RecordsImported)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n%.0f%% of records imported\n", status.Total.percentImported())
+
+	// List the batches that still need attention
+	var outstanding []ImportBatchStatus
+	for _, batch := range status.Batches {
+		if batch.Status != batchStatusDone {
+			outstanding = append(outstanding, batch)
+		}
+	}
+	if len(outstanding) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w, "\nOutstanding batches:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, batch := range outstanding {
+		fmt.Fprintf(tw, "  %s\t%s\t%d records", batch.Status, batch.File, batch.Records)
+		if batch.Error != "" {
+			fmt.Fprintf(tw, "\t%s", batch.Error)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// writeImportStatusMarkdown writes a markdown progress report with a checklist
+// of batches per data type.
+func writeImportStatusMarkdown(w io.Writer, status *ImportStatus) error {
+	var md strings.Builder
+
+	md.WriteString("# Import Status\n\n")
+	md.WriteString(fmt.Sprintf("**Import directory:** `%s`  \n", status.ImportDir))
+	md.WriteString(fmt.Sprintf("**Progress:** %d of %d records imported (%.0f%%)\n\n",
+		status.Total.RecordsImported, status.Total.Records, status.Total.percentImported()))
+
+	md.WriteString("| Type | Batches | Done | Pending | Failed | Records | Imported |\n")
+	md.WriteString("|------|--------:|-----:|--------:|-------:|--------:|---------:|\n")
+	for _, t := range status.Types {
+		md.WriteString(fmt.Sprintf("| %s | %d | %d | %d | %d | %d | %d |\n",
+			importTypeLabel(t.Type), t.Batches, t.Done, t.Pending, t.Failed, t.Records, t.RecordsImported))
+	}
+	t := status.Total
+	md.WriteString(fmt.Sprintf("| **Total** | **%d** | **%d** | **%d** | **%d** | **%d** | **%d** |\n",
+		t.Batches, t.Done, t.Pending, t.Failed, t.Records, t.RecordsImported))
+
+	for _, typeStatus := range status.Types {
+		md.WriteString(fmt.Sprintf("\n## %s\n\n", importTypeLabel(typeStatus.Type)))
+		for _, batch := range status.Batches {
+			if batch.Type != typeStatus.Type {
+				continue
+			}
+			check := " "
+			if batch.Status == batchStatusDone {
+				check = "x"
+			}
+			md.WriteString(fmt.Sprintf("- [%s] `%s` (%d records)", check, batch.File, batch.Records))
+			switch {
+			case batch.Status == batchStatusFailed && batch.Error != "":
+				md.WriteString(fmt.Sprintf(" — **failed:** %s", batch.Error))
+			case batch.Status == batchStatusFailed:
+				md.WriteString(" — **failed**")
+			case batch.UpdatedAt != nil && batch.Status == batchStatusDone:
+				md.WriteString(fmt.Sprintf(" — imported %s", batch.UpdatedAt.Format("2006-01-02 15:04")))
+			}
+			md.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, md.String())
+	return err
+}
+
+// containsString reports whether values contains s.
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestFile writes content to name in dir, failing the test on error.
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+		t.Fatalf("creating directory for %s: %v", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+}
+
+func TestCountBatchRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{name: "bare array", content: `[{"type":"workout_log"},{"type":"workout_log"}]`, want: 2},
+		{name: "envelope", content: `{"batch":1,"count":3,"memories":[{},{},{}]}`, want: 3},
+		{name: "empty array", content: `[]`, want: 0},
+		{name: "invalid json", content: `[{`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, dir, "batch_1_workouts.json", tt.content)
+
+			got, err := countBatchRecords(filepath.Join(dir, "batch_1_workouts.json"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("countBatchRecords() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("countBatchRecords() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadImportStatus(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "batch_summary.json", `{}`)
+	writeTestFile(t, dir, "batch_1_workouts.json", `[{},{}]`)
+	writeTestFile(t, dir, "batch_2_workouts.json", `[{}]`)
+	writeTestFile(t, dir, "batch_1_state_of_mind_2025-11.json", `{"memories":[{},{},{}]}`)
+	writeTestFile(t, dir, "batch_1_metrics.json", `[{},{},{},{}]`)
+	writeTestFile(t, dir, "batch_10_metrics.json", `[{}]`)
+	writeTestFile(t, dir, "batch_2_metrics.json", `[{}]`)
+	writeTestFile(t, dir, importJournalFile, strings.Join([]string{
+		`{"time":"2025-11-17T18:00:00Z","batch":"batch_1_workouts.json","status":"done"}`,
+		`{"time":"2025-11-17T18:01:00Z","batch":"batch_2_workouts.json","status":"failed","error":"timeout"}`,
+		`not json`,
+		`{"time":"2025-11-17T18:02:00Z","batch":"batch_1_metrics.json","status":"failed"}`,
+		`{"time":"2025-11-17T18:03:00Z","batch":"batch_1_metrics.json","status":"done"}`,
+		`{"time":"2025-11-17T18:04:00Z","batch":"batch_9_workouts.json","status":"done"}`,
+		`{"time":"2025-11-17T18:05:00Z","batch":"batch_2_metrics.json","status":"skipped"}`,
+		`{"time":"2025-11-17T18:06:00Z","batch":"batch_1_state_`,
+	}, "\n"))
+
+	status, err := loadImportStatus(dir)
+	if err != nil {
+		t.Fatalf("loadImportStatus() error = %v", err)
+	}
+
+	// Batches are ordered by type, then numerically by batch number
+	var files []string
+	for _, batch := range status.Batches {
+		files = append(files, batch.File)
+	}
+	wantFiles := []string{
+		"batch_1_workouts.json", "batch_2_workouts.json",
+		"batch_1_state_of_mind_2025-11.json",
+		"batch_1_metrics.json", "batch_2_metrics.json", "batch_10_metrics.json",
+	}
+	if strings.Join(files, ",") != strings.Join(wantFiles, ",") {
+		t.Errorf("batch order = %v, want %v", files, wantFiles)
+	}
+
+	wantTypes := []ImportTypeStatus{
+		{Type: "workouts", Batches: 2, Done: 1, Failed: 1, Records: 3, RecordsImported: 2},
+		{Type: "state_of_mind", Batches: 1, Pending: 1, Records: 3},
+		{Type: "metrics", Batches: 3, Done: 1, Pending: 2, Records: 6, RecordsImported: 4},
+	}
+	if len(status.Types) != len(wantTypes) {
+		t.Fatalf("len(Types) = %v, want %v", len(status.Types), len(wantTypes))
+	}
+	for i, want := range wantTypes {
+		if status.Types[i] != want {
+			t.Errorf("Types[%d] = %+v, want %+v", i, status.Types[i], want)
+		}
+	}
+
+	wantTotal := ImportTypeStatus{Type: "total", Batches: 6, Done: 2, Pending: 3, Failed: 1, Records: 12, RecordsImported: 6}
+	if status.Total != wantTotal {
+		t.Errorf("Total = %+v, want %+v", status.Total, wantTotal)
+	}
+
+	if got := status.Batches[1].Error; got != "timeout" {
+		t.Errorf("failed batch error = %q, want %q", got, "timeout")
+	}
+	if got := status.Batches[3].Error; got != "" {
+		t.Errorf("error after later success = %q, want empty", got)
+	}
+}
+
+func TestLoadImportStatusFromSummary(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "batch_summary.json", `{"workout_batch_files": ["batch_1_workouts.json"]}`)
+	writeTestFile(t, dir, "batch_1_workouts.json", `[{},{}]`)
+	// Left by an earlier export
+	writeTestFile(t, dir, "batch_2_workouts.json", `[{}]`)
+
+	status, err := loadImportStatus(dir)
+	if err != nil {
+		t.Fatalf("loadImportStatus() error = %v", err)
+	}
+	if len(status.Batches) != 1 || status.Batches[0].File != "batch_1_workouts.json" {
+		t.Errorf("batches = %+v, want only batch_1_workouts.json", status.Batches)
+	}
+
+	previousDir := importMarkDir
+	defer func() { importMarkDir = previousDir }()
+	importMarkDir = dir
+	if err := runImportMark(importMarkCmd, []string{"batch_2_workouts.json"}); err == nil {
+		t.Error("runImportMark() accepted a batch file not in the batch summary")
+	}
+}
+
+func TestLoadImportStatusNoBatches(t *testing.T) {
+	if _, err := loadImportStatus(t.TempDir()); err == nil {
+		t.Error("loadImportStatus() expected error for directory without batches")
+	}
+}
+
+func TestImportEncryptedBatches(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "batch_summary.json"+ageSuffix, "age")
+	writeTestFile(t, dir, "batch_1_workouts.json"+ageSuffix, "age")
+
+	_, err := loadImportStatus(dir)
+	if err == nil || !strings.Contains(err.Error(), "encrypted") {
+		t.Errorf("loadImportStatus() error = %v, want encrypted export error", err)
+	}
+
+	previousDir := importMarkDir
+	defer func() { importMarkDir = previousDir }()
+	importMarkDir = dir
+	err = runImportMark(importMarkCmd, []string{"batch_1_workouts.json"})
+	if err == nil || !strings.Contains(err.Error(), "encrypted") {
+		t.Errorf("runImportMark() error = %v, want encrypted export error", err)
+	}
+}
+
+func TestResolveImportDir(t *testing.T) {
+	exportDir := t.TempDir()
+	importDir := filepath.Join(exportDir, "import")
+	if err := os.Mkdir(importDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, importDir, "batch_summary.json", `{}`)
+
+	if got := resolveImportDir(exportDir); got != importDir {
+		t.Errorf("resolveImportDir(export) = %v, want %v", got, importDir)
+	}
+	if got := resolveImportDir(importDir); got != importDir {
+		t.Errorf("resolveImportDir(import) = %v, want %v", got, importDir)
+	}
+}
+
+func TestAppendImportJournal(t *testing.T) {
+	dir := t.TempDir()
+	when := time.Date(2025, 11, 17, 18, 0, 0, 0, time.UTC)
+
+	for _, status := range []string{batchStatusFailed, batchStatusDone} {
+		entry := ImportJournalEntry{Time: when, Batch: "batch_1_metrics.json", Status: status}
+		if err := appendImportJournal(dir, []ImportJournalEntry{entry}); err != nil {
+			t.Fatalf("appendImportJournal() error = %v", err)
+		}
+	}
+
+	entries, err := readImportJournal(dir)
+	if err != nil {
+		t.Fatalf("readImportJournal() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("len(entries) = %v, want 2", len(entries))
+	}
+	if entries[1].Status != batchStatusDone || !entries[1].Time.Equal(when) {
+		t.Errorf("entries[1] = %+v, want done at %v", entries[1], when)
+	}
+}
+
+func TestWriteImportStatusReports(t *testing.T) {
+	updated := time.Date(2025, 11, 17, 18, 40, 0, 0, time.UTC)
+	status := summarizeImportStatus("exports/import", []ImportBatchStatus{
+		{File: "batch_1_workouts.json", Type: "workouts", Batch: 1, Records: 20, Status: batchStatusDone, UpdatedAt: &updated},
+		{File: "batch_1_metrics.json", Type: "metrics", Batch: 1, Records: 10, Status: batchStatusFailed, Error: "timeout"},
+		{File: "batch_2_metrics.json", Type: "metrics", Batch: 2, Records: 10, Status: batchStatusPending},
+	})
+
+	tests := []struct {
+		name  string
+		write func(*bytes.Buffer) error
+		want  []string
+	}{
+		{
+			name:  "text",
+			write: func(b *bytes.Buffer) error { return writeImportStatusText(b, status) },
+			want: []string{
+				"Import status: exports/import",
+				"Workouts  1        1     0        0       20       20",
+				"Total     3        1     1        1       40       20",
+				"50% of records imported",
+				"failed   batch_1_metrics.json  10 records  timeout",
+				"pending  batch_2_metrics.json  10 records",
+			},
+		},
+		{
+			name:  "markdown",
+			write: func(b *bytes.Buffer) error { return writeImportStatusMarkdown(b, status) },
+			want: []string{
+				"**Progress:** 20 of 40 records imported (50%)",
+				"| Metrics | 2 | 0 | 1 | 1 | 20 | 0 |",
+				"| **Total** | **3** | **1** | **1** | **1** | **40** | **20** |",
+				"- [x] `batch_1_workouts.json` (20 records) — imported 2025-11-17 18:40",
+				"- [ ] `batch_1_metrics.json` (10 records) — **failed:** timeout",
+				"- [ ] `batch_2_metrics.json` (10 records)\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := tt.write(&out); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// localeFS holds the built-in message catalogs, one JSON file per language.
+//
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// defaultLocale is the language used when no --locale is given and for
+// messages missing from another catalog.
+const defaultLocale = "en"
+
+// localeName is the --locale flag value.
+var localeName string
+
+// Locale is a message catalog with the date and number conventions of one language.
+type Locale struct {
+	Code string `json:"-"`
+	Name string `json:"name"` // Native language name (e.g., "Deutsch")
+
+	// Date layouts use Go reference-time layouts, with {month}, {monthShort}
+	// and {weekday} placeholders for localized names
+	DateFormats struct {
+		Long   string `json:"long"`   // e.g., "{month} 2, 2006"
+		Medium string `json:"medium"` // e.g., "{monthShort} 2, 2006"
+		Short  string `json:"short"`  // e.g., "{monthShort} 2"
+		Clock  string `json:"clock"`  // e.g., "15:04:05"
+	} `json:"dateFormats"`
+
+	Months      []string `json:"months"`      // January..December
+	MonthsShort []string `json:"monthsShort"` // Jan..Dec
+	Weekdays    []string `json:"weekdays"`    // Sunday..Saturday
+
+	DecimalSeparator string `json:"decimalSeparator"`
+	GroupSeparator   string `json:"groupSeparator"` // Thousands separator; empty disables grouping
+
+	Messages map[string]string `json:"messages"`
+
+	fallback *Locale
+}
+
+var (
+	// locales holds the built-in catalogs keyed by language code.
+	locales = mustLoadLocales()
+
+	// activeLocale is the locale used to render memory content.
+	activeLocale = locales[defaultLocale]
+)
+
+// mustLoadLocales parses the embedded message catalogs. Every catalog other
+// than the default falls back to the default catalog for missing messages.
+func mustLoadLocales() map[string]*Locale {
+	files, err := fs.Glob(localeFS, "locales/*.json")
+	if err != nil {
+		panic(fmt.Sprintf("listing locales: %v", err))
+	}
+
+	loaded := make(map[string]*Locale, len(files))
+	for _, file := range files {
+		data, err := localeFS.ReadFile(file)
+		if err != nil {
+			panic(fmt.Sprintf("reading locale %s: %v", file, err))
+		}
+		loc := &Locale{}
+		if err := json.Unmarshal(data, loc); err != nil {
+			panic(fmt.Sprintf("parsing locale %s: %v", file, err))
+		}
+		if len(loc.Months) != 12 || len(loc.MonthsShort) != 12 || len(loc.Weekdays) != 7 {
+			panic(fmt.Sprintf("locale %s: expected 12 months and 7 weekdays", file))
+		}
+		loc.Code = strings.TrimSuffix(path.Base(file), ".json")
+		loaded[loc.Code] = loc
+	}
+
+	base, ok := loaded[defaultLocale]
+	if !ok {
+		panic("default locale catalog is missing")
+	}
+	for code, loc := range loaded {
+		if code != defaultLocale {
+			loc.fallback = base
+		}
+	}
+	return loaded
+}
+
+// availableLocales returns the sorted codes of the built-in locales.
+func availableLocales() []string {
+	codes := make([]string, 0, len(locales))
+	for code := range locales {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// lookupLocale resolves a locale name such as "de", "de-DE" or "ja_JP.UTF-8"
+// to a built-in catalog by its language code.
+func lookupLocale(name string) (*Locale, error) {
+	if name == "" {
+		return locales[defaultLocale], nil
+	}
+	code := strings.ToLower(name)
+	if i := strings.IndexAny(code, "-_."); i >= 0 {
+		code = code[:i]
+	}
+	if loc, ok := locales[code]; ok {
+		return loc, nil
+	}
+	return nil, fmt.Errorf("unsupported locale: %s (available: %s)", name, strings.Join(availableLocales(), ", "))
+}
+
+// message returns the catalog entry for key, falling back to the default
+// catalog, or "" if no catalog defines it.
+func (l *Locale) message(key string) string {
+	for loc := l; loc != nil; loc = loc.fallback {
+		if msg, ok := loc.Messages[key]; ok {
+			return msg
+		}
+	}
+	return ""
+}
+
+// T formats the message for key with args. Unknown keys render as the key itself
+// so missing translations are visible rather than silently empty.
+func (l *Locale) T(key string, args ...interface{}) string {
+	msg := l.message(key)
+	if msg == "" {
+		return key
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Lookup returns the localized name for value within a message group
+// (e.g., Lookup("workout", "Outdoor Walk")), or "" if there is none.
+func (l *Locale) Lookup(group, value string) string {
+	return l.message(group + "." + value)
+}
+
+// FormatDate formats t using a layout with localized name placeholders.
+func (l *Locale) FormatDate(t time.Time, layout string) string {
+	var out strings.Builder
+	for layout != "" {
+		start := strings.IndexByte(layout, '{')
+		end := strings.IndexByte(layout, '}')
+		if start < 0 || end < start {
+			out.WriteString(t.Format(layout))
+			break
+		}
+		if start > 0 {
+			out.WriteString(t.Format(layout[:start]))
+		}
+		switch layout[start+1 : end] {
+		case "month":
+			out.WriteString(l.Months[t.Month()-1])
+		case "monthShort":
+			out.WriteString(l.MonthsShort[t.Month()-1])
+		case "weekday":
+			out.WriteString(l.Weekdays[t.Weekday()])
+		default:
+			out.WriteString(layout[start : end+1])
+		}
+		layout = layout[end+1:]
+	}
+	return out.String()
+}
+
+// FormatNumber formats value with a fixed number of decimal places using the
+// locale's decimal and thousands separators.
+func (l *Locale) FormatNumber(precision int, value float64) string {
+	s := formatFixed(precision, value)
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, fracPart, hasFrac := strings.Cut(s, ".")
+
+	if l.GroupSeparator != "" && len(intPart) > 3 {
+		var grouped strings.Builder
+		lead := len(intPart) % 3
+		if lead > 0 {
+			grouped.WriteString(intPart[:lead])
+		}
+		for i := lead; i < len(intPart); i += 3 {
+			if grouped.Len() > 0 {
+				grouped.WriteString(l.GroupSeparator)
+			}
+			grouped.WriteString(intPart[i : i+3])
+		}
+		intPart = grouped.String()
+	}
+
+	if !hasFrac {
+		return sign + intPart
+	}
+	return sign + intPart + l.DecimalSeparator + fracPart
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupLocale(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantCode string
+		wantErr  bool
+	}{
+		{name: "default", input: "", wantCode: "en"},
+		{name: "language code", input: "de", wantCode: "de"},
+		{name: "region suffix", input: "de-DE", wantCode: "de"},
+		{name: "posix locale", input: "ja_JP.UTF-8", wantCode: "ja"},
+		{name: "upper case", input: "JA", wantCode: "ja"},
+		{name: "unsupported", input: "fr", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lookupLocale(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("lookupLocale() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.Code != tt.wantCode {
+				t.Errorf("lookupLocale() = %v, want %v", got.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestLocaleCatalogsComplete(t *testing.T) {
+	base := locales[defaultLocale]
+	for code, loc := range locales {
+		if code == defaultLocale {
+			continue
+		}
+		for key := range base.Messages {
+			if _, ok := loc.Messages[key]; !ok {
+				t.Errorf("locale %s is missing message %q", code, key)
+			}
+		}
+	}
+}
+
+func TestLocaleFormatDate(t *testing.T) {
+	date := time.Date(2025, 3, 7, 9, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		code   string
+		long   string
+		medium string
+		short  string
+	}{
+		{code: "en", long: "March 7, 2025", medium: "Mar 7, 2025", short: "Mar 7"},
+		{code: "de", long: "7. März 2025", medium: "7. März 2025", short: "7. März"},
+		{code: "ja", long: "2025年3月7日", medium: "2025年3月7日", short: "3月7日"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			loc := locales[tt.code]
+			if got := loc.FormatDate(date, loc.DateFormats.Long); got != tt.long {
+				t.Errorf("long = %v, want %v", got, tt.long)
+			}
+			if got := loc.FormatDate(date, loc.DateFormats.Medium); got != tt.medium {
+				t.Errorf("medium = %v, want %v", got, tt.medium)
+			}
+			if got := loc.FormatDate(date, loc.DateFormats.Short); got != tt.short {
+				t.Errorf("short = %v, want %v", got, tt.short)
+			}
+		})
+	}
+
+	if got := locales["de"].FormatDate(date, "{weekday}, 2. {month}"); got != "Freitag, 7. März" {
+		t.Errorf("weekday placeholder = %v, want Freitag, 7. März", got)
+	}
+}
+
+func TestLocaleFormatNumber(t *testing.T) {
+	tests := []struct {
+		code      string
+		precision int
+		value     float64
+		want      string
+	}{
+		{code: "en", precision: 2, value: 12345.678, want: "12345.68"},
+		{code: "de", precision: 2, value: 12345.678, want: "12.345,68"},
+		{code: "de", precision: 0, value: 1234567, want: "1.234.567"},
+		{code: "de", precision: 1, value: -0.25, want: "-0,2"},
+		{code: "ja", precision: 1, value: 1500, want: "1,500.0"},
+		{code: "ja", precision: 0, value: 999, want: "999"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code+"_"+tt.want, func(t *testing.T) {
+			if got := locales[tt.code].FormatNumber(tt.precision, tt.value); got != tt.want {
+				t.Errorf("FormatNumber() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalizedMemoryContent(t *testing.T) {
+	activeLocale = locales["de"]
+	defer func() { activeLocale = locales[defaultLocale] }()
+
+	summary := createStateOfMindSummary(StateOfMind{
+		ID:                    "S1",
+		Kind:                  "daily_mood",
+		Start:                 time.Date(2025, 11, 17, 21, 0, 0, 0, time.UTC),
+		Valence:               0.5,
+		ValenceClassification: "pleasant",
+	})
+
+	if want := "Tagesstimmung - 17. November 2025"; summary.MemoryContent.Title != want {
+		t.Errorf("Title = %v, want %v", summary.MemoryContent.Title, want)
+	}
+	if want := "Tagesstimmung erfasst als angenehm (Valenz: 0,50)"; summary.MemoryContent.Summary != want {
+		t.Errorf("Summary = %v, want %v", summary.MemoryContent.Summary, want)
+	}
+	if !strings.Contains(summary.MemoryContent.Markdown, "## Einordnung\n") {
+		t.Errorf("Markdown is not localized:\n%s", summary.MemoryContent.Markdown)
+	}
+	// Metadata stays locale-independent for filtering
+	if summary.ImportMetadata.DayOfWeek != "Monday" {
+		t.Errorf("DayOfWeek = %v, want Monday", summary.ImportMetadata.DayOfWeek)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// formatAuto selects the input format by sniffing the input.
+const formatAuto = "auto"
+
+// sniffSize is how many leading bytes of an input are offered to Sniff.
+// Apple's export.xml carries a long DTD, but names its root element in the
+// DOCTYPE declaration on the second line.
+const sniffSize = 4096
+
+// Parser decodes one input format into health data.
+type Parser interface {
+	// Name is the format name accepted by --input-format.
+	Name() string
+	// Description describes the format in a few words.
+	Description() string
+	// Sniff reports whether head, the first bytes of an uncompressed input,
+	// look like this format.
+	Sniff(head []byte) bool
+	// Parse decodes a whole input.
+	Parse(r io.Reader) (HealthData, error)
+}
+
+// archiveParser is implemented by parsers whose format is a zip archive as a
+// whole, rather than a set of independent entries.
+type archiveParser interface {
+	Parser
+	// SniffArchive reports whether the archive is in this format.
+	SniffArchive(zr *zip.Reader) bool
+	// ParseArchive decodes the archive.
+	ParseArchive(zr *zip.Reader) (HealthData, error)
+}
+
+// parsers are the supported input formats, in detection order.
+var parsers = []Parser{
+	healthyAppsJSONParser{},
+	healthyAppsCSVParser{},
+	appleHealthParser{},
+}
+
+// formatNames returns the names of the supported input formats.
+func formatNames() []string {
+	names := make([]string, 0, len(parsers))
+	for _, p := range parsers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// supportedFormats describes the supported input formats for error messages.
+func supportedFormats() string {
+	descriptions := make([]string, 0, len(parsers))
+	for _, p := range parsers {
+		descriptions = append(descriptions, fmt.Sprintf("%s (%s)", p.Name(), p.Description()))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// validateInputFormat checks an --input-format value.
+func validateInputFormat(format string) error {
+	if format == formatAuto {
+		return nil
+	}
+	_, err := lookupParser(format)
+	return err
+}
+
+// lookupParser returns the parser for a format name.
+func lookupParser(format string) (Parser, error) {
+	for _, p := range parsers {
+		if p.Name() == format {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid input format: %s (valid: %s, %s)", format, formatAuto, strings.Join(formatNames(), ", "))
+}
+
+// selectParser returns the parser for format, or when format is "auto" the
+// first parser whose Sniff accepts head.
+func selectParser(format string, head []byte) (Parser, error) {
+	if format != formatAuto {
+		return lookupParser(format)
+	}
+	for _, p := range parsers {
+		if p.Sniff(head) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unrecognized input format; supported formats: %s (use --input-format to choose one)", supportedFormats())
+}
+
+// selectArchiveParser returns the parser that reads the archive as a whole,
+// if format names one or, when format is "auto", one recognizes it.
+func selectArchiveParser(format string, zr *zip.Reader) (archiveParser, bool) {
+	for _, p := range parsers {
+		ap, ok := p.(archiveParser)
+		if !ok {
+			continue
+		}
+		if p.Name() == format || format == formatAuto && ap.SniffArchive(zr) {
+			return ap, true
+		}
+	}
+	return nil, false
+}
+
+// trimHead strips a byte order mark and leading whitespace from head.
+func trimHead(head []byte) []byte {
+	return bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+}
+
+// healthyAppsJSONParser reads the JSON exports of the HealthyApps Health Auto
+// Export app.
+type healthyAppsJSONParser struct{}
+
+func (healthyAppsJSONParser) Name() string        { return "healthyapps-json" }
+func (healthyAppsJSONParser) Description() string { return "Health Auto Export JSON" }
+
+func (healthyAppsJSONParser) Sniff(head []byte) bool {
+	return bytes.HasPrefix(trimHead(head), []byte("{"))
+}
+
+func (healthyAppsJSONParser) Parse(r io.Reader) (HealthData, error) {
+	return decodeHealthAutoExportJSON(r)
+}
+
+// appleHealthParser reads the Health app's export.zip, or a bare export.xml.
+type appleHealthParser struct{}
+
+func (appleHealthParser) Name() string        { return "apple-health" }
+func (appleHealthParser) Description() string { return "Health app export.zip or export.xml" }
+
+func (appleHealthParser) Sniff(head []byte) bool {
+	head = trimHead(head)
+	return bytes.HasPrefix(head, []byte("<")) &&
+		(bytes.Contains(head, []byte("<!DOCTYPE HealthData")) || bytes.Contains(head, []byte("<HealthData")))
+}
+
+func (appleHealthParser) Parse(r io.Reader) (HealthData, error) {
+	return decodeAppleXML(r)
+}
+
+func (appleHealthParser) SniffArchive(zr *zip.Reader) bool {
+	for _, entry := range zr.File {
+		if isAppleExportEntry(entry.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (appleHealthParser) ParseArchive(zr *zip.Reader) (HealthData, error) {
+	return decodeAppleZip(zr)
+}
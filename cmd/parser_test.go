@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelectParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		head    string
+		want    string
+		wantErr string
+	}{
+		{name: "json", format: formatAuto, head: `{"data": {"metrics": []}}`, want: "healthyapps-json"},
+		{name: "json with bom and whitespace", format: formatAuto, head: "\xef\xbb\xbf\n  {\"data\": {}}", want: "healthyapps-json"},
+		{name: "apple export.xml", format: formatAuto, head: testAppleExportXML, want: "apple-health"},
+		{name: "other xml", format: formatAuto, head: `<?xml version="1.0"?><ClinicalDocument/>`, wantErr: "unrecognized input format"},
+		{name: "metrics csv", format: formatAuto, head: "Date/Time,Step Count (count)\n2025-11-10 08:00:00,1000\n", want: "healthyapps-csv"},
+		{name: "workouts csv", format: formatAuto, head: "Workout Type,Start,End\n", want: "healthyapps-csv"},
+		{name: "other csv", format: formatAuto, head: "Name,Email\nJane,jane@example.com\n", wantErr: "apple-health (Health app export.zip or export.xml)"},
+		{name: "forced format", format: "apple-health", head: `{"data": {}}`, want: "apple-health"},
+		{name: "unknown format", format: "fitbit", head: `{}`, wantErr: "invalid input format: fitbit (valid: auto, healthyapps-json, healthyapps-csv, apple-health"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := selectParser(tt.format, []byte(tt.head))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("selectParser() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectParser() error = %v", err)
+			}
+			if parser.Name() != tt.want {
+				t.Errorf("selectParser() = %s, want %s", parser.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadHealthDataInputFormat(t *testing.T) {
+	dir := t.TempDir()
+	xmlSource := filepath.Join(dir, "export.xml")
+	if err := os.WriteFile(xmlSource, []byte(testAppleExportXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A zip mixing both formats is decoded entry by entry
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"health.json":      `{"data": {"workouts": [{"id": "W9", "name": "Yoga", "start": "2025-11-12 07:00:00 -0500", "end": "2025-11-12 07:30:00 -0500"}]}}`,
+		"apple/health.xml": testAppleExportXML,
+		"notes.txt":        "not an export",
+	} {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	w.Close()
+	zipSource := filepath.Join(dir, "mixed.zip")
+	if err := os.WriteFile(zipSource, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		source       string
+		format       string
+		wantWorkouts int
+		wantErr      bool
+	}{
+		{name: "detected", source: xmlSource, format: formatAuto, wantWorkouts: 2},
+		{name: "forced", source: xmlSource, format: "apple-health", wantWorkouts: 2},
+		{name: "forced wrong format", source: xmlSource, format: "healthyapps-json", wantErr: true},
+		{name: "mixed zip", source: zipSource, format: formatAuto, wantWorkouts: 3},
+		{name: "mixed zip forced", source: zipSource, format: "healthyapps-json", wantWorkouts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthData, err := loadHealthData(tt.source, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadHealthData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(healthData.Data.Workouts) != tt.wantWorkouts {
+				t.Errorf("loaded %d workouts, want %d", len(healthData.Data.Workouts), tt.wantWorkouts)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunWorkers(t *testing.T) {
+	results := make([]int, 100)
+	err := runWorkers(context.Background(), 4, len(results), func(ctx context.Context, i int) error {
+		results[i] = i * i
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("runWorkers() error = %v", err)
+	}
+	for i, got := range results {
+		if got != i*i {
+			t.Fatalf("results[%d] = %d, want %d", i, got, i*i)
+		}
+	}
+
+	if err := runWorkers(context.Background(), 4, 0, nil); err != nil {
+		t.Errorf("runWorkers() with no work error = %v", err)
+	}
+}
+
+func TestRunWorkersStopsOnFirstError(t *testing.T) {
+	errBoom := errors.New("boom")
+	for _, workers := range []int{1, 4} {
+		var calls atomic.Int32
+		err := runWorkers(context.Background(), workers, 1000, func(ctx context.Context, i int) error {
+			calls.Add(1)
+			if i == 0 {
+				return errBoom
+			}
+			return nil
+		})
+		if !errors.Is(err, errBoom) {
+			t.Errorf("runWorkers() with %d workers error = %v, want %v", workers, err, errBoom)
+		}
+		if n := calls.Load(); n == 1000 || workers == 1 && n != 1 {
+			t.Errorf("runWorkers() with %d workers made %d calls, want the rest skipped after the error", workers, n)
+		}
+	}
+}
+
+func TestExportDataDeterministicAcrossWorkers(t *testing.T) {
+	previous := exportWorkers
+	defer func() { exportWorkers = previous }()
+
+	manifests := make([]*ExportManifest, 0, 2)
+	for _, workers := range []int{1, 8} {
+		exportWorkers = workers
+		dir := t.TempDir()
+		if err := exportData(context.Background(), HealthData{Data: testHealthData()}, exportSource{}, dir); err != nil {
+			t.Fatalf("exportData() with %d workers error = %v", workers, err)
+		}
+		manifest, _, err := loadExportDir(dir)
+		if err != nil {
+			t.Fatalf("loadExportDir() error = %v", err)
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	one, many := manifests[0], manifests[1]
+	if !reflect.DeepEqual(one.Metrics, many.Metrics) ||
+		!reflect.DeepEqual(one.Workouts, many.Workouts) ||
+		!reflect.DeepEqual(one.StateOfMind, many.StateOfMind) ||
+		!reflect.DeepEqual(one.WorkoutDetails, many.WorkoutDetails) {
+		t.Errorf("manifest file lists differ between 1 and 8 workers:\n%+v\n%+v", one, many)
+	}
+}
+
+func TestExportDataCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := exportData(ctx, HealthData{Data: testHealthData()}, exportSource{}, t.TempDir())
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("exportData() error = %v, want %v", err, context.Canceled)
+	}
+}
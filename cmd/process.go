@@ -4,12 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"time"
 
+	"filippo.io/age"
 	"github.com/rs/xid"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -17,6 +21,7 @@ import (
 
 var (
 	sourceFile         string
+	inputFormat        string
 	exportDir          string
 	targetCollections  []string
 	batchSizeWorkouts  int
@@ -24,8 +29,23 @@ var (
 	batchSizeMetrics   int
 	generateImportScript bool
 	memoryBinaryPath   string
+	batchEnvelope      bool
+	groupBy            string
+	exportWorkers      int
+	exportClean        bool
 )
 
+// Memory types assigned to generated memories and advertised in the manifest.
+const (
+	memoryTypeWorkout     = "workout_log"
+	memoryTypeMetric      = "health_metric"
+	memoryTypeStateOfMind = "mental_health_log"
+)
+
+// safeBatchSizeChars is the recommended upper bound for a single import batch,
+// sized to fit comfortably in a model context window.
+const safeBatchSizeChars = 75000
+
 // processCmd represents the process command
 var processCmd = &cobra.Command{
 	Use:   "process",
@@ -50,14 +70,24 @@ func init() {
 	rootCmd.AddCommand(processCmd)
 
 	// Command-specific flags
-	processCmd.Flags().StringVarP(&sourceFile, "source", "s", "", "source JSON file to process (required)")
+	processCmd.Flags().StringVarP(&sourceFile, "source", "s", "", "source export file (JSON, CSV or Apple Health), optionally .gz, .zst or .zip compressed, or - for stdin (required)")
+	processCmd.Flags().StringVar(&inputFormat, "input-format", formatAuto, "input format: "+formatAuto+" (detect), "+strings.Join(formatNames(), ", "))
 	processCmd.Flags().StringVarP(&exportDir, "export", "e", "exports", "directory to export processed data")
+	processCmd.Flags().IntVar(&exportWorkers, "workers", runtime.NumCPU(), "number of records exported concurrently")
+	processCmd.Flags().BoolVar(&exportClean, "clean", false, "also remove files in the export subdirectories that earlier runs left untracked")
+	addEncryptionFlags(processCmd)
 
 	// MCP import configuration
 	processCmd.Flags().StringSliceVarP(&targetCollections, "collections", "c", []string{}, "target collections for MCP import (comma-separated)")
 	processCmd.Flags().IntVar(&batchSizeWorkouts, "batch-size-workouts", 20, "batch size for workout records")
 	processCmd.Flags().IntVar(&batchSizeSOM, "batch-size-som", 20, "batch size for state of mind records")
 	processCmd.Flags().IntVar(&batchSizeMetrics, "batch-size-metrics", 10, "batch size for metric records")
+	processCmd.Flags().StringVar(&groupBy, "group-by", "", "group import batches by week, month, workout-type or metric-family (default: sequential)")
+	processCmd.Flags().BoolVar(&batchEnvelope, "batch-envelope", false, "wrap import batches in an envelope with batch number, description and counts")
+
+	// Memory content templates
+	processCmd.Flags().StringVar(&templateDir, "template-dir", "", "directory of *.tmpl files overriding the built-in memory content templates")
+	processCmd.Flags().StringVar(&localeName, "locale", defaultLocale, "language for memory content (en, de, ja)")
 
 	// Import script generation
 	processCmd.Flags().BoolVar(&generateImportScript, "generate-import-script", false, "generate MCP Memory import script (import.sh)")
@@ -69,10 +99,17 @@ func init() {
 	// Bind flags to viper
 	viper.BindPFlag("source", processCmd.Flags().Lookup("source"))
 	viper.BindPFlag("export", processCmd.Flags().Lookup("export"))
+	viper.BindPFlag("input-format", processCmd.Flags().Lookup("input-format"))
+	viper.BindPFlag("workers", processCmd.Flags().Lookup("workers"))
+	viper.BindPFlag("clean", processCmd.Flags().Lookup("clean"))
 	viper.BindPFlag("collections", processCmd.Flags().Lookup("collections"))
 	viper.BindPFlag("batch-size-workouts", processCmd.Flags().Lookup("batch-size-workouts"))
 	viper.BindPFlag("batch-size-som", processCmd.Flags().Lookup("batch-size-som"))
 	viper.BindPFlag("batch-size-metrics", processCmd.Flags().Lookup("batch-size-metrics"))
+	viper.BindPFlag("batch-envelope", processCmd.Flags().Lookup("batch-envelope"))
+	viper.BindPFlag("group-by", processCmd.Flags().Lookup("group-by"))
+	viper.BindPFlag("template-dir", processCmd.Flags().Lookup("template-dir"))
+	viper.BindPFlag("locale", processCmd.Flags().Lookup("locale"))
 	viper.BindPFlag("generate-import-script", processCmd.Flags().Lookup("generate-import-script"))
 	viper.BindPFlag("memory-binary", processCmd.Flags().Lookup("memory-binary"))
 }
@@ -85,26 +122,22 @@ func runProcess(cmd *cobra.Command, args []string) error {
 	source := viper.GetString("source")
 	export := viper.GetString("export")
 
-	// Validate source file exists
-	if _, err := os.Stat(source); os.IsNotExist(err) {
+	// Validate source file exists; "-" reads standard input
+	if _, err := os.Stat(source); source != stdinSource && os.IsNotExist(err) {
 		return fmt.Errorf("source file '%s' does not exist", source)
 	}
 
-	// Generate trace ID for this execution
-	traceID := xid.New().String()
+	// Apply batch grouping, routing, locale and template settings
+	if err := configureExport(); err != nil {
+		return err
+	}
 
-	// Add trace ID and version to logger
-	logger := slog.Default().With(
-		"trace_id", traceID,
-		"version", GetVersion().ShortString(),
-		"pid", os.Getpid(),
-	)
+	// Generate trace ID for this execution and add it to the logger
+	logger, traceID := newTraceLogger()
 	slog.SetDefault(logger)
 
-	// Add trace ID to context
-	type contextKey string
-	const traceIDKey contextKey = "trace_id"
-	ctx = context.WithValue(ctx, traceIDKey, traceID)
+	// Add trace ID to context, for the manifest
+	ctx = withTraceID(ctx, traceID)
 
 	// Log startup information
 	logger.Info("Starting Apple Health Export Parser",
@@ -125,189 +158,515 @@ func runProcess(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// configureExport applies the input format, batch grouping, collection
+// routing, locale and template settings shared by every command that runs the
+// export pipeline.
+func configureExport() error {
+	// Validate the input format
+	if err := validateInputFormat(inputFormat); err != nil {
+		return err
+	}
+
+	// Validate batch grouping strategy
+	if err := validateGroupBy(groupBy); err != nil {
+		return err
+	}
+
+	if exportWorkers < 1 {
+		return fmt.Errorf("invalid workers: %d (must be at least 1)", exportWorkers)
+	}
+
+	// Set up encryption of export files, if requested
+	enc, err := newExportEncrypter(encryptExport, encryptRecipients, encryptRecipientsFile, viper.GetString("passphrase"), encryptPlainManifest)
+	if err != nil {
+		return err
+	}
+	exportEncryption = enc
+	if enc != nil && generateImportScript {
+		// import.sh reads the batch files, which are encrypted
+		return fmt.Errorf("--generate-import-script cannot be used with --encrypt, as import.sh needs plain batch files")
+	}
+
+	// Load the redaction policy from the config file
+	policy, err := loadRedactionPolicy(viper.GetViper())
+	if err != nil {
+		return err
+	}
+	redaction = policy
+
+	// Load collection routing rules from the config file
+	rules, err := loadRoutingRules(viper.GetViper())
+	if err != nil {
+		return err
+	}
+	routingRules = rules
+
+	// Select the language for memory content
+	loc, err := lookupLocale(localeName)
+	if err != nil {
+		return err
+	}
+	activeLocale = loc
+
+	// Load user memory content templates, if configured
+	if templateDir != "" {
+		tmpl, err := loadMemoryTemplates(templateDir)
+		if err != nil {
+			return fmt.Errorf("loading templates: %w", err)
+		}
+		memoryTemplates = tmpl
+	}
+
+	return nil
+}
+
+// newTraceLogger returns the default logger tagged with a new trace ID, the
+// version and the process ID, along with the trace ID.
+func newTraceLogger() (*slog.Logger, string) {
+	traceID := xid.New().String()
+	logger := slog.Default().With(
+		"trace_id", traceID,
+		"version", GetVersion().ShortString(),
+		"pid", os.Getpid(),
+	)
+	return logger, traceID
+}
+
+// contextKey keys the values this package stores in a context.
+type contextKey string
+
+// traceIDKey holds the trace ID of an execution in its context.
+const traceIDKey contextKey = "trace_id"
+
+// withTraceID returns a copy of ctx carrying traceID.
+func withTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey, traceID)
+}
+
+// traceIDFromContext returns the trace ID carried by ctx, or "" if none.
+func traceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey).(string)
+	return traceID
+}
+
 // processHealthData reads and processes the Apple Health export file
 func processHealthData(ctx context.Context, source, export string) error {
 	slog.Info("Processing health data")
 
-	// Open and parse the source file
-	file, err := os.Open(source)
+	healthData, digest, err := loadHealthDataDigest(source, inputFormat)
 	if err != nil {
-		return fmt.Errorf("opening source file: %w", err)
-	}
-	defer file.Close()
-
-	var healthData HealthData
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&healthData); err != nil {
-		return fmt.Errorf("decoding JSON: %w", err)
+		return err
 	}
 
 	// Process and export the data
-	return exportData(healthData, export)
+	return exportData(ctx, healthData, exportSource{Path: source, SHA256: digest}, export)
+}
+
+// exportSource identifies the source of an export in its manifest.
+type exportSource struct {
+	Path   string
+	SHA256 string // Hex SHA-256 of the source file as read
 }
 
-func exportData(healthData HealthData, exportDir string) error {
+// exportData writes the per-record files, the import batches and the manifest
+// for healthData into exportDir. The files are staged and moved into place
+// only once all were written, and the manifest records the SHA-256 of each
+// and of the source. Cancelling ctx stops the export.
+func exportData(ctx context.Context, healthData HealthData, source exportSource, exportDir string) error {
 	// Initialize manifest
 	manifest := &ExportManifest{
-		GeneratedAt: time.Now(),
+		GeneratedAt: exportTime(),
+		SourceFile:   source.Path,
+		SourceSHA256: source.SHA256,
 		Version:     GetVersion().ShortString(),
+		TraceID:     traceIDFromContext(ctx),
 		Metrics:     []string{},
 		Workouts:    []string{},
 		StateOfMind: []string{},
 	}
 
-	// Get trace ID from context if available
-	if ctx := context.Background(); ctx.Value("trace_id") != nil {
-		manifest.TraceID = ctx.Value("trace_id").(string)
+	// Redact before anything is written, so that export files, summaries
+	// and memories agree
+	if redaction.active() {
+		policy := redaction
+		manifest.Redaction = &policy
+		healthData.Data = redaction.apply(healthData.Data)
+		healthData.Extras = redaction.redactExtras(healthData.Extras)
+		slog.Info("Applied redaction policy", "gps", redaction.GPS, "drop_sources", redaction.DropSources)
 	}
 
-	if err := exportMetrics(healthData.Data.Metrics, exportDir, manifest); err != nil {
+	// Write into a staging directory so a failed export leaves the previous
+	// one intact
+	stage, err := newExportStage(exportDir)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+	staged := stage.dir
+
+	if err := exportMetrics(ctx, healthData.Data.Metrics, staged, manifest); err != nil {
 		return fmt.Errorf("exporting metrics: %w", err)
 	}
 
-	if err := exportWorkouts(healthData.Data.Workouts, exportDir, manifest); err != nil {
+	workoutSummaries, err := exportWorkouts(ctx, healthData.Data.Workouts, staged, manifest)
+	if err != nil {
 		return fmt.Errorf("exporting workouts: %w", err)
 	}
 
-	if err := exportStateOfMind(healthData.Data.StateOfMind, exportDir, manifest); err != nil {
+	if err := exportStateOfMind(ctx, healthData.Data.StateOfMind, staged, manifest); err != nil {
 		return fmt.Errorf("exporting state of mind data: %w", err)
 	}
 
-	if err := exportOtherData(healthData.Data.ECG, "ecg", exportDir); err != nil {
+	if err := exportOtherData(healthData.Data.ECG, "ecg", staged); err != nil {
 		return fmt.Errorf("exporting ECG data: %w", err)
 	}
 
-	if err := exportOtherData(healthData.Data.HeartRateNotifications, "heart_rate_notifications", exportDir); err != nil {
+	if err := exportOtherData(healthData.Data.HeartRateNotifications, "heart_rate_notifications", staged); err != nil {
 		return fmt.Errorf("exporting heart rate notifications: %w", err)
 	}
 
-	if err := exportOtherData(healthData.Data.Symptoms, "symptoms", exportDir); err != nil {
+	if err := exportOtherData(healthData.Data.Symptoms, "symptoms", staged); err != nil {
 		return fmt.Errorf("exporting symptoms data: %w", err)
 	}
 
+	if err := exportExtraData(healthData, staged); err != nil {
+		return fmt.Errorf("exporting uninterpreted data: %w", err)
+	}
+
 	// Set summary counts
 	manifest.Summary.TotalMetrics = len(healthData.Data.Metrics)
 	manifest.Summary.TotalWorkouts = len(healthData.Data.Workouts)
 	manifest.Summary.TotalStateOfMind = len(healthData.Data.StateOfMind)
 
-	// Export manifest
-	manifestFile := filepath.Join(exportDir, "manifest.json")
-	if err := exportToJSON(manifest, manifestFile); err != nil {
-		return fmt.Errorf("exporting manifest: %w", err)
-	}
-
-	slog.Info("Exported manifest", "file", manifestFile)
+	// Compute date range and import hints so clients can plan from the manifest alone
+	populateDateRange(manifest, healthData.Data)
+	populateImportHints(manifest, healthData.Data, staged)
+	manifest.Extras = countExtras(healthData)
 
 	// Generate import batches for MCP Memory server
-	if err := generateImportBatches(healthData.Data, exportDir); err != nil {
+	if err := generateImportBatches(healthData.Data, workoutSummaries, staged); err != nil {
 		slog.Warn("Failed to generate import batches", "error", err)
 		// Don't fail the entire export if batch generation fails
 	}
 
+	// Store the key of a passphrase-encrypted export
+	if err := writeExportIdentity(staged); err != nil {
+		return fmt.Errorf("writing export key: %w", err)
+	}
+	manifest.Encrypted = exportEncryption != nil
+
+	// Record the hash of every file so the export can be verified later
+	manifest.Files, err = hashExportFiles(staged)
+	if err != nil {
+		return fmt.Errorf("hashing exported files: %w", err)
+	}
+
+	// Export manifest, readable if configured when the export is encrypted
+	manifestFile := filepath.Join(staged, manifestFileName)
+	if exportEncryption != nil && exportEncryption.plainManifest {
+		err = writeJSONFile(manifest, manifestFile, nil)
+	} else {
+		err = exportToJSON(manifest, manifestFile)
+	}
+	if err != nil {
+		return fmt.Errorf("exporting manifest: %w", err)
+	}
+
+	// Move the export into place, the manifest last
+	if err := stage.commit(exportClean); err != nil {
+		return fmt.Errorf("committing export: %w", err)
+	}
+
+	slog.Info("Exported manifest", "file", filepath.Join(exportDir, manifestFileName))
 	return nil
 }
 
-func exportMetrics(metrics []Metric, exportDir string, manifest *ExportManifest) error {
+
+// populateDateRange records the earliest and latest timestamps found across
+// metrics, workouts and state of mind records.
+func populateDateRange(manifest *ExportManifest, data Data) {
+	var earliest, latest time.Time
+	observe := func(t time.Time) {
+		if t.IsZero() {
+			return
+		}
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+		if latest.IsZero() || t.After(latest) {
+			latest = t
+		}
+	}
+
+	for _, metric := range data.Metrics {
+		for _, record := range metric.Data {
+			observe(record.Date)
+		}
+	}
+	for _, workout := range data.Workouts {
+		observe(workout.Start)
+		observe(workout.End)
+	}
+	for _, som := range data.StateOfMind {
+		observe(som.Start)
+		observe(som.End)
+	}
+
+	if earliest.IsZero() {
+		return
+	}
+
+	manifest.DateRange.Earliest = earliest
+	manifest.DateRange.Latest = latest
+
+	// Count calendar days inclusively, in the timezone of the earliest record
+	first := time.Date(earliest.Year(), earliest.Month(), earliest.Day(), 0, 0, 0, 0, earliest.Location())
+	last := latest.In(earliest.Location())
+	last = time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, earliest.Location())
+	manifest.DateRange.TotalDays = int(last.Sub(first).Hours()/24) + 1
+}
+
+// populateImportHints fills in the manifest's import hints: recommended memory
+// types, batch recommendations, data quality counts and size estimates.
+// Size estimates are taken from the files already written to exportDir.
+func populateImportHints(manifest *ExportManifest, data Data, exportDir string) {
+	hints := &manifest.ImportHints
+
+	hints.RecommendedMemoryTypes.Workouts = memoryTypeWorkout
+	hints.RecommendedMemoryTypes.Metrics = memoryTypeMetric
+	hints.RecommendedMemoryTypes.StateOfMind = memoryTypeStateOfMind
+
+	metricTypes := 0
+	for _, metric := range data.Metrics {
+		if len(metric.Data) > 0 {
+			metricTypes++
+		}
+	}
+
+	workouts := &hints.BatchRecommendations.Workouts
+	workouts.TotalItems = len(data.Workouts)
+	workouts.SuggestedBatchSize = batchSizeWorkouts
+	workouts.EstimatedBatches = estimateBatches(len(data.Workouts), batchSizeWorkouts)
+	workouts.GroupingOptions = []string{"week", "month", "workout-type"}
+
+	metrics := &hints.BatchRecommendations.Metrics
+	metrics.TotalTypes = metricTypes
+	metrics.SuggestedBatchSize = batchSizeMetrics
+	metrics.GroupingOptions = []string{"week", "month", "metric-family"}
+
+	som := &hints.BatchRecommendations.StateOfMind
+	som.TotalItems = len(data.StateOfMind)
+	som.SuggestedBatchSize = batchSizeSOM
+	som.EstimatedBatches = estimateBatches(len(data.StateOfMind), batchSizeSOM)
+
+	for _, workout := range data.Workouts {
+		if len(workout.HeartRateData) > 0 {
+			hints.DataQuality.WorkoutsWithHeartRate++
+		}
+		if len(workout.StepCount) > 0 {
+			hints.DataQuality.WorkoutsWithSteps++
+		}
+		if len(workout.HeartRateRecovery) > 0 {
+			hints.DataQuality.WorkoutsWithRecovery++
+		}
+	}
+
+	estimates := &hints.ContextWindowEstimates
+	estimates.WorkoutSummaryAvgChars = averageFileSize(exportDir, manifest.Workouts)
+	estimates.MetricFileAvgChars = averageFileSize(exportDir, manifest.Metrics)
+	estimates.StateOfMindAvgChars = averageFileSize(exportDir, manifest.StateOfMind)
+	estimates.SafeBatchSizeChars = safeBatchSizeChars
+}
+
+// estimateBatches returns the number of batches needed for total items at the given batch size.
+func estimateBatches(total, batchSize int) int {
+	if total == 0 || batchSize <= 0 {
+		return 0
+	}
+	return (total + batchSize - 1) / batchSize
+}
+
+// averageFileSize returns the average size in bytes of the given files,
+// which are relative to exportDir. Files that cannot be read are skipped.
+func averageFileSize(exportDir string, relFiles []string) int {
+	var total int64
+	var count int64
+	for _, rel := range relFiles {
+		info, err := os.Stat(filepath.Join(exportDir, storedName(rel)))
+		if err != nil {
+			slog.Debug("Skipping file in size estimate", "file", rel, "error", err)
+			continue
+		}
+		total += info.Size()
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return int(total / count)
+}
+
+func exportMetrics(ctx context.Context, metrics []Metric, exportDir string, manifest *ExportManifest) error {
 	metricsDir := filepath.Join(exportDir, "metrics")
 	if err := os.MkdirAll(metricsDir, 0755); err != nil {
 		return fmt.Errorf("creating metrics directory: %w", err)
 	}
 
-	for _, metric := range metrics {
+	// Name files in metric order, so names do not depend on scheduling
+	namer := newFileNamer()
+	files := make([]string, len(metrics))
+	for i, metric := range metrics {
 		if len(metric.Data) > 0 {
-			timestamp := metric.Data[0].Date.Format("2006-01-02_15-04-05")
-			relFilename := fmt.Sprintf("metrics/%s_%s.json", timestamp, sanitizeFilename(metric.Name))
-			filename := filepath.Join(exportDir, relFilename)
+			timestamp := metric.Data[0].Date.Format(fileTimestampLayout)
+			files[i] = fmt.Sprintf("metrics/%s.json", namer.name("metrics", timestamp+"_"+sanitizeFilename(metric.Name)))
+		}
+	}
 
-			if err := exportToJSON(metric, filename); err != nil {
-				return fmt.Errorf("exporting metric %s: %w", metric.Name, err)
-			}
-			manifest.Metrics = append(manifest.Metrics, relFilename)
+	err := runWorkers(ctx, exportWorkers, len(metrics), func(ctx context.Context, i int) error {
+		if files[i] == "" {
+			return nil
 		}
+		if err := exportToJSON(metrics[i], filepath.Join(exportDir, files[i])); err != nil {
+			return fmt.Errorf("exporting metric %s: %w", metrics[i].Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	manifest.Metrics = appendNonEmpty(manifest.Metrics, files)
 
 	slog.Info("Exported metrics", "count", len(metrics))
 	return nil
 }
 
-func exportWorkouts(workouts []Workout, exportDir string, manifest *ExportManifest) error {
+// workoutDetailFiles are the time-series files exported for each workout
+// under workout_details/, with the manifest list each is recorded in.
+var workoutDetailFiles = []struct {
+	name     string
+	records  func(w Workout) (data interface{}, count int)
+	manifest func(m *ExportManifest) *[]string
+}{
+	{
+		name:     "heart_rate",
+		records:  func(w Workout) (interface{}, int) { return w.HeartRateData, len(w.HeartRateData) },
+		manifest: func(m *ExportManifest) *[]string { return &m.WorkoutDetails.HeartRate },
+	},
+	{
+		name:     "heart_rate_recovery",
+		records:  func(w Workout) (interface{}, int) { return w.HeartRateRecovery, len(w.HeartRateRecovery) },
+		manifest: func(m *ExportManifest) *[]string { return &m.WorkoutDetails.HeartRateRecovery },
+	},
+	{
+		name:     "active_energy",
+		records:  func(w Workout) (interface{}, int) { return w.ActiveEnergy, len(w.ActiveEnergy) },
+		manifest: func(m *ExportManifest) *[]string { return &m.WorkoutDetails.Energy },
+	},
+	{
+		name:     "step_count",
+		records:  func(w Workout) (interface{}, int) { return w.StepCount, len(w.StepCount) },
+		manifest: func(m *ExportManifest) *[]string { return &m.WorkoutDetails.Steps },
+	},
+}
+
+// exportedWorkout is the result of exporting one workout.
+type exportedWorkout struct {
+	summaryFile string
+	detailFiles []string // Indexed like workoutDetailFiles; "" when the workout has no such records
+}
+
+// exportWorkouts writes a summary file and time-series detail files for each
+// workout, exportWorkers workouts at a time. It returns the summaries, in the
+// order of workouts, for generating import batches.
+func exportWorkouts(ctx context.Context, workouts []Workout, exportDir string, manifest *ExportManifest) ([]WorkoutSummary, error) {
 	workoutsDir := filepath.Join(exportDir, "workouts")
 	workoutDetailsDir := filepath.Join(exportDir, "workout_details")
 
 	// Create base directories
 	if err := os.MkdirAll(workoutsDir, 0755); err != nil {
-		return fmt.Errorf("creating workouts directory: %w", err)
+		return nil, fmt.Errorf("creating workouts directory: %w", err)
 	}
 	if err := os.MkdirAll(workoutDetailsDir, 0755); err != nil {
-		return fmt.Errorf("creating workout_details directory: %w", err)
+		return nil, fmt.Errorf("creating workout_details directory: %w", err)
+	}
+
+	// Name files in workout order, so names do not depend on scheduling
+	namer := newFileNamer()
+	baseFilenames := make([]string, len(workouts))
+	for i, workout := range workouts {
+		base := recordFileBase(workout.Start, workout.Name, shortID(workout.ID, workout))
+		baseFilenames[i] = namer.name("workouts", base)
 	}
 
-	for _, workout := range workouts {
-		timestamp := workout.Start.Format("2006-01-02_15-04-05")
-		baseFilename := fmt.Sprintf("%s_%s", timestamp, sanitizeFilename(workout.Name))
+	summaries := make([]WorkoutSummary, len(workouts))
+	results := make([]exportedWorkout, len(workouts))
+	err := runWorkers(ctx, exportWorkers, len(workouts), func(ctx context.Context, i int) error {
+		workout := workouts[i]
+		baseFilename := baseFilenames[i]
 
 		// Create workout summary
-		summary := createWorkoutSummary(workout)
+		summaries[i] = createWorkoutSummary(workout)
 		relSummaryFilename := fmt.Sprintf("workouts/%s_summary.json", baseFilename)
 		summaryFilename := filepath.Join(exportDir, relSummaryFilename)
-		if err := exportToJSON(summary, summaryFilename); err != nil {
+		if err := exportToJSON(summaries[i], summaryFilename); err != nil {
 			return fmt.Errorf("exporting workout summary %s: %w", workout.Name, err)
 		}
-		manifest.Workouts = append(manifest.Workouts, relSummaryFilename)
+		result := exportedWorkout{
+			summaryFile: relSummaryFilename,
+			detailFiles: make([]string, len(workoutDetailFiles)),
+		}
 
 		// Export detail files for time-series data
 		detailsSubdir := filepath.Join(workoutDetailsDir, baseFilename)
 		if err := os.MkdirAll(detailsSubdir, 0755); err != nil {
 			return fmt.Errorf("creating workout details directory: %w", err)
 		}
-
-		// Export heart rate data if present
-		if len(workout.HeartRateData) > 0 {
-			relHrFile := fmt.Sprintf("workout_details/%s/heart_rate.json", baseFilename)
-			hrFile := filepath.Join(exportDir, relHrFile)
-			if err := exportToJSON(workout.HeartRateData, hrFile); err != nil {
-				return fmt.Errorf("exporting heart rate data: %w", err)
+		for j, detail := range workoutDetailFiles {
+			records, count := detail.records(workout)
+			if count == 0 {
+				continue
 			}
-			manifest.WorkoutDetails.HeartRate = append(manifest.WorkoutDetails.HeartRate, relHrFile)
-			slog.Debug("Exported heart rate data", "workout", workout.Name, "points", len(workout.HeartRateData))
-		}
-
-		// Export heart rate recovery data if present
-		if len(workout.HeartRateRecovery) > 0 {
-			relHrrFile := fmt.Sprintf("workout_details/%s/heart_rate_recovery.json", baseFilename)
-			hrrFile := filepath.Join(exportDir, relHrrFile)
-			if err := exportToJSON(workout.HeartRateRecovery, hrrFile); err != nil {
-				return fmt.Errorf("exporting heart rate recovery data: %w", err)
+			if err := ctx.Err(); err != nil {
+				return err
 			}
-			manifest.WorkoutDetails.HeartRateRecovery = append(manifest.WorkoutDetails.HeartRateRecovery, relHrrFile)
-			slog.Debug("Exported heart rate recovery data", "workout", workout.Name, "points", len(workout.HeartRateRecovery))
-		}
-
-		// Export active energy data if present
-		if len(workout.ActiveEnergy) > 0 {
-			relEnergyFile := fmt.Sprintf("workout_details/%s/active_energy.json", baseFilename)
-			energyFile := filepath.Join(exportDir, relEnergyFile)
-			if err := exportToJSON(workout.ActiveEnergy, energyFile); err != nil {
-				return fmt.Errorf("exporting active energy data: %w", err)
+			relFile := fmt.Sprintf("workout_details/%s/%s.json", baseFilename, detail.name)
+			if err := exportToJSON(records, filepath.Join(exportDir, relFile)); err != nil {
+				return fmt.Errorf("exporting %s data: %w", strings.ReplaceAll(detail.name, "_", " "), err)
 			}
-			manifest.WorkoutDetails.Energy = append(manifest.WorkoutDetails.Energy, relEnergyFile)
-			slog.Debug("Exported active energy data", "workout", workout.Name, "points", len(workout.ActiveEnergy))
+			result.detailFiles[j] = relFile
+			slog.Debug("Exported workout detail", "workout", workout.Name, "detail", detail.name, "points", count)
 		}
 
-		// Export step count data if present
-		if len(workout.StepCount) > 0 {
-			relStepsFile := fmt.Sprintf("workout_details/%s/step_count.json", baseFilename)
-			stepsFile := filepath.Join(exportDir, relStepsFile)
-			if err := exportToJSON(workout.StepCount, stepsFile); err != nil {
-				return fmt.Errorf("exporting step count data: %w", err)
+		results[i] = result
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Record files in workout order, however the writes were scheduled
+	for _, result := range results {
+		manifest.Workouts = append(manifest.Workouts, result.summaryFile)
+		for j, detail := range workoutDetailFiles {
+			if result.detailFiles[j] != "" {
+				list := detail.manifest(manifest)
+				*list = append(*list, result.detailFiles[j])
 			}
-			manifest.WorkoutDetails.Steps = append(manifest.WorkoutDetails.Steps, relStepsFile)
-			slog.Debug("Exported step count data", "workout", workout.Name, "points", len(workout.StepCount))
 		}
 	}
 
 	slog.Info("Exported workouts", "count", len(workouts))
-	return nil
+	return summaries, nil
+}
+
+// appendNonEmpty appends the non-empty strings of values to list.
+func appendNonEmpty(list, values []string) []string {
+	for _, value := range values {
+		if value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
 }
 
 // createWorkoutSummary generates a summary view of a workout with aggregated statistics.
@@ -327,6 +686,7 @@ func createWorkoutSummary(w Workout) WorkoutSummary {
 		HasLocation:       w.Location != nil,
 		HasRoute:          w.Route != nil,
 		Metadata:          w.Metadata,
+		Extras:            w.Extras,
 
 		ActiveEnergyCount:      len(w.ActiveEnergy),
 		HeartRateDataCount:     len(w.HeartRateData),
@@ -371,7 +731,7 @@ func createWorkoutSummary(w Workout) WorkoutSummary {
 
 	// Generate memory content (must be done after all stats are calculated)
 	summary.MemoryContent = MemoryContent{
-		Title:    fmt.Sprintf("%s - %s", w.Name, w.Start.Format("January 2, 2006")),
+		Title:    generateWorkoutTitle(summary),
 		Summary:  generateWorkoutSummaryText(summary),
 		Markdown: generateWorkoutMarkdown(summary),
 	}
@@ -502,22 +862,30 @@ func calculateDistanceStats(records []DistanceRecord) *Statistics {
 	return stats
 }
 
-func exportStateOfMind(stateOfMind []StateOfMind, exportDir string, manifest *ExportManifest) error {
+func exportStateOfMind(ctx context.Context, stateOfMind []StateOfMind, exportDir string, manifest *ExportManifest) error {
 	somDir := filepath.Join(exportDir, "state_of_mind")
 	if err := os.MkdirAll(somDir, 0755); err != nil {
 		return fmt.Errorf("creating state of mind directory: %w", err)
 	}
 
-	for _, som := range stateOfMind {
-		timestamp := som.Start.Format("2006-01-02_15-04-05")
-		relFilename := fmt.Sprintf("state_of_mind/%s_%s.json", timestamp, sanitizeFilename(som.Kind))
-		filename := filepath.Join(exportDir, relFilename)
+	// Name files in record order, so names do not depend on scheduling
+	namer := newFileNamer()
+	files := make([]string, len(stateOfMind))
+	for i, som := range stateOfMind {
+		base := recordFileBase(som.Start, som.Kind, shortID(som.ID, som))
+		files[i] = fmt.Sprintf("state_of_mind/%s.json", namer.name("state_of_mind", base))
+	}
 
-		if err := exportToJSON(som, filename); err != nil {
+	err := runWorkers(ctx, exportWorkers, len(stateOfMind), func(ctx context.Context, i int) error {
+		if err := exportToJSON(stateOfMind[i], filepath.Join(exportDir, files[i])); err != nil {
 			return fmt.Errorf("exporting state of mind record: %w", err)
 		}
-		manifest.StateOfMind = append(manifest.StateOfMind, relFilename)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	manifest.StateOfMind = append(manifest.StateOfMind, files...)
 
 	slog.Info("Exported state of mind records", "count", len(stateOfMind))
 	return nil
@@ -533,9 +901,12 @@ func exportOtherData(data []interface{}, name string, exportDir string) error {
 		return fmt.Errorf("creating %s directory: %w", name, err)
 	}
 
+	// Records are named by their own time and a hash of their content, so the
+	// same records always get the same names
+	namer := newFileNamer()
 	for i, item := range data {
-		timestamp := time.Now().Format("2006-01-02_15-04-05")
-		filename := filepath.Join(dataDir, fmt.Sprintf("%s_%s_%03d.json", timestamp, name, i+1))
+		base := recordFileBase(recordTime(item), name, contentHash(item)[:shortIDLength])
+		filename := filepath.Join(dataDir, namer.name(name, base)+".json")
 
 		if err := exportToJSON(item, filename); err != nil {
 			return fmt.Errorf("exporting %s record %d: %w", name, i+1, err)
@@ -546,19 +917,80 @@ func exportOtherData(data []interface{}, name string, exportDir string) error {
 	return nil
 }
 
+// exportExtraData writes the fields of the source the parser does not
+// interpret into other/: each unknown data category, such as a new
+// medications array, to data_<key>.json and the unknown top-level fields to
+// document.json, so the export holds everything the source did.
+func exportExtraData(healthData HealthData, exportDir string) error {
+	if len(healthData.Data.Extras) == 0 && len(healthData.Extras) == 0 {
+		return nil
+	}
+
+	dataDir := filepath.Join(exportDir, otherDataDir)
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("creating %s directory: %w", otherDataDir, err)
+	}
+
+	keys := make([]string, 0, len(healthData.Data.Extras))
+	for key := range healthData.Data.Extras {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		filename := filepath.Join(dataDir, "data_"+groupSuffix(key)+".json")
+		if err := exportToJSON(healthData.Data.Extras[key], filename); err != nil {
+			return fmt.Errorf("exporting data.%s: %w", key, err)
+		}
+	}
+
+	if len(healthData.Extras) > 0 {
+		if err := exportToJSON(healthData.Extras, filepath.Join(dataDir, "document.json")); err != nil {
+			return fmt.Errorf("exporting top-level fields: %w", err)
+		}
+	}
+
+	slog.Info("Exported uninterpreted data", "categories", len(keys), "top_level_fields", len(healthData.Extras))
+	return nil
+}
+
+// exportToJSON writes data as indented JSON to filename, or encrypted to
+// filename.age when exports are encrypted.
 func exportToJSON(data interface{}, filename string) error {
+	if exportEncryption != nil {
+		return writeJSONFile(data, filename+ageSuffix, exportEncryption.recipients)
+	}
+	return writeJSONFile(data, filename, nil)
+}
+
+// writeJSONFile writes data as indented JSON to filename, encrypted to
+// recipients if there are any.
+func writeJSONFile(data interface{}, filename string, recipients []age.Recipient) error {
 	file, err := os.Create(filename)
 	if err != nil {
 		return fmt.Errorf("creating file: %w", err)
 	}
 	defer file.Close()
 
-	encoder := json.NewEncoder(file)
+	var w io.Writer = file
+	var encrypted io.WriteCloser
+	if len(recipients) > 0 {
+		if encrypted, err = age.Encrypt(file, recipients...); err != nil {
+			return fmt.Errorf("encrypting file: %w", err)
+		}
+		w = encrypted
+	}
+
+	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
 
 	if err := encoder.Encode(data); err != nil {
 		return fmt.Errorf("encoding JSON: %w", err)
 	}
+	if encrypted != nil {
+		if err := encrypted.Close(); err != nil {
+			return fmt.Errorf("encrypting file: %w", err)
+		}
+	}
 
 	slog.Debug("Exported file", "filename", filename)
 	return nil
@@ -606,111 +1038,24 @@ func getTimeOfDay(t time.Time) string {
 
 // generateWorkoutMarkdown creates full markdown content for a workout.
 func generateWorkoutMarkdown(summary WorkoutSummary) string {
-	var md strings.Builder
-
-	// Title
-	md.WriteString(fmt.Sprintf("# %s - %s\n\n", summary.Name, summary.Start.Format("January 2, 2006")))
-
-	// Duration and timing
-	durationMin := summary.Duration / 60.0
-	md.WriteString(fmt.Sprintf("**Duration:** %.1f minutes\n", durationMin))
-	md.WriteString(fmt.Sprintf("**Start:** %s\n", summary.Start.Format("15:04:05")))
-	md.WriteString(fmt.Sprintf("**End:** %s\n\n", summary.End.Format("15:04:05")))
-
-	// Environmental conditions
-	md.WriteString("## Environmental Conditions\n")
-	md.WriteString(fmt.Sprintf("- Temperature: %.1f%s\n", summary.Temperature.Qty, summary.Temperature.Units))
-	md.WriteString(fmt.Sprintf("- Humidity: %.0f%s\n", summary.Humidity.Qty, summary.Humidity.Units))
-	md.WriteString("\n")
-
-	// Performance summary
-	md.WriteString("## Performance Summary\n")
-	if summary.TotalDistance.Qty > 0 {
-		md.WriteString(fmt.Sprintf("- Distance: %.2f %s\n", summary.TotalDistance.Qty, summary.TotalDistance.Units))
-	}
-	if summary.ElevationUp.Qty > 0 {
-		md.WriteString(fmt.Sprintf("- Elevation Gain: %.1f %s\n", summary.ElevationUp.Qty, summary.ElevationUp.Units))
-	}
-	md.WriteString(fmt.Sprintf("- Total Energy: %.1f %s\n", summary.TotalEnergyBurned.Qty, summary.TotalEnergyBurned.Units))
-	md.WriteString(fmt.Sprintf("- Intensity: %.2f %s\n", summary.Intensity.Qty, summary.Intensity.Units))
-	md.WriteString("\n")
-
-	// Heart rate
-	if summary.HeartRateStats != nil {
-		md.WriteString("## Heart Rate\n")
-		md.WriteString(fmt.Sprintf("- Average: %.0f bpm\n", summary.HeartRateStats.Avg))
-		md.WriteString(fmt.Sprintf("- Range: %.0f-%.0f bpm\n", summary.HeartRateStats.Min, summary.HeartRateStats.Max))
-		md.WriteString(fmt.Sprintf("- Data Points: %d\n", summary.HeartRateStats.Count))
-		md.WriteString("\n")
-	}
-
-	// Heart rate recovery
-	if summary.HeartRateRecoveryStats != nil && summary.HeartRateRecoveryStats.Count > 0 {
-		md.WriteString("## Heart Rate Recovery\n")
-		md.WriteString(fmt.Sprintf("- Average: %.0f bpm\n", summary.HeartRateRecoveryStats.Avg))
-		md.WriteString(fmt.Sprintf("- Range: %.0f-%.0f bpm\n", summary.HeartRateRecoveryStats.Min, summary.HeartRateRecoveryStats.Max))
-		md.WriteString(fmt.Sprintf("- Data Points: %d\n", summary.HeartRateRecoveryStats.Count))
-		md.WriteString("\n")
-	}
-
-	// Active energy
-	if summary.ActiveEnergyStats != nil {
-		md.WriteString("## Active Energy\n")
-		md.WriteString(fmt.Sprintf("- Total: %.1f kcal\n", summary.ActiveEnergyStats.Total))
-		md.WriteString(fmt.Sprintf("- Average: %.3f kcal/point\n", summary.ActiveEnergyStats.Avg))
-		md.WriteString(fmt.Sprintf("- Data Points: %d\n", summary.ActiveEnergyStats.Count))
-		md.WriteString("\n")
-	}
-
-	// Steps
-	if summary.StepCountStats != nil && summary.StepCountStats.Count > 0 {
-		md.WriteString("## Steps\n")
-		md.WriteString(fmt.Sprintf("- Total: %.0f steps\n", summary.StepCountStats.Total))
-		md.WriteString(fmt.Sprintf("- Average: %.2f steps/point\n", summary.StepCountStats.Avg))
-		md.WriteString(fmt.Sprintf("- Data Points: %d\n", summary.StepCountStats.Count))
-		md.WriteString("\n")
-	}
-
-	// Distance
-	if summary.DistanceStats != nil && summary.DistanceStats.Count > 0 {
-		md.WriteString("## Distance\n")
-		md.WriteString(fmt.Sprintf("- Total: %.2f %s\n", summary.TotalDistance.Qty, summary.TotalDistance.Units))
-		md.WriteString(fmt.Sprintf("- Average: %.4f %s/point\n", summary.DistanceStats.Avg, summary.TotalDistance.Units))
-		md.WriteString(fmt.Sprintf("- Data Points: %d\n", summary.DistanceStats.Count))
-		md.WriteString("\n")
-	}
-
-	// Footer
-	md.WriteString("---\n")
-	md.WriteString(fmt.Sprintf("*Source: Apple Health (ID: %s)*\n", summary.ID))
-
-	return md.String()
+	return renderMemoryTemplate("workout_markdown", summary)
+}
+
+// generateWorkoutTitle creates a title for a workout.
+func generateWorkoutTitle(summary WorkoutSummary) string {
+	return renderMemoryTemplate("workout_title", summary)
 }
 
 // generateWorkoutSummaryText creates a one-line summary of a workout.
 func generateWorkoutSummaryText(summary WorkoutSummary) string {
-	durationMin := summary.Duration / 60.0
-	parts := []string{
-		fmt.Sprintf("%.1f minute %s", durationMin, strings.ToLower(summary.Name)),
-	}
-
-	if summary.TotalDistance.Qty > 0 {
-		parts = append(parts, fmt.Sprintf("covering %.2f %s", summary.TotalDistance.Qty, summary.TotalDistance.Units))
-	}
-
-	if summary.HeartRateStats != nil {
-		parts = append(parts, fmt.Sprintf("average heart rate of %.0f bpm", summary.HeartRateStats.Avg))
-	}
-
-	parts = append(parts, fmt.Sprintf("burning %.1f kcal", summary.TotalEnergyBurned.Qty))
-
-	return strings.Join(parts, " with ")
+	return renderMemoryTemplate("workout_summary", summary)
 }
 
 // generateImportBatches creates MCP Memory import batch files from all health data types.
 // This generates import-ready JSON files that can be directly used with the Memory MCP server,
 // avoiding the need for bash script string manipulation that can introduce formatting issues.
-func generateImportBatches(data Data, exportDir string) error {
+// workoutSummaries are the summaries of data.Workouts computed during export.
+func generateImportBatches(data Data, workoutSummaries []WorkoutSummary, exportDir string) error {
 	slog.Info("Generating MCP import batches",
 		"workouts", len(data.Workouts),
 		"state_of_mind", len(data.StateOfMind),
@@ -718,7 +1063,7 @@ func generateImportBatches(data Data, exportDir string) error {
 		"collections", targetCollections)
 
 	// Validate collections
-	if len(targetCollections) == 0 {
+	if len(targetCollections) == 0 && len(routingRules) == 0 {
 		slog.Warn("No target collections specified - memories will need collections added before import")
 	}
 
@@ -735,34 +1080,38 @@ func generateImportBatches(data Data, exportDir string) error {
 		StateOfMindRecords: len(data.StateOfMind),
 		MetricRecords:     len(data.Metrics),
 		TargetCollections: targetCollections,
-		Timestamp:         time.Now(),
+		GroupBy:           groupBy,
+		Timestamp:         exportTime(),
 	}
 
 	// Generate workout batches
 	if len(data.Workouts) > 0 {
-		count, err := generateWorkoutBatches(data.Workouts, importDir)
+		files, err := generateWorkoutBatches(workoutSummaries, importDir)
 		if err != nil {
 			return fmt.Errorf("generating workout batches: %w", err)
 		}
-		batchStats.WorkoutBatches = count
+		batchStats.WorkoutBatches = len(files)
+		batchStats.WorkoutBatchFiles = files
 	}
 
 	// Generate state of mind batches
 	if len(data.StateOfMind) > 0 {
-		count, err := generateStateOfMindBatches(data.StateOfMind, importDir)
+		files, err := generateStateOfMindBatches(data.StateOfMind, importDir)
 		if err != nil {
 			return fmt.Errorf("generating state of mind batches: %w", err)
 		}
-		batchStats.StateOfMindBatches = count
+		batchStats.StateOfMindBatches = len(files)
+		batchStats.StateOfMindBatchFiles = files
 	}
 
 	// Generate metric batches
 	if len(data.Metrics) > 0 {
-		count, err := generateMetricBatches(data.Metrics, importDir)
+		files, err := generateMetricBatches(data.Metrics, importDir)
 		if err != nil {
 			return fmt.Errorf("generating metric batches: %w", err)
 		}
-		batchStats.MetricBatches = count
+		batchStats.MetricBatches = len(files)
+		batchStats.MetricBatchFiles = files
 	}
 
 	// Generate summary report
@@ -786,27 +1135,18 @@ func generateImportBatches(data Data, exportDir string) error {
 }
 
 // generateWorkoutBatches creates batch files for workout data.
-// Returns the number of batches created.
-func generateWorkoutBatches(workouts []Workout, importDir string) (int, error) {
-	// Convert workouts to summaries with import metadata
-	summaries := make([]WorkoutSummary, 0, len(workouts))
-	for _, workout := range workouts {
-		summaries = append(summaries, createWorkoutSummary(workout))
-	}
-
-	// Use configured batch size
-	batchNum := 1
-
-	for i := 0; i < len(summaries); i += batchSizeWorkouts {
-		end := i + batchSizeWorkouts
-		if end > len(summaries) {
-			end = len(summaries)
-		}
-
-		batch := summaries[i:end]
-		memories := make([]Memory, 0, len(batch))
-
-		for _, summary := range batch {
+// Returns the names of the batch files created, in import order.
+func generateWorkoutBatches(summaries []WorkoutSummary, importDir string) ([]string, error) {
+	// Plan batches using the configured batch size and grouping strategy
+	plans := planBatches("Workouts", len(summaries), batchSizeWorkouts, workoutGroupKey(summaries))
+	files := make([]string, 0, len(plans))
+
+	for i, plan := range plans {
+		batchNum := i + 1
+		memories := make([]Memory, 0, len(plan.Indices))
+
+		for _, idx := range plan.Indices {
+			summary := summaries[idx]
 			metadata := map[string]interface{}{
 				"workout_type":     summary.Name,
 				"date":             summary.ImportMetadata.Date,
@@ -817,7 +1157,7 @@ func generateWorkoutBatches(workouts []Workout, importDir string) (int, error) {
 				"data_source":      "apple_health",
 				"apple_health_id":  summary.ID,
 				"review_status":    "unreviewed",
-				"privacy_level":    "private",
+				"privacy_level":    privacyLevel(memoryTypeWorkout),
 			}
 
 			// Add distance data if available
@@ -837,53 +1177,53 @@ func generateWorkoutBatches(workouts []Workout, importDir string) (int, error) {
 			}
 
 			memory := Memory{
-				Type:        "workout_log",
+				Type:        memoryTypeWorkout,
 				Content:     summary.MemoryContent.Markdown,
 				Metadata:    metadata,
 				Collections: targetCollections,
 			}
+			applyRouting(&memory, routeAttributes{Type: memoryTypeWorkout, Workout: summary.Name})
 			memories = append(memories, memory)
 		}
 
-		batchFilename := filepath.Join(importDir, fmt.Sprintf("batch_%d_workouts.json", batchNum))
-		if err := exportToJSON(memories, batchFilename); err != nil {
-			return 0, fmt.Errorf("exporting workout batch %d: %w", batchNum, err)
+		filename := importBatchName(batchNum, "workouts", plan.Suffix)
+		batchFilename := filepath.Join(importDir, filename)
+		if err := writeImportBatch(batchFilename, batchNum, plan.Description, memories); err != nil {
+			return nil, fmt.Errorf("exporting workout batch %d: %w", batchNum, err)
 		}
 
 		slog.Info("Generated workout batch",
 			"batch", batchNum,
 			"file", batchFilename,
+			"description", plan.Description,
 			"count", len(memories))
-		batchNum++
+		files = append(files, filename)
 	}
 
-	return batchNum - 1, nil
+	return files, nil
 }
 
 // generateStateOfMindBatches creates batch files for state of mind data.
-// Returns the number of batches created.
-func generateStateOfMindBatches(stateOfMind []StateOfMind, importDir string) (int, error) {
+// Returns the names of the batch files created, in import order.
+func generateStateOfMindBatches(stateOfMind []StateOfMind, importDir string) ([]string, error) {
 	// Convert to summaries with import metadata
 	summaries := make([]StateOfMindSummary, 0, len(stateOfMind))
 	for _, som := range stateOfMind {
 		summaries = append(summaries, createStateOfMindSummary(som))
 	}
 
-	// Use configured batch size
-	batchNum := 1
-
-	for i := 0; i < len(summaries); i += batchSizeSOM {
-		end := i + batchSizeSOM
-		if end > len(summaries) {
-			end = len(summaries)
-		}
+	// Plan batches using the configured batch size and grouping strategy
+	plans := planBatches("State of mind", len(summaries), batchSizeSOM, stateOfMindGroupKey(summaries))
+	files := make([]string, 0, len(plans))
 
-		batch := summaries[i:end]
-		memories := make([]Memory, 0, len(batch))
+	for i, plan := range plans {
+		batchNum := i + 1
+		memories := make([]Memory, 0, len(plan.Indices))
 
-		for _, summary := range batch {
+		for _, idx := range plan.Indices {
+			summary := summaries[idx]
 			memory := Memory{
-				Type:    "mental_health_log",
+				Type:    memoryTypeStateOfMind,
 				Content: summary.MemoryContent.Markdown,
 				Metadata: map[string]interface{}{
 					"kind":                    summary.Kind,
@@ -896,31 +1236,34 @@ func generateStateOfMindBatches(stateOfMind []StateOfMind, importDir string) (in
 					"data_source":             "apple_health",
 					"apple_health_id":         summary.ID,
 					"review_status":           "unreviewed",
-					"privacy_level":           "private",
+					"privacy_level":           privacyLevel(memoryTypeStateOfMind),
 				},
 				Collections: targetCollections,
 			}
+			applyRouting(&memory, routeAttributes{Type: memoryTypeStateOfMind, Valence: summary.ValenceClassification})
 			memories = append(memories, memory)
 		}
 
-		batchFilename := filepath.Join(importDir, fmt.Sprintf("batch_%d_state_of_mind.json", batchNum))
-		if err := exportToJSON(memories, batchFilename); err != nil {
-			return 0, fmt.Errorf("exporting state of mind batch %d: %w", batchNum, err)
+		filename := importBatchName(batchNum, "state_of_mind", plan.Suffix)
+		batchFilename := filepath.Join(importDir, filename)
+		if err := writeImportBatch(batchFilename, batchNum, plan.Description, memories); err != nil {
+			return nil, fmt.Errorf("exporting state of mind batch %d: %w", batchNum, err)
 		}
 
 		slog.Info("Generated state of mind batch",
 			"batch", batchNum,
 			"file", batchFilename,
+			"description", plan.Description,
 			"count", len(memories))
-		batchNum++
+		files = append(files, filename)
 	}
 
-	return batchNum - 1, nil
+	return files, nil
 }
 
 // generateMetricBatches creates batch files for metric data.
-// Returns the number of batches created.
-func generateMetricBatches(metrics []Metric, importDir string) (int, error) {
+// Returns the names of the batch files created, in import order.
+func generateMetricBatches(metrics []Metric, importDir string) ([]string, error) {
 	// Convert to summaries with import metadata
 	summaries := make([]MetricSummary, 0, len(metrics))
 	for _, metric := range metrics {
@@ -930,21 +1273,18 @@ func generateMetricBatches(metrics []Metric, importDir string) (int, error) {
 		}
 	}
 
-	// Use configured batch size
-	batchNum := 1
-
-	for i := 0; i < len(summaries); i += batchSizeMetrics {
-		end := i + batchSizeMetrics
-		if end > len(summaries) {
-			end = len(summaries)
-		}
+	// Plan batches using the configured batch size and grouping strategy
+	plans := planBatches("Metrics", len(summaries), batchSizeMetrics, metricGroupKey(summaries))
+	files := make([]string, 0, len(plans))
 
-		batch := summaries[i:end]
-		memories := make([]Memory, 0, len(batch))
+	for i, plan := range plans {
+		batchNum := i + 1
+		memories := make([]Memory, 0, len(plan.Indices))
 
-		for _, summary := range batch {
+		for _, idx := range plan.Indices {
+			summary := summaries[idx]
 			memory := Memory{
-				Type:    "health_metric",
+				Type:    memoryTypeMetric,
 				Content: summary.MemoryContent.Markdown,
 				Metadata: map[string]interface{}{
 					"metric_name":      summary.Name,
@@ -960,26 +1300,68 @@ func generateMetricBatches(metrics []Metric, importDir string) (int, error) {
 					"day_of_week":      summary.ImportMetadata.DayOfWeek,
 					"data_source":      "apple_health",
 					"review_status":    "unreviewed",
-					"privacy_level":    "private",
+					"privacy_level":    privacyLevel(memoryTypeMetric),
 				},
 				Collections: targetCollections,
 			}
+			applyRouting(&memory, routeAttributes{Type: memoryTypeMetric, Metric: summary.Name})
 			memories = append(memories, memory)
 		}
 
-		batchFilename := filepath.Join(importDir, fmt.Sprintf("batch_%d_metrics.json", batchNum))
-		if err := exportToJSON(memories, batchFilename); err != nil {
-			return 0, fmt.Errorf("exporting metric batch %d: %w", batchNum, err)
+		filename := importBatchName(batchNum, "metrics", plan.Suffix)
+		batchFilename := filepath.Join(importDir, filename)
+		if err := writeImportBatch(batchFilename, batchNum, plan.Description, memories); err != nil {
+			return nil, fmt.Errorf("exporting metric batch %d: %w", batchNum, err)
 		}
 
 		slog.Info("Generated metric batch",
 			"batch", batchNum,
 			"file", batchFilename,
+			"description", plan.Description,
 			"count", len(memories))
-		batchNum++
+		files = append(files, filename)
 	}
 
-	return batchNum - 1, nil
+	return files, nil
+}
+
+// writeImportBatch writes a batch of memories to filename. By default the file
+// holds a bare JSON array of memories; with --batch-envelope the memories are
+// wrapped in an ImportBatch carrying the batch number, description and counts.
+func writeImportBatch(filename string, batchNum int, description string, memories []Memory) error {
+	if !batchEnvelope {
+		return exportToJSON(memories, filename)
+	}
+
+	estimatedChars := 0
+	if data, err := json.Marshal(memories); err == nil {
+		estimatedChars = len(data)
+	}
+
+	batch := ImportBatch{
+		Batch:            batchNum,
+		Description:      description,
+		Count:            len(memories),
+		EstimatedChars:   estimatedChars,
+		TargetCollection: commonCollection(memories),
+		Memories:         memories,
+	}
+	return exportToJSON(batch, filename)
+}
+
+// commonCollection returns the collection shared by every memory in the batch,
+// or an empty string if the memories target more than one collection.
+func commonCollection(memories []Memory) string {
+	if len(memories) == 0 || len(memories[0].Collections) != 1 {
+		return ""
+	}
+	collection := memories[0].Collections[0]
+	for _, memory := range memories[1:] {
+		if len(memory.Collections) != 1 || memory.Collections[0] != collection {
+			return ""
+		}
+	}
+	return collection
 }
 
 // createStateOfMindSummary generates a summary view of a state of mind record with import metadata.
@@ -1019,64 +1401,17 @@ func createStateOfMindSummary(som StateOfMind) StateOfMindSummary {
 
 // generateStateOfMindTitle creates a title for a state of mind record.
 func generateStateOfMindTitle(summary StateOfMindSummary) string {
-	kindLabel := strings.ReplaceAll(summary.Kind, "_", " ")
-	// Simple title case - capitalize first letter of each word
-	words := strings.Fields(kindLabel)
-	for i, word := range words {
-		if len(word) > 0 {
-			words[i] = strings.ToUpper(word[:1]) + word[1:]
-		}
-	}
-	kindLabel = strings.Join(words, " ")
-	return fmt.Sprintf("%s - %s", kindLabel, summary.Start.Format("January 2, 2006"))
+	return renderMemoryTemplate("state_of_mind_title", summary)
 }
 
 // generateStateOfMindSummaryText creates a one-line summary of a state of mind record.
 func generateStateOfMindSummaryText(summary StateOfMindSummary) string {
-	return fmt.Sprintf("%s mood recorded as %s (valence: %.2f)",
-		strings.ReplaceAll(summary.Kind, "_", " "),
-		summary.ValenceClassification,
-		summary.Valence)
+	return renderMemoryTemplate("state_of_mind_summary", summary)
 }
 
 // generateStateOfMindMarkdown creates full markdown content for a state of mind record.
 func generateStateOfMindMarkdown(summary StateOfMindSummary) string {
-	var md strings.Builder
-
-	// Title
-	md.WriteString(fmt.Sprintf("# %s\n\n", generateStateOfMindTitle(summary)))
-
-	// Time
-	md.WriteString(fmt.Sprintf("**Time:** %s\n\n", summary.Start.Format("15:04:05")))
-
-	// Classification
-	md.WriteString("## Classification\n")
-	md.WriteString(fmt.Sprintf("- **Valence:** %.3f\n", summary.Valence))
-	md.WriteString(fmt.Sprintf("- **Classification:** %s\n\n", summary.ValenceClassification))
-
-	// Labels (if any)
-	if len(summary.Labels) > 0 {
-		md.WriteString("## Labels\n")
-		for _, label := range summary.Labels {
-			md.WriteString(fmt.Sprintf("- %v\n", label))
-		}
-		md.WriteString("\n")
-	}
-
-	// Associations (if any)
-	if len(summary.Associations) > 0 {
-		md.WriteString("## Associations\n")
-		for _, assoc := range summary.Associations {
-			md.WriteString(fmt.Sprintf("- %v\n", assoc))
-		}
-		md.WriteString("\n")
-	}
-
-	// Footer
-	md.WriteString("---\n")
-	md.WriteString(fmt.Sprintf("*Source: Apple Health (ID: %s)*\n", summary.ID))
-
-	return md.String()
+	return renderMemoryTemplate("state_of_mind_markdown", summary)
 }
 
 // createMetricSummary generates a summary view of a metric with aggregated statistics.
@@ -1140,70 +1475,24 @@ func createMetricSummary(metric Metric) MetricSummary {
 
 // generateMetricTitle creates a title for a metric.
 func generateMetricTitle(summary MetricSummary) string {
-	metricName := strings.ReplaceAll(summary.Name, "_", " ")
-	// Simple title case - capitalize first letter of each word
-	words := strings.Fields(metricName)
-	for i, word := range words {
-		if len(word) > 0 {
-			words[i] = strings.ToUpper(word[:1]) + word[1:]
-		}
-	}
-	metricName = strings.Join(words, " ")
-	return fmt.Sprintf("%s - %s to %s",
-		metricName,
-		summary.StartDate.Format("Jan 2"),
-		summary.EndDate.Format("Jan 2, 2006"))
+	return renderMemoryTemplate("metric_title", summary)
 }
 
 // generateMetricSummaryText creates a one-line summary of a metric.
 func generateMetricSummaryText(summary MetricSummary) string {
-	return fmt.Sprintf("%s: %d data points, average %.2f %s (range: %.2f-%.2f)",
-		strings.ReplaceAll(summary.Name, "_", " "),
-		summary.DataPoints,
-		summary.Average,
-		summary.Units,
-		summary.Min,
-		summary.Max)
+	return renderMemoryTemplate("metric_summary", summary)
 }
 
 // generateMetricMarkdown creates full markdown content for a metric.
 func generateMetricMarkdown(summary MetricSummary) string {
-	var md strings.Builder
-
-	// Title
-	md.WriteString(fmt.Sprintf("# %s\n\n", generateMetricTitle(summary)))
-
-	// Time Range
-	md.WriteString("## Time Range\n")
-	md.WriteString(fmt.Sprintf("- **Start:** %s\n", summary.StartDate.Format("January 2, 2006")))
-	md.WriteString(fmt.Sprintf("- **End:** %s\n", summary.EndDate.Format("January 2, 2006")))
-	days := summary.EndDate.Sub(summary.StartDate).Hours() / 24
-	md.WriteString(fmt.Sprintf("- **Duration:** %.0f days\n\n", days))
-
-	// Statistics
-	md.WriteString("## Statistics\n")
-	md.WriteString(fmt.Sprintf("- **Data Points:** %d\n", summary.DataPoints))
-	md.WriteString(fmt.Sprintf("- **Average:** %.2f %s\n", summary.Average, summary.Units))
-	md.WriteString(fmt.Sprintf("- **Minimum:** %.2f %s\n", summary.Min, summary.Units))
-	md.WriteString(fmt.Sprintf("- **Maximum:** %.2f %s\n\n", summary.Max, summary.Units))
-
-	// Footer
-	md.WriteString("---\n")
-	md.WriteString("*Source: Apple Health*\n")
-
-	return md.String()
+	return renderMemoryTemplate("metric_markdown", summary)
 }
 
 // generateBatchSummary creates a JSON summary file of the batch generation process.
 func generateBatchSummary(summary BatchSummary, importDir string) error {
 	summaryFile := filepath.Join(importDir, "batch_summary.json")
 
-	data, err := json.MarshalIndent(summary, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshaling batch summary: %w", err)
-	}
-
-	if err := os.WriteFile(summaryFile, data, 0644); err != nil {
+	if err := exportToJSON(summary, summaryFile); err != nil {
 		return fmt.Errorf("writing batch summary: %w", err)
 	}
 
@@ -1234,12 +1523,17 @@ func generateMCPImportScript(summary BatchSummary, importDir string) error {
 	script.WriteString(fmt.Sprintf("MEMORY_BIN=\"%s\"\n", memoryBinaryPath))
 	script.WriteString("SCRIPT_DIR=\"$(cd \"$(dirname \"${BASH_SOURCE[0]}\")\" && pwd)\"\n")
 	script.WriteString("LOG_FILE=\"${SCRIPT_DIR}/import.log\"\n")
-	script.WriteString("ERROR_LOG=\"${SCRIPT_DIR}/import_errors.log\"\n\n")
+	script.WriteString("ERROR_LOG=\"${SCRIPT_DIR}/import_errors.log\"\n")
+	script.WriteString(fmt.Sprintf("JOURNAL=\"${SCRIPT_DIR}/%s\"\n\n", importJournalFile))
 
 	// Helper functions
 	script.WriteString("# Helper functions\n")
 	script.WriteString("log() { echo \"[$(date +'%Y-%m-%d %H:%M:%S')] $*\" | tee -a \"${LOG_FILE}\"; }\n")
-	script.WriteString("error() { echo \"[$(date +'%Y-%m-%d %H:%M:%S')] ERROR: $*\" | tee -a \"${LOG_FILE}\" \"${ERROR_LOG}\" >&2; }\n\n")
+	script.WriteString("error() { echo \"[$(date +'%Y-%m-%d %H:%M:%S')] ERROR: $*\" | tee -a \"${LOG_FILE}\" \"${ERROR_LOG}\" >&2; }\n")
+	script.WriteString("# Record a batch outcome in the import journal (read by 'import status')\n")
+	script.WriteString("journal() { printf '{\"time\":\"%s\",\"batch\":\"%s\",\"status\":\"%s\"}\\n' \"$(date -u +'%Y-%m-%dT%H:%M:%SZ')\" \"$1\" \"$2\" >> \"${JOURNAL}\"; }\n")
+	script.WriteString("# Check whether the journal's latest entry for a batch is done\n")
+	script.WriteString("imported() { [ -f \"${JOURNAL}\" ] && grep -F \"\\\"batch\\\":\\\"$1\\\"\" \"${JOURNAL}\" | tail -n 1 | grep -qF '\"status\":\"done\"'; }\n\n")
 
 	// Verification
 	script.WriteString("# Verify memory binary exists\n")
@@ -1265,15 +1559,22 @@ func generateMCPImportScript(summary BatchSummary, importDir string) error {
 	script.WriteString("    local batch_file=\"$1\"\n")
 	script.WriteString("    local batch_name=$(basename \"${batch_file}\")\n")
 	script.WriteString("    \n")
+	script.WriteString("    if imported \"${batch_name}\"; then\n")
+	script.WriteString("        log \"Skipping ${batch_name} (already imported)\"\n")
+	script.WriteString("        return 0\n")
+	script.WriteString("    fi\n")
+	script.WriteString("    \n")
 	script.WriteString("    log \"Importing ${batch_name}...\"\n")
 	script.WriteString("    \n")
 	script.WriteString("    if \"${MEMORY_BIN}\" tools run --tool memory_memory_create --input \"${batch_file}\" >> \"${LOG_FILE}\" 2>> \"${ERROR_LOG}\"; then\n")
 	script.WriteString("        log \"✓ Successfully imported ${batch_name}\"\n")
-	script.WriteString("        ((TOTAL_IMPORTED++))\n")
+	script.WriteString("        journal \"${batch_name}\" done\n")
+	script.WriteString("        TOTAL_IMPORTED=$((TOTAL_IMPORTED + 1))\n")
 	script.WriteString("        return 0\n")
 	script.WriteString("    else\n")
 	script.WriteString("        error \"✗ Failed to import ${batch_name}\"\n")
-	script.WriteString("        ((TOTAL_FAILED++))\n")
+	script.WriteString("        journal \"${batch_name}\" failed\n")
+	script.WriteString("        TOTAL_FAILED=$((TOTAL_FAILED + 1))\n")
 	script.WriteString("        return 1\n")
 	script.WriteString("    fi\n")
 	script.WriteString("}\n\n")
@@ -1282,8 +1583,8 @@ func generateMCPImportScript(summary BatchSummary, importDir string) error {
 	if summary.WorkoutBatches > 0 {
 		script.WriteString(fmt.Sprintf("# Import workout batches (%d batches, %d records)\n", summary.WorkoutBatches, summary.WorkoutRecords))
 		script.WriteString("log \"Importing workout batches...\"\n")
-		for i := 1; i <= summary.WorkoutBatches; i++ {
-			script.WriteString(fmt.Sprintf("import_batch \"${SCRIPT_DIR}/batch_%d_workouts.json\"\n", i))
+		for _, file := range summary.WorkoutBatchFiles {
+			script.WriteString(fmt.Sprintf("import_batch \"${SCRIPT_DIR}/%s\"\n", file))
 		}
 		script.WriteString("\n")
 	}
@@ -1292,8 +1593,8 @@ func generateMCPImportScript(summary BatchSummary, importDir string) error {
 	if summary.StateOfMindBatches > 0 {
 		script.WriteString(fmt.Sprintf("# Import state of mind batches (%d batches, %d records)\n", summary.StateOfMindBatches, summary.StateOfMindRecords))
 		script.WriteString("log \"Importing state of mind batches...\"\n")
-		for i := 1; i <= summary.StateOfMindBatches; i++ {
-			script.WriteString(fmt.Sprintf("import_batch \"${SCRIPT_DIR}/batch_%d_state_of_mind.json\"\n", i))
+		for _, file := range summary.StateOfMindBatchFiles {
+			script.WriteString(fmt.Sprintf("import_batch \"${SCRIPT_DIR}/%s\"\n", file))
 		}
 		script.WriteString("\n")
 	}
@@ -1302,8 +1603,8 @@ func generateMCPImportScript(summary BatchSummary, importDir string) error {
 	if summary.MetricBatches > 0 {
 		script.WriteString(fmt.Sprintf("# Import metric batches (%d batches, %d records)\n", summary.MetricBatches, summary.MetricRecords))
 		script.WriteString("log \"Importing metric batches...\"\n")
-		for i := 1; i <= summary.MetricBatches; i++ {
-			script.WriteString(fmt.Sprintf("import_batch \"${SCRIPT_DIR}/batch_%d_metrics.json\"\n", i))
+		for _, file := range summary.MetricBatchFiles {
+			script.WriteString(fmt.Sprintf("import_batch \"${SCRIPT_DIR}/%s\"\n", file))
 		}
 		script.WriteString("\n")
 	}
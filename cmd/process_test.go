@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
@@ -505,3 +507,169 @@ func TestGenerateMetricTitle(t *testing.T) {
 		})
 	}
 }
+
+func TestEstimateBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		total     int
+		batchSize int
+		want      int
+	}{
+		{name: "no items", total: 0, batchSize: 20, want: 0},
+		{name: "exact multiple", total: 40, batchSize: 20, want: 2},
+		{name: "partial final batch", total: 41, batchSize: 20, want: 3},
+		{name: "invalid batch size", total: 10, batchSize: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateBatches(tt.total, tt.batchSize); got != tt.want {
+				t.Errorf("estimateBatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPopulateDateRange(t *testing.T) {
+	data := Data{
+		Metrics: []Metric{
+			{Name: "Steps", Data: []MetricRecord{
+				{Date: time.Date(2025, 11, 10, 8, 0, 0, 0, time.UTC)},
+				{Date: time.Date(2025, 11, 12, 8, 0, 0, 0, time.UTC)},
+			}},
+		},
+		Workouts: []Workout{
+			{Start: time.Date(2025, 11, 14, 17, 0, 0, 0, time.UTC), End: time.Date(2025, 11, 14, 18, 0, 0, 0, time.UTC)},
+		},
+		StateOfMind: []StateOfMind{
+			{Start: time.Date(2025, 11, 9, 21, 0, 0, 0, time.UTC), End: time.Date(2025, 11, 9, 21, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	manifest := &ExportManifest{}
+	populateDateRange(manifest, data)
+
+	if want := time.Date(2025, 11, 9, 21, 0, 0, 0, time.UTC); !manifest.DateRange.Earliest.Equal(want) {
+		t.Errorf("Earliest = %v, want %v", manifest.DateRange.Earliest, want)
+	}
+	if want := time.Date(2025, 11, 14, 18, 0, 0, 0, time.UTC); !manifest.DateRange.Latest.Equal(want) {
+		t.Errorf("Latest = %v, want %v", manifest.DateRange.Latest, want)
+	}
+	if manifest.DateRange.TotalDays != 6 {
+		t.Errorf("TotalDays = %v, want 6", manifest.DateRange.TotalDays)
+	}
+}
+
+func TestPopulateImportHints(t *testing.T) {
+	data := Data{
+		Metrics: []Metric{
+			{Name: "Steps", Data: []MetricRecord{{Qty: 1}}},
+			{Name: "Empty"},
+		},
+		Workouts: []Workout{
+			{HeartRateData: []HeartRateData{{Avg: 100}}, StepCount: []StepRecord{{Qty: 10}}},
+			{HeartRateData: []HeartRateData{{Avg: 110}}, HeartRateRecovery: []HeartRateData{{Avg: 90}}},
+			{},
+		},
+		StateOfMind: make([]StateOfMind, 45),
+	}
+
+	manifest := &ExportManifest{}
+	populateImportHints(manifest, data, t.TempDir())
+	hints := manifest.ImportHints
+
+	if hints.RecommendedMemoryTypes.Workouts != memoryTypeWorkout {
+		t.Errorf("RecommendedMemoryTypes.Workouts = %v, want %v", hints.RecommendedMemoryTypes.Workouts, memoryTypeWorkout)
+	}
+	if hints.BatchRecommendations.Workouts.TotalItems != 3 {
+		t.Errorf("Workouts.TotalItems = %v, want 3", hints.BatchRecommendations.Workouts.TotalItems)
+	}
+	if hints.BatchRecommendations.Metrics.TotalTypes != 1 {
+		t.Errorf("Metrics.TotalTypes = %v, want 1", hints.BatchRecommendations.Metrics.TotalTypes)
+	}
+	if got, want := hints.BatchRecommendations.StateOfMind.EstimatedBatches, estimateBatches(45, batchSizeSOM); got != want {
+		t.Errorf("StateOfMind.EstimatedBatches = %v, want %v", got, want)
+	}
+	if hints.DataQuality.WorkoutsWithHeartRate != 2 {
+		t.Errorf("WorkoutsWithHeartRate = %v, want 2", hints.DataQuality.WorkoutsWithHeartRate)
+	}
+	if hints.DataQuality.WorkoutsWithSteps != 1 {
+		t.Errorf("WorkoutsWithSteps = %v, want 1", hints.DataQuality.WorkoutsWithSteps)
+	}
+	if hints.DataQuality.WorkoutsWithRecovery != 1 {
+		t.Errorf("WorkoutsWithRecovery = %v, want 1", hints.DataQuality.WorkoutsWithRecovery)
+	}
+	if hints.ContextWindowEstimates.SafeBatchSizeChars != safeBatchSizeChars {
+		t.Errorf("SafeBatchSizeChars = %v, want %v", hints.ContextWindowEstimates.SafeBatchSizeChars, safeBatchSizeChars)
+	}
+}
+
+func TestWriteImportBatch(t *testing.T) {
+	memories := []Memory{
+		{Type: memoryTypeWorkout, Content: "# Walk", Collections: []string{"health"}},
+		{Type: memoryTypeWorkout, Content: "# Run", Collections: []string{"health"}},
+	}
+
+	t.Run("bare array by default", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "batch.json")
+		if err := writeImportBatch(filename, 1, "Workouts 1-2 of 2", memories); err != nil {
+			t.Fatalf("writeImportBatch() error = %v", err)
+		}
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("reading batch: %v", err)
+		}
+		var got []Memory
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("batch is not a memory array: %v", err)
+		}
+		if len(got) != 2 {
+			t.Errorf("len(memories) = %v, want 2", len(got))
+		}
+	})
+
+	t.Run("envelope when enabled", func(t *testing.T) {
+		batchEnvelope = true
+		defer func() { batchEnvelope = false }()
+
+		filename := filepath.Join(t.TempDir(), "batch.json")
+		if err := writeImportBatch(filename, 3, "Workouts 1-2 of 2", memories); err != nil {
+			t.Fatalf("writeImportBatch() error = %v", err)
+		}
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("reading batch: %v", err)
+		}
+		var got ImportBatch
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("batch is not an envelope: %v", err)
+		}
+		if got.Batch != 3 || got.Count != 2 || got.Description != "Workouts 1-2 of 2" {
+			t.Errorf("envelope = %+v", got)
+		}
+		if got.TargetCollection != "health" {
+			t.Errorf("TargetCollection = %v, want health", got.TargetCollection)
+		}
+		if got.EstimatedChars == 0 {
+			t.Error("EstimatedChars should be non-zero")
+		}
+	})
+}
+
+func TestExportDataTraceID(t *testing.T) {
+	dir := t.TempDir()
+	ctx := withTraceID(context.Background(), "trace-1")
+	if err := exportData(ctx, HealthData{Data: testHealthData()}, exportSource{}, dir); err != nil {
+		t.Fatalf("exportData() error = %v", err)
+	}
+
+	manifest := &ExportManifest{}
+	if err := readManifest(dir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.TraceID != "trace-1" {
+		t.Errorf("manifest trace ID = %q, want trace-1", manifest.TraceID)
+	}
+}
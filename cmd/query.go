@@ -0,0 +1,461 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Supported time buckets for metric series queries.
+const (
+	bucketNone  = "none"
+	bucketHour  = "hour"
+	bucketDay   = "day"
+	bucketWeek  = "week"
+	bucketMonth = "month"
+)
+
+// validBuckets lists the accepted metric series buckets.
+var validBuckets = []string{bucketNone, bucketHour, bucketDay, bucketWeek, bucketMonth}
+
+// healthIndex holds parsed health data with summaries computed once up front,
+// so queries never re-parse the export or re-render memory content.
+type healthIndex struct {
+	data Data
+
+	workouts       []WorkoutSummary     // Sorted by start time
+	workoutDetails []Workout            // Full workouts, in the same order as workouts
+	workoutByID    map[string]int       // Workout ID to index in workouts
+	metrics        []MetricSummary      // Sorted by name
+	metricByKey    map[string]int       // Normalized metric name to index in data.Metrics
+	moods          []StateOfMindSummary // Sorted by start time
+}
+
+// newHealthIndex builds the query index for data. Metric records are copied,
+// merged by metric name and sorted by date, so data itself is never modified.
+func newHealthIndex(data Data) *healthIndex {
+	idx := &healthIndex{
+		workoutByID: make(map[string]int, len(data.Workouts)),
+		metricByKey: make(map[string]int, len(data.Metrics)),
+	}
+
+	idx.workoutDetails = append([]Workout(nil), data.Workouts...)
+	sort.SliceStable(idx.workoutDetails, func(i, j int) bool {
+		return idx.workoutDetails[i].Start.Before(idx.workoutDetails[j].Start)
+	})
+	for i, workout := range idx.workoutDetails {
+		idx.workoutByID[workout.ID] = i
+		idx.workouts = append(idx.workouts, createWorkoutSummary(workout))
+	}
+
+	metrics := mergeMetrics(data.Metrics)
+	for i, metric := range metrics {
+		idx.metricByKey[metricKey(metric.Name)] = i
+		idx.metrics = append(idx.metrics, createMetricSummary(metric))
+	}
+	sort.SliceStable(idx.metrics, func(i, j int) bool { return idx.metrics[i].Name < idx.metrics[j].Name })
+
+	for _, som := range data.StateOfMind {
+		idx.moods = append(idx.moods, createStateOfMindSummary(som))
+	}
+	sort.SliceStable(idx.moods, func(i, j int) bool { return idx.moods[i].Start.Before(idx.moods[j].Start) })
+
+	idx.data = data
+	idx.data.Metrics = metrics
+	return idx
+}
+
+// mergeMetrics returns copies of metrics with the metrics of the same name, as
+// in overlapping sources, merged into the first. Duplicate records are dropped
+// as in mergeData, and records are sorted by date.
+func mergeMetrics(metrics []Metric) []Metric {
+	var merged []Metric
+	index := make(map[string]int, len(metrics))
+	seen := make(map[string]map[metricRecordKey]bool, len(metrics))
+	for _, metric := range metrics {
+		key := metricKey(metric.Name)
+		i, ok := index[key]
+		if !ok {
+			i = len(merged)
+			index[key] = i
+			seen[key] = make(map[metricRecordKey]bool, len(metric.Data))
+			m := metric
+			m.Data = nil
+			merged = append(merged, m)
+		}
+		for _, record := range metric.Data {
+			recordKey := newMetricRecordKey(record)
+			if !seen[key][recordKey] {
+				seen[key][recordKey] = true
+				merged[i].Data = append(merged[i].Data, record)
+			}
+		}
+	}
+	for i := range merged {
+		records := merged[i].Data
+		sort.SliceStable(records, func(a, b int) bool { return records[a].Date.Before(records[b].Date) })
+	}
+	return merged
+}
+
+// metricKey normalizes a metric name for lookup, so "Heart Rate" finds "heart_rate".
+func metricKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", "_"))
+}
+
+// timeRange is an optional [From, To) filter; zero bounds are open.
+type timeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// contains reports whether t falls within the range.
+func (r timeRange) contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || t.Before(r.To))
+}
+
+// parseTimeRange parses optional query bounds. Bounds may be RFC3339 timestamps,
+// export timestamps ("2006-01-02 15:04:05 -0700") or dates ("2006-01-02") in the
+// local time zone; a date as the upper bound includes that whole day.
+func parseTimeRange(from, to string) (timeRange, error) {
+	var r timeRange
+	var err error
+	if from != "" {
+		if r.From, _, err = parseQueryTime(from); err != nil {
+			return r, fmt.Errorf("invalid from time: %w", err)
+		}
+	}
+	if to != "" {
+		var dateOnly bool
+		if r.To, dateOnly, err = parseQueryTime(to); err != nil {
+			return r, fmt.Errorf("invalid to time: %w", err)
+		}
+		if dateOnly {
+			r.To = r.To.AddDate(0, 0, 1)
+		}
+	}
+	if !r.From.IsZero() && !r.To.IsZero() && !r.From.Before(r.To) {
+		return r, fmt.Errorf("from (%s) must be before to (%s)", from, to)
+	}
+	return r, nil
+}
+
+// parseQueryTime parses a query timestamp, reporting whether it was a bare date.
+func parseQueryTime(s string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := parseDate(s)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("'%s' is not a date (2006-01-02) or RFC3339 timestamp", s)
+	}
+	return t, false, nil
+}
+
+// workoutFilter selects workouts by type and start time.
+type workoutFilter struct {
+	Type  string // Workout name, case-insensitive; empty matches all
+	Range timeRange
+}
+
+// listWorkouts returns the summaries of matching workouts in start order.
+func (idx *healthIndex) listWorkouts(filter workoutFilter) []WorkoutSummary {
+	matches := []WorkoutSummary{}
+	for _, summary := range idx.workouts {
+		if !matchField(filter.Type, summary.Name) || !filter.Range.contains(summary.Start) {
+			continue
+		}
+		matches = append(matches, summary)
+	}
+	return matches
+}
+
+// workout returns the full workout and its summary by ID.
+func (idx *healthIndex) workout(id string) (Workout, WorkoutSummary, bool) {
+	i, ok := idx.workoutByID[id]
+	if !ok {
+		return Workout{}, WorkoutSummary{}, false
+	}
+	return idx.workoutDetails[i], idx.workouts[i], true
+}
+
+// WorkoutListItem is a compact workout entry for listings.
+type WorkoutListItem struct {
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	Start           time.Time      `json:"start"`
+	End             time.Time      `json:"end"`
+	DurationMinutes float64        `json:"durationMinutes"`
+	Distance        ValueWithUnits `json:"distance"`
+	ActiveEnergy    EnergyValue    `json:"activeEnergy"`
+	AvgHeartRate    float64        `json:"avgHeartRate,omitempty"`
+	Summary         string         `json:"summary"`
+}
+
+// newWorkoutListItem condenses a workout summary for listings.
+func newWorkoutListItem(summary WorkoutSummary) WorkoutListItem {
+	item := WorkoutListItem{
+		ID:              summary.ID,
+		Name:            summary.Name,
+		Start:           summary.Start,
+		End:             summary.End,
+		DurationMinutes: summary.Duration / 60,
+		Distance:        summary.TotalDistance,
+		ActiveEnergy:    summary.TotalEnergyBurned,
+		Summary:         summary.MemoryContent.Summary,
+	}
+	if summary.HeartRateStats != nil {
+		item.AvgHeartRate = summary.HeartRateStats.Avg
+	}
+	return item
+}
+
+// WorkoutDetail is a workout summary with its optional time-series data.
+type WorkoutDetail struct {
+	Summary           WorkoutSummary   `json:"summary"`
+	HeartRate         []HeartRateData  `json:"heartRate,omitempty"`
+	HeartRateRecovery []HeartRateData  `json:"heartRateRecovery,omitempty"`
+	ActiveEnergy      []EnergyRecord   `json:"activeEnergy,omitempty"`
+	StepCount         []StepRecord     `json:"stepCount,omitempty"`
+	Distance          []DistanceRecord `json:"distance,omitempty"`
+}
+
+// workoutDetail returns a workout's summary and, if includeSeries is set, its
+// heart rate, energy, step and distance series.
+func (idx *healthIndex) workoutDetail(id string, includeSeries bool) (*WorkoutDetail, bool) {
+	workout, summary, ok := idx.workout(id)
+	if !ok {
+		return nil, false
+	}
+	detail := &WorkoutDetail{Summary: summary}
+	if includeSeries {
+		detail.HeartRate = workout.HeartRateData
+		detail.HeartRateRecovery = workout.HeartRateRecovery
+		detail.ActiveEnergy = workout.ActiveEnergy
+		detail.StepCount = workout.StepCount
+		detail.Distance = workout.WalkingAndRunningDistance
+	}
+	return detail, true
+}
+
+// workoutTypes returns the number of workouts of each type.
+func (idx *healthIndex) workoutTypes() map[string]int {
+	types := make(map[string]int)
+	for _, summary := range idx.workouts {
+		types[summary.Name]++
+	}
+	return types
+}
+
+// MetricSeries is a metric's data points, optionally aggregated into time buckets.
+type MetricSeries struct {
+	Name   string        `json:"name"`
+	Units  string        `json:"units"`
+	Bucket string        `json:"bucket"`
+	Points []SeriesPoint `json:"points"`
+}
+
+// SeriesPoint aggregates the metric records in one bucket. Without bucketing
+// each point holds a single record.
+type SeriesPoint struct {
+	Time  time.Time `json:"time"` // Start of the bucket, or the record time
+	Count int       `json:"count"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Avg   float64   `json:"avg"`
+	Sum   float64   `json:"sum"`
+}
+
+// metricSeries returns the named metric's records within r, aggregated by bucket.
+func (idx *healthIndex) metricSeries(name string, r timeRange, bucket string) (*MetricSeries, error) {
+	if bucket == "" {
+		bucket = bucketNone
+	}
+	if !containsString(validBuckets, bucket) {
+		return nil, fmt.Errorf("invalid bucket: %s (valid: %s)", bucket, strings.Join(validBuckets, ", "))
+	}
+
+	metric, ok := idx.metric(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown metric: %s", name)
+	}
+
+	series := &MetricSeries{Name: metric.Name, Units: metric.Units, Bucket: bucket, Points: []SeriesPoint{}}
+	var current *SeriesPoint
+	for _, record := range metric.Data {
+		if !r.contains(record.Date) {
+			continue
+		}
+		start := bucketStart(record.Date, bucket)
+		if current == nil || bucket == bucketNone || !start.Equal(current.Time) {
+			series.Points = append(series.Points, SeriesPoint{Time: start, Min: record.Qty, Max: record.Qty})
+			current = &series.Points[len(series.Points)-1]
+		}
+		current.Count++
+		current.Sum += record.Qty
+		if record.Qty < current.Min {
+			current.Min = record.Qty
+		}
+		if record.Qty > current.Max {
+			current.Max = record.Qty
+		}
+	}
+
+	for i := range series.Points {
+		series.Points[i].Avg = series.Points[i].Sum / float64(series.Points[i].Count)
+	}
+	return series, nil
+}
+
+// metric returns the metric with the given name, matched case-insensitively
+// with spaces and underscores treated alike.
+func (idx *healthIndex) metric(name string) (Metric, bool) {
+	i, ok := idx.metricByKey[metricKey(name)]
+	if !ok {
+		return Metric{}, false
+	}
+	return idx.data.Metrics[i], true
+}
+
+// metricSummary returns the summary of the named metric.
+func (idx *healthIndex) metricSummary(name string) (MetricSummary, bool) {
+	key := metricKey(name)
+	for _, summary := range idx.metrics {
+		if metricKey(summary.Name) == key {
+			return summary, true
+		}
+	}
+	return MetricSummary{}, false
+}
+
+// bucketStart returns the start of the bucket containing t, in t's time zone.
+// Weeks start on Monday, matching ISO weeks.
+func bucketStart(t time.Time, bucket string) time.Time {
+	year, month, day := t.Date()
+	switch bucket {
+	case bucketHour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	case bucketDay:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case bucketWeek:
+		offset := (int(t.Weekday()) + 6) % 7 // Days since Monday
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case bucketMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return t
+	}
+}
+
+// MoodEntry is a compact state of mind record for timelines.
+type MoodEntry struct {
+	ID                    string    `json:"id"`
+	Kind                  string    `json:"kind"`
+	Start                 time.Time `json:"start"`
+	Valence               float64   `json:"valence"`
+	ValenceClassification string    `json:"valenceClassification"`
+	Labels                []string  `json:"labels,omitempty"`
+	Associations          []string  `json:"associations,omitempty"`
+}
+
+// moodTimeline returns state of mind entries within r in start order,
+// optionally restricted to one kind (e.g. "daily_mood").
+func (idx *healthIndex) moodTimeline(r timeRange, kind string) []MoodEntry {
+	entries := []MoodEntry{}
+	for _, summary := range idx.moods {
+		if !matchField(kind, summary.Kind) || !r.contains(summary.Start) {
+			continue
+		}
+		entries = append(entries, MoodEntry{
+			ID:                    summary.ID,
+			Kind:                  summary.Kind,
+			Start:                 summary.Start,
+			Valence:               summary.Valence,
+			ValenceClassification: summary.ValenceClassification,
+			Labels:                stringValues(summary.Labels),
+			Associations:          stringValues(summary.Associations),
+		})
+	}
+	return entries
+}
+
+// stringValues converts loosely typed JSON values to strings.
+func stringValues(values []interface{}) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, fmt.Sprint(v))
+	}
+	return out
+}
+
+// HealthOverview summarizes the contents of an export.
+type HealthOverview struct {
+	DateRange struct {
+		Earliest  time.Time `json:"earliest"`
+		Latest    time.Time `json:"latest"`
+		TotalDays int       `json:"totalDays"`
+	} `json:"dateRange"`
+
+	Workouts struct {
+		Total int            `json:"total"`
+		Types map[string]int `json:"types"` // Workout count per type
+	} `json:"workouts"`
+
+	Metrics []MetricInfo `json:"metrics"`
+
+	StateOfMind struct {
+		Total           int            `json:"total"`
+		Classifications map[string]int `json:"classifications"` // Entry count per valence classification
+	} `json:"stateOfMind"`
+}
+
+// MetricInfo describes an available metric.
+type MetricInfo struct {
+	Name       string    `json:"name"`
+	Units      string    `json:"units"`
+	Family     string    `json:"family"`
+	DataPoints int       `json:"dataPoints"`
+	StartDate  time.Time `json:"startDate"`
+	EndDate    time.Time `json:"endDate"`
+	Min        float64   `json:"min"`
+	Max        float64   `json:"max"`
+	Average    float64   `json:"average"`
+}
+
+// overview summarizes the indexed data.
+func (idx *healthIndex) overview() HealthOverview {
+	var overview HealthOverview
+
+	var manifest ExportManifest
+	populateDateRange(&manifest, idx.data)
+	overview.DateRange = manifest.DateRange
+
+	overview.Workouts.Total = len(idx.workouts)
+	overview.Workouts.Types = idx.workoutTypes()
+
+	overview.Metrics = []MetricInfo{}
+	for _, summary := range idx.metrics {
+		overview.Metrics = append(overview.Metrics, MetricInfo{
+			Name:       summary.Name,
+			Units:      summary.Units,
+			Family:     metricFamily(summary.Name),
+			DataPoints: summary.DataPoints,
+			StartDate:  summary.StartDate,
+			EndDate:    summary.EndDate,
+			Min:        summary.Min,
+			Max:        summary.Max,
+			Average:    summary.Average,
+		})
+	}
+
+	overview.StateOfMind.Total = len(idx.moods)
+	overview.StateOfMind.Classifications = make(map[string]int)
+	for _, summary := range idx.moods {
+		overview.StateOfMind.Classifications[summary.ValenceClassification]++
+	}
+	return overview
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testHealthData returns a small export with workouts, metrics and state of
+// mind entries spread over two weeks, deliberately out of order.
+func testHealthData() Data {
+	est := time.FixedZone("EST", -5*3600)
+	at := func(day, hour int) time.Time { return time.Date(2025, 11, day, hour, 0, 0, 0, est) }
+
+	return Data{
+		Workouts: []Workout{
+			{ID: "W3", Name: "Yoga", Start: at(18, 7), End: at(18, 8), Duration: 3600},
+			{
+				ID: "W1", Name: "Outdoor Walk", Start: at(10, 17), End: at(10, 18), Duration: 1800,
+				HeartRateData: []HeartRateData{{Date: at(10, 17), Avg: 100, Min: 90, Max: 110}},
+			},
+			{ID: "W2", Name: "Outdoor Walk", Start: at(17, 17), End: at(17, 18), Duration: 2400},
+		},
+		Metrics: []Metric{
+			{
+				Name:  "step_count",
+				Units: "count",
+				Data: []MetricRecord{
+					{Date: at(17, 9), Qty: 500},
+					{Date: at(10, 8), Qty: 1000},
+					{Date: at(10, 20), Qty: 3000},
+					{Date: at(11, 8), Qty: 2000},
+				},
+			},
+			{Name: "heart_rate", Units: "count/min", Data: []MetricRecord{{Date: at(10, 8), Qty: 62}}},
+		},
+		StateOfMind: []StateOfMind{
+			{ID: "S2", Kind: "momentary_emotion", Start: at(17, 12), End: at(17, 12), Valence: -0.4, ValenceClassification: "slightly unpleasant", Labels: []interface{}{"stressed"}},
+			{ID: "S1", Kind: "daily_mood", Start: at(10, 21), End: at(10, 21), Valence: 0.6, ValenceClassification: "pleasant", Associations: []interface{}{"family"}},
+		},
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{name: "open", from: "", to: ""},
+		{
+			name:     "dates include the whole last day",
+			from:     "2025-11-10",
+			to:       "2025-11-11",
+			wantFrom: time.Date(2025, 11, 10, 0, 0, 0, 0, time.Local),
+			wantTo:   time.Date(2025, 11, 12, 0, 0, 0, 0, time.Local),
+		},
+		{
+			name:     "timestamps are exact",
+			from:     "2025-11-10T08:00:00Z",
+			to:       "2025-11-10 09:00:00 +0000",
+			wantFrom: time.Date(2025, 11, 10, 8, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2025, 11, 10, 9, 0, 0, 0, time.UTC),
+		},
+		{name: "invalid", from: "last week", wantErr: true},
+		{name: "reversed", from: "2025-11-12", to: "2025-11-10", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseTimeRange(tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTimeRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !r.From.Equal(tt.wantFrom) || !r.To.Equal(tt.wantTo) {
+				t.Errorf("parseTimeRange() = [%v, %v), want [%v, %v)", r.From, r.To, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestListWorkouts(t *testing.T) {
+	idx := newHealthIndex(testHealthData())
+	est := time.FixedZone("EST", -5*3600)
+
+	tests := []struct {
+		name    string
+		filter  workoutFilter
+		wantIDs []string
+	}{
+		{name: "all in start order", wantIDs: []string{"W1", "W2", "W3"}},
+		{name: "by type", filter: workoutFilter{Type: "outdoor walk"}, wantIDs: []string{"W1", "W2"}},
+		{
+			name:    "since",
+			filter:  workoutFilter{Range: timeRange{From: time.Date(2025, 11, 17, 0, 0, 0, 0, est)}},
+			wantIDs: []string{"W2", "W3"},
+		},
+		{name: "no match", filter: workoutFilter{Type: "Swimming"}, wantIDs: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := idx.listWorkouts(tt.filter)
+			if len(got) != len(tt.wantIDs) {
+				t.Fatalf("listWorkouts() returned %d workouts, want %d", len(got), len(tt.wantIDs))
+			}
+			for i, id := range tt.wantIDs {
+				if got[i].ID != id {
+					t.Errorf("listWorkouts()[%d].ID = %v, want %v", i, got[i].ID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkoutDetail(t *testing.T) {
+	idx := newHealthIndex(testHealthData())
+
+	detail, ok := idx.workoutDetail("W1", false)
+	if !ok {
+		t.Fatal("workoutDetail(W1) not found")
+	}
+	if detail.Summary.HeartRateStats == nil || detail.Summary.HeartRateStats.Avg != 100 {
+		t.Errorf("Summary.HeartRateStats = %+v, want avg 100", detail.Summary.HeartRateStats)
+	}
+	if detail.HeartRate != nil {
+		t.Error("HeartRate series included without includeSeries")
+	}
+
+	detail, _ = idx.workoutDetail("W1", true)
+	if len(detail.HeartRate) != 1 {
+		t.Errorf("len(HeartRate) = %d, want 1", len(detail.HeartRate))
+	}
+
+	if _, ok := idx.workoutDetail("missing", false); ok {
+		t.Error("workoutDetail(missing) found a workout")
+	}
+}
+
+func TestMetricSeries(t *testing.T) {
+	idx := newHealthIndex(testHealthData())
+	est := time.FixedZone("EST", -5*3600)
+
+	tests := []struct {
+		name       string
+		metric     string
+		r          timeRange
+		bucket     string
+		wantCounts []int
+		wantSums   []float64
+		wantErr    bool
+	}{
+		{name: "raw records in date order", metric: "step_count", wantCounts: []int{1, 1, 1, 1}, wantSums: []float64{1000, 3000, 2000, 500}},
+		{name: "daily", metric: "step_count", bucket: bucketDay, wantCounts: []int{2, 1, 1}, wantSums: []float64{4000, 2000, 500}},
+		{name: "weekly from monday", metric: "step_count", bucket: bucketWeek, wantCounts: []int{3, 1}, wantSums: []float64{6000, 500}},
+		{name: "monthly", metric: "step_count", bucket: bucketMonth, wantCounts: []int{4}, wantSums: []float64{6500}},
+		{
+			name:       "range",
+			metric:     "Step Count",
+			bucket:     bucketDay,
+			r:          timeRange{From: time.Date(2025, 11, 10, 12, 0, 0, 0, est), To: time.Date(2025, 11, 12, 0, 0, 0, 0, est)},
+			wantCounts: []int{1, 1},
+			wantSums:   []float64{3000, 2000},
+		},
+		{name: "unknown metric", metric: "vo2_max", wantErr: true},
+		{name: "invalid bucket", metric: "step_count", bucket: "year", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series, err := idx.metricSeries(tt.metric, tt.r, tt.bucket)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("metricSeries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(series.Points) != len(tt.wantCounts) {
+				t.Fatalf("metricSeries() returned %d points, want %d", len(series.Points), len(tt.wantCounts))
+			}
+			for i, point := range series.Points {
+				if point.Count != tt.wantCounts[i] || point.Sum != tt.wantSums[i] {
+					t.Errorf("point %d = count %d sum %v, want count %d sum %v", i, point.Count, point.Sum, tt.wantCounts[i], tt.wantSums[i])
+				}
+				if point.Avg != point.Sum/float64(point.Count) {
+					t.Errorf("point %d avg = %v, want %v", i, point.Avg, point.Sum/float64(point.Count))
+				}
+			}
+		})
+	}
+
+	// Daily buckets start at local midnight
+	series, _ := idx.metricSeries("step_count", timeRange{}, bucketDay)
+	if want := time.Date(2025, 11, 10, 0, 0, 0, 0, est); !series.Points[0].Time.Equal(want) {
+		t.Errorf("first bucket = %v, want %v", series.Points[0].Time, want)
+	}
+}
+
+func TestHealthIndexMergesRepeatedMetrics(t *testing.T) {
+	data := testHealthData()
+	steps := data.Metrics[0]
+	// A second source repeating one record and adding another
+	data.Metrics = append(data.Metrics, Metric{
+		Name:  "Step Count",
+		Units: "count",
+		Data:  []MetricRecord{steps.Data[0], {Date: steps.Data[0].Date.Add(time.Hour), Qty: 700}},
+	})
+
+	idx := newHealthIndex(data)
+	series, err := idx.metricSeries("step_count", timeRange{}, "")
+	if err != nil {
+		t.Fatalf("metricSeries() error = %v", err)
+	}
+	summary, ok := idx.metricSummary("step_count")
+	if !ok {
+		t.Fatal("metricSummary() found no step_count")
+	}
+	if len(series.Points) != 5 || summary.DataPoints != 5 || len(idx.metrics) != 2 {
+		t.Errorf("got %d points, %d summary data points and %d metrics; want 5, 5 and 2", len(series.Points), summary.DataPoints, len(idx.metrics))
+	}
+	if len(data.Metrics[0].Data) != 4 {
+		t.Error("newHealthIndex() modified its input")
+	}
+}
+
+func TestMoodTimeline(t *testing.T) {
+	idx := newHealthIndex(testHealthData())
+
+	entries := idx.moodTimeline(timeRange{}, "")
+	if len(entries) != 2 || entries[0].ID != "S1" || entries[1].ID != "S2" {
+		t.Fatalf("moodTimeline() = %+v, want S1, S2", entries)
+	}
+	if len(entries[1].Labels) != 1 || entries[1].Labels[0] != "stressed" {
+		t.Errorf("Labels = %v, want [stressed]", entries[1].Labels)
+	}
+
+	entries = idx.moodTimeline(timeRange{}, "daily_mood")
+	if len(entries) != 1 || entries[0].ID != "S1" {
+		t.Errorf("moodTimeline(daily_mood) = %+v, want S1", entries)
+	}
+}
+
+func TestOverview(t *testing.T) {
+	overview := newHealthIndex(testHealthData()).overview()
+
+	if overview.Workouts.Total != 3 || overview.Workouts.Types["Outdoor Walk"] != 2 {
+		t.Errorf("Workouts = %+v, want 3 total with 2 Outdoor Walk", overview.Workouts)
+	}
+	if len(overview.Metrics) != 2 || overview.Metrics[0].Name != "heart_rate" || overview.Metrics[1].Family != "activity" {
+		t.Errorf("Metrics = %+v, want heart_rate then step_count (activity)", overview.Metrics)
+	}
+	if overview.StateOfMind.Classifications["pleasant"] != 1 {
+		t.Errorf("StateOfMind = %+v, want one pleasant entry", overview.StateOfMind)
+	}
+}
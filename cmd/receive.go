@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"filippo.io/age"
+	"github.com/rs/xid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	receiveListen    string
+	receiveToken     string
+	receiveDataDir   string
+	receiveExportDir string
+)
+
+// maxPayloadBytes bounds the size of a single ingested payload.
+const maxPayloadBytes = 256 << 20
+
+// Suffixes of stored payloads that are being exported, and that failed to
+// export. Neither is replayed as seen on restart.
+const (
+	pendingSuffix = ".pending"
+	failedSuffix  = ".failed"
+)
+
+// receiveCmd runs the HTTP ingestion endpoint
+var receiveCmd = &cobra.Command{
+	Use:   "receive",
+	Short: "Receive health data posted by Health Auto Export REST automations",
+	Long: `Run an HTTP server that accepts health export payloads posted by Health Auto
+Export REST API automations and processes them as they arrive.
+
+Requests to POST /ingest must carry the shared token, either as
+"Authorization: Bearer <token>" or in an "X-API-Token" header. Each accepted
+payload is stored under <data-dir>/payloads/, then the records not seen in
+earlier payloads are exported, with import batches, to <export>/<receipt-id>/.
+With --encrypt, stored payloads are encrypted too, and read back on start with
+--identity or the passphrase in AHEP_PASSPHRASE.
+
+The token is read from --token, the receive-token config key or the
+AHEP_RECEIVE_TOKEN environment variable.`,
+	Example: `  # Receive on all interfaces so a phone on the LAN can post
+  AHEP_RECEIVE_TOKEN=s3cret apple-health-export-parser receive --listen :8090
+
+  # Post a payload by hand
+  curl -H 'Authorization: Bearer s3cret' --data @health-export.json http://localhost:8090/ingest`,
+	Args: cobra.NoArgs,
+	RunE: runReceive,
+}
+
+func init() {
+	rootCmd.AddCommand(receiveCmd)
+
+	receiveCmd.Flags().StringVar(&receiveListen, "listen", ":8090", "address to listen on")
+	receiveCmd.Flags().StringVar(&receiveToken, "token", "", "shared token clients must present (prefer AHEP_RECEIVE_TOKEN)")
+	receiveCmd.Flags().StringVar(&receiveDataDir, "data-dir", "received", "directory for stored raw payloads")
+	receiveCmd.Flags().StringVarP(&receiveExportDir, "export", "e", "exports", "directory for processed exports, one subdirectory per payload")
+	receiveCmd.Flags().IntVar(&exportWorkers, "workers", runtime.NumCPU(), "number of records exported concurrently")
+	addEncryptionFlags(receiveCmd)
+	receiveCmd.Flags().StringSliceVarP(&decryptIdentities, "identity", "i", []string{}, "age identity file to read encrypted stored payloads on start (repeatable; default: passphrase in AHEP_PASSPHRASE)")
+	receiveCmd.Flags().StringSliceVarP(&targetCollections, "collections", "c", []string{}, "target collections for MCP import (comma-separated)")
+
+	viper.BindPFlag("receive-token", receiveCmd.Flags().Lookup("token"))
+	viper.BindEnv("receive-token", "AHEP_RECEIVE_TOKEN")
+}
+
+// runReceive executes the receive command
+func runReceive(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	token := viper.GetString("receive-token")
+	if token == "" {
+		return fmt.Errorf("a shared token is required: set --token, receive-token or AHEP_RECEIVE_TOKEN")
+	}
+
+	if err := configureExport(); err != nil {
+		return err
+	}
+
+	recv, err := newReceiver(token, receiveDataDir, receiveExportDir)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              receiveListen,
+		Handler:           recv.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return runHTTPServer(ctx, server)
+}
+
+// receiver stores and incrementally processes ingested payloads.
+type receiver struct {
+	token      string
+	payloadDir string
+	exportDir  string
+
+	mu   sync.Mutex // Serializes processing; the export pipeline uses package state
+	seen *seenRecords
+}
+
+// ReceiveCounts counts the records in a payload.
+type ReceiveCounts struct {
+	Workouts      int `json:"workouts"`
+	MetricRecords int `json:"metricRecords"`
+	StateOfMind   int `json:"stateOfMind"`
+	Other         int `json:"other"` // ECG, heart rate notifications and symptoms
+}
+
+// ReceiveResult is the response to an accepted payload.
+type ReceiveResult struct {
+	ID        string        `json:"id"`
+	Payload   string        `json:"payload"`             // Stored raw payload file
+	ExportDir string        `json:"exportDir,omitempty"` // Empty when the payload held no new records
+	Received  ReceiveCounts `json:"received"`
+	New       ReceiveCounts `json:"new"`
+}
+
+// newReceiver creates a receiver, replaying the payloads stored in dataDir so
+// records received before a restart are not exported again.
+func newReceiver(token, dataDir, exportDir string) (*receiver, error) {
+	recv := &receiver{
+		token:      token,
+		payloadDir: filepath.Join(dataDir, "payloads"),
+		exportDir:  exportDir,
+		seen:       newSeenRecords(),
+	}
+	if err := os.MkdirAll(recv.payloadDir, 0700); err != nil {
+		return nil, fmt.Errorf("creating payload directory: %w", err)
+	}
+
+	// Payloads left pending by a crash were not exported
+	pending, _ := filepath.Glob(filepath.Join(recv.payloadDir, "*"+pendingSuffix))
+	for _, file := range pending {
+		failed := strings.TrimSuffix(file, pendingSuffix) + failedSuffix
+		if err := os.Rename(file, failed); err != nil {
+			slog.Warn("Failed to set aside interrupted payload", "file", file, "error", err)
+			continue
+		}
+		slog.Warn("Set aside payload whose export was interrupted", "file", failed)
+	}
+
+	plain, err := filepath.Glob(filepath.Join(recv.payloadDir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("listing stored payloads: %w", err)
+	}
+	encrypted, err := filepath.Glob(filepath.Join(recv.payloadDir, "*.json"+ageSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("listing stored payloads: %w", err)
+	}
+	var identities []age.Identity
+	if len(encrypted) > 0 {
+		if identities, err = loadIdentities(decryptIdentities, viper.GetString("passphrase")); err != nil {
+			slog.Warn("Cannot read encrypted stored payloads; their records will be exported again", "error", err)
+			encrypted = nil
+		}
+	}
+
+	files := append(plain, encrypted...)
+	sort.Strings(files)
+	for _, file := range files {
+		healthData, err := loadStoredPayload(file, identities)
+		if err != nil {
+			slog.Warn("Skipping unreadable stored payload", "file", file, "error", err)
+			continue
+		}
+		recv.seen.mark(healthData.Data)
+	}
+	slog.Info("Loaded stored payloads", "dir", recv.payloadDir, "count", len(files))
+	return recv, nil
+}
+
+// loadStoredPayload reads a stored payload, decrypting it with identities
+// when its name ends in .age.
+func loadStoredPayload(file string, identities []age.Identity) (HealthData, error) {
+	if !strings.HasSuffix(file, ageSuffix) {
+		return loadHealthData(file, formatAuto)
+	}
+	r, err := openExportFile(file, identities)
+	if err != nil {
+		return HealthData{}, err
+	}
+	defer r.Close()
+	return decodeHealthData(r, formatAuto)
+}
+
+// handler returns the receiver's HTTP routes.
+func (recv *receiver) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /ingest", recv.handleIngest)
+	return mux
+}
+
+// authorized reports whether the request carries the shared token.
+func (recv *receiver) authorized(r *http.Request) bool {
+	presented := r.Header.Get("X-API-Token")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, value, _ := strings.Cut(auth, " ")
+		if strings.EqualFold(scheme, "Bearer") {
+			presented = strings.TrimSpace(value)
+		}
+	}
+	return presented != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(recv.token)) == 1
+}
+
+// handleIngest serves POST /ingest.
+func (recv *receiver) handleIngest(w http.ResponseWriter, r *http.Request) {
+	id := time.Now().UTC().Format("20060102T150405Z") + "_" + xid.New().String()
+	logger := slog.Default().With("receipt_id", id, "remote", r.RemoteAddr)
+
+	if !recv.authorized(r) {
+		logger.Warn("Rejected unauthorized payload")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="receive"`)
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("payload exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, fmt.Errorf("reading payload: %w", err))
+		return
+	}
+
+	healthData, err := decodeHealthAutoExportJSON(bytes.NewReader(body))
+	if err != nil {
+		logger.Warn("Rejected invalid payload", "error", err)
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decoding payload: %w", err))
+		return
+	}
+
+	result, err := recv.process(id, body, healthData, logger)
+	if err != nil {
+		logger.Error("Failed to process payload", "error", err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// process stores a payload and exports the records not seen before, with
+// the fields of the payload the parser does not interpret.
+func (recv *receiver) process(id string, body []byte, healthData HealthData, logger *slog.Logger) (*ReceiveResult, error) {
+	data := healthData.Data
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+
+	payloadFile, stored := filepath.Join(recv.payloadDir, id+".json"), body
+	if exportEncryption != nil {
+		var err error
+		if stored, err = exportEncryption.encryptFile(body); err != nil {
+			return nil, fmt.Errorf("encrypting payload: %w", err)
+		}
+		payloadFile += ageSuffix
+	}
+	// Stored as pending until exported, so that an export interrupted by a
+	// crash is not replayed as seen on restart
+	pendingFile := payloadFile + pendingSuffix
+	if err := writeFileAtomic(pendingFile, stored, 0600); err != nil {
+		return nil, fmt.Errorf("storing payload: %w", err)
+	}
+
+	newData := recv.seen.filterNew(data)
+	result := &ReceiveResult{
+		ID:       id,
+		Payload:  payloadFile,
+		Received: countRecords(data),
+		New:      countRecords(newData),
+	}
+
+	if result.New == (ReceiveCounts{}) {
+		if err := os.Rename(pendingFile, payloadFile); err != nil {
+			return nil, fmt.Errorf("storing payload: %w", err)
+		}
+		logger.Info("Payload contained no new records", "received", result.Received)
+		return result, nil
+	}
+
+	exportDir := filepath.Join(recv.exportDir, id)
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return nil, recv.failPayload(pendingFile, payloadFile, fmt.Errorf("creating export directory: %w", err))
+	}
+	// The payload is stored, so the export runs to completion even if the
+	// client goes away
+	source := exportSource{Path: payloadFile, SHA256: contentDigest(stored)}
+	if err := exportData(context.Background(), HealthData{Data: newData, Extras: healthData.Extras}, source, exportDir); err != nil {
+		return nil, recv.failPayload(pendingFile, payloadFile, fmt.Errorf("exporting payload: %w", err))
+	}
+	if err := os.Rename(pendingFile, payloadFile); err != nil {
+		return nil, fmt.Errorf("storing payload: %w", err)
+	}
+	recv.seen.mark(newData)
+	result.ExportDir = exportDir
+
+	logger.Info("Processed payload", "export_dir", exportDir, "received", result.Received, "new", result.New)
+	return result, nil
+}
+
+// failPayload sets the pending payload that could not be exported aside as
+// payloadFile with the .failed suffix, so it is neither replayed as seen on
+// restart nor lost, and returns err.
+func (recv *receiver) failPayload(pendingFile, payloadFile string, err error) error {
+	if renameErr := os.Rename(pendingFile, payloadFile+failedSuffix); renameErr != nil {
+		slog.Warn("Failed to set aside payload", "file", pendingFile, "error", renameErr)
+	}
+	return err
+}
+
+// countRecords counts the records in data.
+func countRecords(data Data) ReceiveCounts {
+	counts := ReceiveCounts{
+		Workouts:    len(data.Workouts),
+		StateOfMind: len(data.StateOfMind),
+		Other:       len(data.ECG) + len(data.HeartRateNotifications) + len(data.Symptoms),
+	}
+	for _, metric := range data.Metrics {
+		counts.MetricRecords += len(metric.Data)
+	}
+	return counts
+}
+
+// seenRecords tracks the records already processed, for incremental exports.
+type seenRecords struct {
+	workouts map[string]bool
+	moods    map[string]bool
+	metrics  map[string]map[metricRecordKey]bool
+	other    map[string]bool // Content hashes of ECG, notification and symptom records
+}
+
+// newSeenRecords creates an empty record tracker.
+func newSeenRecords() *seenRecords {
+	return &seenRecords{
+		workouts: make(map[string]bool),
+		moods:    make(map[string]bool),
+		metrics:  make(map[string]map[metricRecordKey]bool),
+		other:    make(map[string]bool),
+	}
+}
+
+// filterNew returns the records of data that have not been marked as seen.
+// Metrics keep only their unseen records and are dropped when none remain.
+// Uninterpreted data categories have no records to compare and are kept.
+func (s *seenRecords) filterNew(data Data) Data {
+	var fresh Data
+	for _, workout := range data.Workouts {
+		if workout.ID == "" || !s.workouts[workout.ID] {
+			fresh.Workouts = append(fresh.Workouts, workout)
+		}
+	}
+	for _, som := range data.StateOfMind {
+		if som.ID == "" || !s.moods[som.ID] {
+			fresh.StateOfMind = append(fresh.StateOfMind, som)
+		}
+	}
+	for _, metric := range data.Metrics {
+		seen := s.metrics[metricKey(metric.Name)]
+		var records []MetricRecord
+		for _, record := range metric.Data {
+			if !seen[newMetricRecordKey(record)] {
+				records = append(records, record)
+			}
+		}
+		if len(records) > 0 {
+			m := metric
+			m.Data = records
+			fresh.Metrics = append(fresh.Metrics, m)
+		}
+	}
+	fresh.ECG = s.filterOther(data.ECG)
+	fresh.HeartRateNotifications = s.filterOther(data.HeartRateNotifications)
+	fresh.Symptoms = s.filterOther(data.Symptoms)
+	fresh.Extras = data.Extras
+	return fresh
+}
+
+// filterOther returns the untyped records whose content has not been seen.
+func (s *seenRecords) filterOther(records []interface{}) []interface{} {
+	var fresh []interface{}
+	for _, record := range records {
+		if !s.other[contentHash(record)] {
+			fresh = append(fresh, record)
+		}
+	}
+	return fresh
+}
+
+// mark records every record of data as seen.
+func (s *seenRecords) mark(data Data) {
+	for _, workout := range data.Workouts {
+		s.workouts[workout.ID] = true
+	}
+	for _, som := range data.StateOfMind {
+		s.moods[som.ID] = true
+	}
+	for _, metric := range data.Metrics {
+		key := metricKey(metric.Name)
+		if s.metrics[key] == nil {
+			s.metrics[key] = make(map[metricRecordKey]bool)
+		}
+		for _, record := range metric.Data {
+			s.metrics[key][newMetricRecordKey(record)] = true
+		}
+	}
+	for _, records := range [][]interface{}{data.ECG, data.HeartRateNotifications, data.Symptoms} {
+		for _, record := range records {
+			s.other[contentHash(record)] = true
+		}
+	}
+}
+
+// contentHash identifies an untyped record by a hash of its JSON encoding.
+func contentHash(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
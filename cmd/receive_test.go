@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestReceiverIngest(t *testing.T) {
+	dataDir := t.TempDir()
+	exportDir := t.TempDir()
+	recv, err := newReceiver("s3cret", dataDir, exportDir)
+	if err != nil {
+		t.Fatalf("newReceiver() error = %v", err)
+	}
+
+	first, err := json.Marshal(HealthData{Data: testHealthData()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Overlaps the first payload: one known workout plus one new one
+	data := testHealthData()
+	data.Workouts = []Workout{data.Workouts[0], {ID: "W4", Name: "Swimming", Start: time.Date(2025, 11, 20, 7, 0, 0, 0, time.UTC)}}
+	data.Metrics = nil
+	data.StateOfMind = nil
+	second, err := json.Marshal(HealthData{Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		body       string
+		wantStatus int
+		wantNew    ReceiveCounts
+		wantExport bool
+	}{
+		{name: "missing token", body: string(first), wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", header: "Authorization", value: "Bearer nope", body: string(first), wantStatus: http.StatusUnauthorized},
+		{name: "invalid json", header: "Authorization", value: "Bearer s3cret", body: "{", wantStatus: http.StatusBadRequest},
+		{
+			name:       "new payload",
+			header:     "Authorization",
+			value:      "Bearer s3cret",
+			body:       string(first),
+			wantStatus: http.StatusOK,
+			wantNew:    ReceiveCounts{Workouts: 3, MetricRecords: 5, StateOfMind: 2},
+			wantExport: true,
+		},
+		{
+			name:       "duplicate payload",
+			header:     "X-API-Token",
+			value:      "s3cret",
+			body:       string(first),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "overlapping payload",
+			header:     "Authorization",
+			value:      "bearer s3cret",
+			body:       string(second),
+			wantStatus: http.StatusOK,
+			wantNew:    ReceiveCounts{Workouts: 1},
+			wantExport: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(tt.body))
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			recv.handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var result ReceiveResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if result.New != tt.wantNew {
+				t.Errorf("new = %+v, want %+v", result.New, tt.wantNew)
+			}
+			if _, err := os.Stat(result.Payload); err != nil {
+				t.Errorf("payload not stored: %v", err)
+			}
+			if (result.ExportDir != "") != tt.wantExport {
+				t.Fatalf("exportDir = %q, want export %v", result.ExportDir, tt.wantExport)
+			}
+			if tt.wantExport {
+				if _, err := os.Stat(filepath.Join(result.ExportDir, "manifest.json")); err != nil {
+					t.Errorf("export has no manifest: %v", err)
+				}
+			}
+		})
+	}
+
+	// A restarted receiver replays stored payloads and treats them as seen
+	restarted, err := newReceiver("s3cret", dataDir, exportDir)
+	if err != nil {
+		t.Fatalf("newReceiver() after restart error = %v", err)
+	}
+	if fresh := restarted.seen.filterNew(testHealthData()); countRecords(fresh) != (ReceiveCounts{}) {
+		t.Errorf("after restart, new records = %+v, want none", countRecords(fresh))
+	}
+}
+
+func TestReceiverEncryptsPayloads(t *testing.T) {
+	const passphrase = "correct horse battery staple"
+	previousWorkFactor := passphraseWorkFactor
+	passphraseWorkFactor = 10
+	viper.Set("passphrase", passphrase)
+	defer func() {
+		passphraseWorkFactor = previousWorkFactor
+		viper.Set("passphrase", "")
+		exportEncryption = nil
+	}()
+	enc, err := newExportEncrypter(true, nil, "", passphrase, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportEncryption = enc
+
+	dataDir := t.TempDir()
+	recv, err := newReceiver("s3cret", dataDir, t.TempDir())
+	if err != nil {
+		t.Fatalf("newReceiver() error = %v", err)
+	}
+	body, err := json.Marshal(HealthData{Data: testHealthData()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := recv.process("r1", body, HealthData{Data: testHealthData()}, slog.Default())
+	if err != nil {
+		t.Fatalf("process() error = %v", err)
+	}
+
+	if !strings.HasSuffix(result.Payload, ".json"+ageSuffix) {
+		t.Errorf("payload stored as %s, want .json.age", result.Payload)
+	}
+	stored, err := os.ReadFile(result.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(stored), "age-encryption.org/v1\n") || strings.Contains(string(stored), `"workouts"`) {
+		t.Error("stored payload is not encrypted")
+	}
+
+	// A restarted receiver decrypts stored payloads with the passphrase
+	restarted, err := newReceiver("s3cret", dataDir, t.TempDir())
+	if err != nil {
+		t.Fatalf("newReceiver() after restart error = %v", err)
+	}
+	if fresh := restarted.seen.filterNew(testHealthData()); countRecords(fresh) != (ReceiveCounts{}) {
+		t.Errorf("after restart, new records = %+v, want none", countRecords(fresh))
+	}
+}
+
+func TestSeenRecordsFilterNewKeepsExtras(t *testing.T) {
+	data := testHealthData()
+	data.Metrics[0].Extras = Extras{"aggregation": json.RawMessage(`"sum"`)}
+
+	seen := newSeenRecords()
+	seen.mark(Data{Metrics: []Metric{{Name: "step_count", Data: data.Metrics[0].Data[:1]}}})
+	fresh := seen.filterNew(data)
+
+	if len(fresh.Metrics) == 0 || string(fresh.Metrics[0].Extras["aggregation"]) != `"sum"` {
+		t.Errorf("filterNew() metrics = %+v, want extras kept", fresh.Metrics)
+	}
+	if got := len(fresh.Metrics[0].Data); got != len(data.Metrics[0].Data)-1 {
+		t.Errorf("filterNew() kept %d records, want %d", got, len(data.Metrics[0].Data)-1)
+	}
+}
+
+func TestReceiverFailedExportIsNotSeen(t *testing.T) {
+	dataDir := t.TempDir()
+	blocked := filepath.Join(t.TempDir(), "exports")
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	recv, err := newReceiver("s3cret", dataDir, blocked)
+	if err != nil {
+		t.Fatalf("newReceiver() error = %v", err)
+	}
+	body, err := json.Marshal(HealthData{Data: testHealthData()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := recv.process("r1", body, HealthData{Data: testHealthData()}, slog.Default()); err == nil {
+		t.Fatal("process() into an unwritable export directory succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "payloads", "r1.json"+failedSuffix)); err != nil {
+		t.Errorf("failed payload not set aside: %v", err)
+	}
+
+	// An export interrupted by a crash leaves a pending payload
+	writeTestFile(t, filepath.Join(dataDir, "payloads"), "r2.json"+pendingSuffix, string(body))
+	restarted, err := newReceiver("s3cret", dataDir, t.TempDir())
+	if err != nil {
+		t.Fatalf("newReceiver() after restart error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "payloads", "r2.json"+failedSuffix)); err != nil {
+		t.Errorf("interrupted payload not set aside: %v", err)
+	}
+
+	// Neither payload was exported, so the records are new when received again
+	for i, r := range []*receiver{recv, restarted} {
+		r.exportDir = t.TempDir()
+		result, err := r.process(fmt.Sprintf("r%d", i+3), body, HealthData{Data: testHealthData()}, slog.Default())
+		if err != nil {
+			t.Fatalf("process() error = %v", err)
+		}
+		if result.New != countRecords(testHealthData()) {
+			t.Errorf("new = %+v, want every record", result.New)
+		}
+		if _, err := os.Stat(result.Payload); err != nil {
+			t.Errorf("payload not stored: %v", err)
+		}
+	}
+}
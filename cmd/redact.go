@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// GPS redaction modes.
+const (
+	gpsKeep    = "keep"
+	gpsCoarsen = "coarsen"
+	gpsDrop    = "drop"
+)
+
+// defaultGeohashPrecision is the geohash length coarsened coordinates are
+// snapped to when none is configured: cells of about 1.2 by 0.6 km.
+const defaultGeohashPrecision = 6
+
+// defaultPrivacyLevel is the privacy level of memories whose type has none
+// configured.
+const defaultPrivacyLevel = "private"
+
+// sourceKeys are the keys naming the recording device or app in untyped
+// records, metadata and extras, compared case-insensitively.
+var sourceKeys = []string{"source", "sourcename", "sourceversion", "device"}
+
+// redaction is the redaction policy loaded from the config file.
+var redaction RedactionPolicy
+
+// RedactionPolicy removes or coarsens personal data before it is exported.
+// It applies to the data itself, so export files, workout summaries and
+// memories all see the same redacted records. It is read from the
+// "redaction" key of the config file, for example:
+//
+//	redaction:
+//	  gps: coarsen
+//	  geohash_precision: 5
+//	  trim_route_ends_meters: 200
+//	  drop_sources: true
+//	  drop_state_of_mind_labels: true
+//	  privacy_levels:
+//	    mental_health_log: sensitive
+type RedactionPolicy struct {
+	GPS                         string            `mapstructure:"gps" json:"gps,omitempty"`                                                     // keep, coarsen or drop
+	GeohashPrecision            int               `mapstructure:"geohash_precision" json:"geohashPrecision,omitempty"`                          // Geohash length coordinates are coarsened to
+	TrimRouteEndsMeters         float64           `mapstructure:"trim_route_ends_meters" json:"trimRouteEndsMeters,omitempty"`                  // Route points this close to the start or end are removed
+	DropSources                 bool              `mapstructure:"drop_sources" json:"dropSources,omitempty"`                                    // Remove device and app names
+	DropStateOfMindLabels       bool              `mapstructure:"drop_state_of_mind_labels" json:"dropStateOfMindLabels,omitempty"`             // Remove state of mind labels
+	DropStateOfMindAssociations bool              `mapstructure:"drop_state_of_mind_associations" json:"dropStateOfMindAssociations,omitempty"` // Remove state of mind associations
+	PrivacyLevels               map[string]string `mapstructure:"privacy_levels" json:"privacyLevels,omitempty"`                                // Memory privacy level by memory type
+}
+
+// loadRedactionPolicy reads and validates the redaction policy from the
+// "redaction" config key.
+func loadRedactionPolicy(v *viper.Viper) (RedactionPolicy, error) {
+	var policy RedactionPolicy
+	if err := v.UnmarshalKey("redaction", &policy); err != nil {
+		return policy, fmt.Errorf("parsing redaction policy: %w", err)
+	}
+
+	switch policy.GPS {
+	case "":
+		policy.GPS = gpsKeep
+	case gpsKeep, gpsCoarsen, gpsDrop:
+	default:
+		return policy, fmt.Errorf("redaction: invalid gps: %s (valid: keep, coarsen, drop)", policy.GPS)
+	}
+	if policy.GeohashPrecision == 0 {
+		policy.GeohashPrecision = defaultGeohashPrecision
+	}
+	if policy.GeohashPrecision < 1 || policy.GeohashPrecision > 12 {
+		return policy, fmt.Errorf("redaction: invalid geohash_precision: %d (must be 1 to 12)", policy.GeohashPrecision)
+	}
+	if policy.TrimRouteEndsMeters < 0 {
+		return policy, fmt.Errorf("redaction: invalid trim_route_ends_meters: %v (must not be negative)", policy.TrimRouteEndsMeters)
+	}
+
+	memoryTypes := []string{memoryTypeWorkout, memoryTypeMetric, memoryTypeStateOfMind}
+	for memoryType, level := range policy.PrivacyLevels {
+		if !containsString(memoryTypes, memoryType) {
+			return policy, fmt.Errorf("redaction: unknown memory type in privacy_levels: %s (valid: %s)", memoryType, strings.Join(memoryTypes, ", "))
+		}
+		if level == "" {
+			return policy, fmt.Errorf("redaction: empty privacy level for %s", memoryType)
+		}
+	}
+
+	if policy.active() {
+		slog.Debug("Loaded redaction policy", "gps", policy.GPS, "drop_sources", policy.DropSources)
+	}
+	return policy, nil
+}
+
+// active reports whether the policy changes anything.
+func (p RedactionPolicy) active() bool {
+	return p.redactsData() || len(p.PrivacyLevels) > 0
+}
+
+// redactsData reports whether the policy changes the exported records.
+func (p RedactionPolicy) redactsData() bool {
+	return p.GPS == gpsCoarsen || p.GPS == gpsDrop || p.TrimRouteEndsMeters > 0 ||
+		p.DropSources || p.DropStateOfMindLabels || p.DropStateOfMindAssociations
+}
+
+// redactsValues reports whether untyped values, such as metadata, routes and
+// extras, need to be walked.
+func (p RedactionPolicy) redactsValues() bool {
+	return p.GPS == gpsCoarsen || p.GPS == gpsDrop || p.DropSources
+}
+
+// privacyLevel returns the privacy level of memories of memoryType.
+func privacyLevel(memoryType string) string {
+	if level, ok := redaction.PrivacyLevels[memoryType]; ok {
+		return level
+	}
+	return defaultPrivacyLevel
+}
+
+// apply returns data with the policy applied. data itself is not modified.
+func (p RedactionPolicy) apply(data Data) Data {
+	if !p.redactsData() {
+		return data
+	}
+
+	out := data
+	out.Metrics = make([]Metric, len(data.Metrics))
+	for i, metric := range data.Metrics {
+		metric.Data = slices.Clone(metric.Data)
+		for j := range metric.Data {
+			record := &metric.Data[j]
+			record.Source = p.redactSource(record.Source)
+			record.Extras = p.redactExtras(record.Extras)
+		}
+		metric.Extras = p.redactExtras(metric.Extras)
+		out.Metrics[i] = metric
+	}
+	out.Extras = p.redactExtras(data.Extras)
+
+	out.Workouts = make([]Workout, len(data.Workouts))
+	for i, workout := range data.Workouts {
+		out.Workouts[i] = p.redactWorkout(workout)
+	}
+
+	out.StateOfMind = make([]StateOfMind, len(data.StateOfMind))
+	for i, som := range data.StateOfMind {
+		if p.DropStateOfMindLabels {
+			som.Labels = nil
+		}
+		if p.DropStateOfMindAssociations {
+			som.Associations = nil
+		}
+		som.Extras = p.redactExtras(som.Extras)
+		out.StateOfMind[i] = som
+	}
+
+	out.ECG = p.redactRecords(data.ECG)
+	out.HeartRateNotifications = p.redactRecords(data.HeartRateNotifications)
+	out.Symptoms = p.redactRecords(data.Symptoms)
+	return out
+}
+
+// redactWorkout applies the policy to a workout and its series.
+func (p RedactionPolicy) redactWorkout(w Workout) Workout {
+	if p.GPS == gpsDrop {
+		w.Location, w.Route = nil, nil
+	} else {
+		if w.Route != nil && (p.TrimRouteEndsMeters > 0 || p.redactsValues()) {
+			route := toJSONValue(w.Route)
+			if points, ok := route.([]interface{}); ok && p.TrimRouteEndsMeters > 0 {
+				route = trimRouteEnds(points, p.TrimRouteEndsMeters)
+			}
+			w.Route = p.redactValue(route)
+		}
+		if w.Location != nil && p.redactsValues() {
+			w.Location = p.redactValue(toJSONValue(w.Location))
+		}
+	}
+	if w.Metadata != nil && p.redactsValues() {
+		w.Metadata = p.redactValue(toJSONValue(w.Metadata))
+	}
+
+	w.ActiveEnergy = slices.Clone(w.ActiveEnergy)
+	for i := range w.ActiveEnergy {
+		w.ActiveEnergy[i].Source = p.redactSource(w.ActiveEnergy[i].Source)
+		w.ActiveEnergy[i].Extras = p.redactExtras(w.ActiveEnergy[i].Extras)
+	}
+	w.HeartRateData = p.redactHeartRates(w.HeartRateData)
+	w.HeartRateRecovery = p.redactHeartRates(w.HeartRateRecovery)
+	w.StepCount = slices.Clone(w.StepCount)
+	for i := range w.StepCount {
+		w.StepCount[i].Source = p.redactSource(w.StepCount[i].Source)
+		w.StepCount[i].Extras = p.redactExtras(w.StepCount[i].Extras)
+	}
+	w.WalkingAndRunningDistance = slices.Clone(w.WalkingAndRunningDistance)
+	for i := range w.WalkingAndRunningDistance {
+		w.WalkingAndRunningDistance[i].Source = p.redactSource(w.WalkingAndRunningDistance[i].Source)
+		w.WalkingAndRunningDistance[i].Extras = p.redactExtras(w.WalkingAndRunningDistance[i].Extras)
+	}
+	w.Extras = p.redactExtras(w.Extras)
+	return w
+}
+
+func (p RedactionPolicy) redactHeartRates(records []HeartRateData) []HeartRateData {
+	records = slices.Clone(records)
+	for i := range records {
+		records[i].Source = p.redactSource(records[i].Source)
+		records[i].Extras = p.redactExtras(records[i].Extras)
+	}
+	return records
+}
+
+// redactSource returns source, or nothing when sources are dropped.
+func (p RedactionPolicy) redactSource(source string) string {
+	if p.DropSources {
+		return ""
+	}
+	return source
+}
+
+// redactRecords applies the policy to untyped records, such as ECGs.
+func (p RedactionPolicy) redactRecords(records []interface{}) []interface{} {
+	if records == nil || !p.redactsValues() {
+		return records
+	}
+	out := make([]interface{}, len(records))
+	for i, record := range records {
+		out[i] = p.redactValue(toJSONValue(record))
+	}
+	return out
+}
+
+// redactExtras applies the policy to the unrecognized fields of a record as
+// if they were fields of an object, returning a new map.
+func (p RedactionPolicy) redactExtras(extras Extras) Extras {
+	if len(extras) == 0 || !p.redactsValues() {
+		return extras
+	}
+	object := make(map[string]interface{}, len(extras))
+	for key, raw := range extras {
+		object[key] = decodeJSONValue(raw)
+	}
+	p.redactValue(object)
+
+	out := make(Extras, len(object))
+	for key, value := range object {
+		data, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		out[key] = data
+	}
+	return out
+}
+
+// redactValue applies the policy to a generic JSON value in place and
+// returns it: source keys are removed, and objects with coordinates are
+// coarsened or stripped of them.
+func (p RedactionPolicy) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if p.DropSources {
+			for key := range v {
+				if containsString(sourceKeys, strings.ToLower(key)) {
+					delete(v, key)
+				}
+			}
+		}
+		if latKey, lonKey, lat, lon, ok := coordinates(v); ok {
+			switch p.GPS {
+			case gpsDrop:
+				delete(v, latKey)
+				delete(v, lonKey)
+			case gpsCoarsen:
+				v[latKey], v[lonKey] = geohashCenter(lat, lon, p.GeohashPrecision)
+			}
+		}
+		for key, value := range v {
+			v[key] = p.redactValue(value)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = p.redactValue(v[i])
+		}
+	}
+	return v
+}
+
+// coordinates returns the latitude and longitude of a GPS point object, as
+// written by Health Auto Export (lat, lon) or read from GPX routes
+// (latitude, longitude).
+func coordinates(object map[string]interface{}) (latKey, lonKey string, lat, lon float64, ok bool) {
+	for key, value := range object {
+		f, isNumber := jsonFloat(value)
+		if !isNumber {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "lat", "latitude":
+			latKey, lat = key, f
+		case "lon", "lng", "long", "longitude":
+			lonKey, lon = key, f
+		}
+	}
+	return latKey, lonKey, lat, lon, latKey != "" && lonKey != ""
+}
+
+// trimRouteEnds removes the route points within meters of the first or last
+// point, hiding where a route starts and ends, such as at home.
+func trimRouteEnds(points []interface{}, meters float64) []interface{} {
+	type point struct{ lat, lon float64 }
+	var located []point
+	for _, p := range points {
+		if object, ok := p.(map[string]interface{}); ok {
+			if _, _, lat, lon, ok := coordinates(object); ok {
+				located = append(located, point{lat, lon})
+			}
+		}
+	}
+	if len(located) == 0 {
+		return points
+	}
+	first, last := located[0], located[len(located)-1]
+
+	kept := make([]interface{}, 0, len(points))
+	for _, p := range points {
+		if object, ok := p.(map[string]interface{}); ok {
+			if _, _, lat, lon, ok := coordinates(object); ok {
+				if haversineMeters(lat, lon, first.lat, first.lon) <= meters || haversineMeters(lat, lon, last.lat, last.lon) <= meters {
+					continue
+				}
+			}
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// geohashCenter returns the center of the geohash cell of the given length
+// containing lat, lon.
+func geohashCenter(lat, lon float64, precision int) (float64, float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2 // Geohash interleaves bits starting with longitude
+	latBits := bits / 2
+	return cellCenter(lat, -90, 90, latBits), cellCenter(lon, -180, 180, lonBits)
+}
+
+// cellCenter returns the center of the cell containing v when [min, max] is
+// split into 2^bits cells.
+func cellCenter(v, min, max float64, bits int) float64 {
+	size := (max - min) / math.Exp2(float64(bits))
+	cell := math.Floor((v - min) / size)
+	cell = math.Max(0, math.Min(cell, math.Exp2(float64(bits))-1))
+	return min + (cell+0.5)*size
+}
+
+// haversineMeters returns the great-circle distance between two points.
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371000
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// toJSONValue returns v in its generic JSON form of maps, slices, strings,
+// json.Numbers and bools, which the redaction walks.
+func toJSONValue(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	return decodeJSONValue(data)
+}
+
+// decodeJSONValue decodes data into its generic JSON form, keeping numbers
+// as json.Number so that large integers survive unchanged.
+func decodeJSONValue(data []byte) interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return json.RawMessage(data)
+	}
+	return v
+}
+
+// jsonFloat returns a generic JSON number as a float64.
+func jsonFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
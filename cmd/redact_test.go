@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadRedactionPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		wantGPS   string
+		wantValid bool
+	}{
+		{name: "no redaction section", config: "log-level: info\n", wantGPS: gpsKeep, wantValid: true},
+		{
+			name: "valid policy",
+			config: `
+redaction:
+  gps: coarsen
+  geohash_precision: 5
+  drop_sources: true
+  privacy_levels:
+    mental_health_log: sensitive
+`,
+			wantGPS:   gpsCoarsen,
+			wantValid: true,
+		},
+		{name: "invalid gps", config: "redaction:\n  gps: blur\n"},
+		{name: "invalid precision", config: "redaction:\n  gps: coarsen\n  geohash_precision: 13\n"},
+		{name: "negative trim", config: "redaction:\n  trim_route_ends_meters: -1\n"},
+		{name: "unknown memory type", config: "redaction:\n  privacy_levels:\n    workouts: public\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			if err := v.ReadConfig(strings.NewReader(tt.config)); err != nil {
+				t.Fatalf("reading config: %v", err)
+			}
+
+			policy, err := loadRedactionPolicy(v)
+			if (err == nil) != tt.wantValid {
+				t.Fatalf("loadRedactionPolicy() error = %v, want valid %v", err, tt.wantValid)
+			}
+			if tt.wantValid && policy.GPS != tt.wantGPS {
+				t.Errorf("GPS = %q, want %q", policy.GPS, tt.wantGPS)
+			}
+		})
+	}
+}
+
+func TestGeohashCenter(t *testing.T) {
+	tests := []struct {
+		precision        int
+		wantLat, wantLon float64
+	}{
+		{5, 57.63427734375, 10.39306640625},      // u4pru
+		{6, 57.64801025390625, 10.4095458984375}, // u4pruy
+	}
+	for _, tt := range tests {
+		lat, lon := geohashCenter(57.64911, 10.40744, tt.precision)
+		if lat != tt.wantLat || lon != tt.wantLon {
+			t.Errorf("geohashCenter(precision %d) = %v, %v; want %v, %v", tt.precision, lat, lon, tt.wantLat, tt.wantLon)
+		}
+	}
+}
+
+func TestRedactionApply(t *testing.T) {
+	start := time.Date(2025, 11, 10, 7, 0, 0, 0, time.UTC)
+	route := []RoutePoint{
+		{Latitude: 57.64911, Longitude: 10.40744, Timestamp: start},
+		{Latitude: 57.65011, Longitude: 10.40744, Timestamp: start.Add(time.Minute)}, // ~110 m from the start
+		{Latitude: 57.66911, Longitude: 10.40744, Timestamp: start.Add(5 * time.Minute)},
+		{Latitude: 57.68911, Longitude: 10.40744, Timestamp: start.Add(10 * time.Minute)},
+	}
+	data := Data{
+		Metrics: []Metric{{Name: "heart_rate", Data: []MetricRecord{{Date: start, Qty: 60, Source: "Jane's Apple Watch"}}}},
+		Workouts: []Workout{{
+			ID: "W1", Name: "Outdoor Walk", Start: start, End: start.Add(time.Hour),
+			Route:         route,
+			Metadata:      map[string]interface{}{"HKIndoorWorkout": "0", "sourceName": "Jane's iPhone"},
+			HeartRateData: []HeartRateData{{Date: start, Avg: 90, Source: "Jane's Apple Watch"}},
+			Extras:        Extras{"startLocation": json.RawMessage(`{"lat":57.64911,"lon":10.40744}`)},
+		}},
+		StateOfMind: []StateOfMind{{ID: "S1", Labels: []interface{}{"Anxious"}, Associations: []interface{}{"Work"}}},
+		Symptoms:    []interface{}{map[string]interface{}{"name": "Headache", "source": "Health"}},
+	}
+
+	policy := RedactionPolicy{GPS: gpsCoarsen, GeohashPrecision: 6, TrimRouteEndsMeters: 200, DropSources: true, DropStateOfMindLabels: true}
+	got := policy.apply(data)
+
+	if got.Metrics[0].Data[0].Source != "" || got.Workouts[0].HeartRateData[0].Source != "" {
+		t.Error("record sources were kept")
+	}
+	if data.Metrics[0].Data[0].Source == "" || data.Workouts[0].HeartRateData[0].Source == "" {
+		t.Error("apply() modified its input")
+	}
+	if metadata := got.Workouts[0].Metadata.(map[string]interface{}); metadata["sourceName"] != nil || metadata["HKIndoorWorkout"] != "0" {
+		t.Errorf("metadata = %v, want sourceName removed and other keys kept", metadata)
+	}
+	if _, ok := got.Symptoms[0].(map[string]interface{})["source"]; ok {
+		t.Error("symptom source was kept")
+	}
+	if got.StateOfMind[0].Labels != nil || got.StateOfMind[0].Associations == nil {
+		t.Errorf("state of mind labels = %v, associations = %v; want labels removed only", got.StateOfMind[0].Labels, got.StateOfMind[0].Associations)
+	}
+
+	// Points within 200 m of either end are trimmed and the rest coarsened
+	points := got.Workouts[0].Route.([]interface{})
+	if len(points) != 1 {
+		t.Fatalf("route has %d points, want 1: %v", len(points), points)
+	}
+	point := points[0].(map[string]interface{})
+	wantLat, wantLon := geohashCenter(57.66911, 10.40744, 6)
+	if point["latitude"] != wantLat || point["longitude"] != wantLon {
+		t.Errorf("route point = %v, want coarsened to %v, %v", point, wantLat, wantLon)
+	}
+	if string(got.Workouts[0].Extras["startLocation"]) != `{"lat":57.64801025390625,"lon":10.4095458984375}` {
+		t.Errorf("startLocation extra = %s, want coarsened", got.Workouts[0].Extras["startLocation"])
+	}
+
+	dropped := RedactionPolicy{GPS: gpsDrop}.apply(data)
+	if dropped.Workouts[0].Route != nil || strings.Contains(string(dropped.Workouts[0].Extras["startLocation"]), "lat") {
+		t.Errorf("gps drop kept route %v and extras %s", dropped.Workouts[0].Route, dropped.Workouts[0].Extras["startLocation"])
+	}
+}
+
+func TestExportDataRedacted(t *testing.T) {
+	previous := redaction
+	redaction = RedactionPolicy{
+		GPS:                   gpsDrop,
+		DropSources:           true,
+		DropStateOfMindLabels: true,
+		PrivacyLevels:         map[string]string{memoryTypeStateOfMind: "sensitive"},
+	}
+	defer func() { redaction = previous }()
+
+	dir := t.TempDir()
+	if err := exportData(context.Background(), HealthData{Data: testHealthData()}, exportSource{}, dir); err != nil {
+		t.Fatalf("exportData() error = %v", err)
+	}
+
+	manifest, data, err := loadExportDir(dir)
+	if err != nil {
+		t.Fatalf("loadExportDir() error = %v", err)
+	}
+	if manifest.Redaction == nil || manifest.Redaction.GPS != gpsDrop {
+		t.Errorf("manifest redaction = %+v, want the policy", manifest.Redaction)
+	}
+	for _, som := range data.StateOfMind {
+		if som.Labels != nil {
+			t.Errorf("exported state of mind %s kept labels %v", som.ID, som.Labels)
+		}
+	}
+
+	batches, _ := filepath.Glob(filepath.Join(dir, "import", "batch_*_state_of_mind.json"))
+	if len(batches) == 0 {
+		t.Fatal("no state of mind batches written")
+	}
+	var memories []Memory
+	if err := readJSONFile(batches[0], &memories); err != nil {
+		t.Fatal(err)
+	}
+	if level := memories[0].Metadata["privacy_level"]; level != "sensitive" {
+		t.Errorf("state of mind privacy_level = %v, want sensitive", level)
+	}
+
+	content, err := os.ReadFile(batches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "stressed") {
+		t.Error("state of mind memory keeps a dropped label")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// routingRules holds the collection routing rules loaded from the config file.
+var routingRules []RoutingRule
+
+// RoutingMatch selects the memories a routing rule applies to.
+// Empty fields match anything; every non-empty field must match (case-insensitive).
+type RoutingMatch struct {
+	Type    string `mapstructure:"type"`    // Memory type (e.g., "mental_health_log")
+	Workout string `mapstructure:"workout"` // Workout name (e.g., "Outdoor Walk")
+	Metric  string `mapstructure:"metric"`  // Metric name (e.g., "heart_rate")
+	Valence string `mapstructure:"valence"` // Valence classification (e.g., "unpleasant")
+}
+
+// RoutingRule routes matching memories to collections and overrides their metadata.
+// Rules are read from the "routing" key of the config file, for example:
+//
+//	routing:
+//	  - match:
+//	      type: mental_health_log
+//	    collections: [mood_journal]
+//	    metadata:
+//	      privacy_level: sensitive
+type RoutingRule struct {
+	Match       RoutingMatch           `mapstructure:"match"`
+	Collections []string               `mapstructure:"collections"` // Replaces the memory's collections
+	Metadata    map[string]interface{} `mapstructure:"metadata"`    // Merged into the memory's metadata
+}
+
+// routeAttributes describes the memory being routed, for rule matching.
+type routeAttributes struct {
+	Type    string
+	Workout string
+	Metric  string
+	Valence string
+}
+
+// loadRoutingRules reads and validates routing rules from the "routing" config key.
+func loadRoutingRules(v *viper.Viper) ([]RoutingRule, error) {
+	var rules []RoutingRule
+	if err := v.UnmarshalKey("routing", &rules); err != nil {
+		return nil, fmt.Errorf("parsing routing rules: %w", err)
+	}
+
+	for i, rule := range rules {
+		if rule.Match == (RoutingMatch{}) {
+			return nil, fmt.Errorf("routing rule %d: match must set at least one of type, workout, metric or valence", i+1)
+		}
+		if len(rule.Collections) == 0 && len(rule.Metadata) == 0 {
+			return nil, fmt.Errorf("routing rule %d: must set collections or metadata", i+1)
+		}
+	}
+
+	if len(rules) > 0 {
+		slog.Debug("Loaded routing rules", "count", len(rules))
+	}
+	return rules, nil
+}
+
+// matches reports whether the rule applies to a memory with the given attributes.
+func (m RoutingMatch) matches(attrs routeAttributes) bool {
+	return matchField(m.Type, attrs.Type) &&
+		matchField(m.Workout, attrs.Workout) &&
+		matchField(m.Metric, attrs.Metric) &&
+		matchField(m.Valence, attrs.Valence)
+}
+
+// matchField reports whether value satisfies pattern; an empty pattern matches anything.
+func matchField(pattern, value string) bool {
+	return pattern == "" || strings.EqualFold(pattern, value)
+}
+
+// applyRouting applies every matching routing rule to memory, in order.
+// A rule's collections replace the memory's collections and its metadata
+// entries override existing keys, so later rules take precedence.
+func applyRouting(memory *Memory, attrs routeAttributes) {
+	for _, rule := range routingRules {
+		if !rule.Match.matches(attrs) {
+			continue
+		}
+		if len(rule.Collections) > 0 {
+			memory.Collections = append([]string(nil), rule.Collections...)
+		}
+		for key, value := range rule.Metadata {
+			memory.Metadata[key] = value
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadRoutingRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		wantRules int
+		wantErr   bool
+	}{
+		{
+			name:      "no routing section",
+			config:    "log-level: info\n",
+			wantRules: 0,
+		},
+		{
+			name: "valid rules",
+			config: `
+routing:
+  - match:
+      type: mental_health_log
+    collections: [mood_journal]
+    metadata:
+      privacy_level: sensitive
+  - match:
+      workout: Outdoor Walk
+    collections: [walks, activity]
+`,
+			wantRules: 2,
+		},
+		{
+			name: "rule without match",
+			config: `
+routing:
+  - collections: [everything]
+`,
+			wantErr: true,
+		},
+		{
+			name: "rule without effect",
+			config: `
+routing:
+  - match:
+      metric: heart_rate
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			if err := v.ReadConfig(strings.NewReader(tt.config)); err != nil {
+				t.Fatalf("reading config: %v", err)
+			}
+
+			rules, err := loadRoutingRules(v)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadRoutingRules() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(rules) != tt.wantRules {
+				t.Errorf("len(rules) = %v, want %v", len(rules), tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestApplyRouting(t *testing.T) {
+	routingRules = []RoutingRule{
+		{
+			Match:       RoutingMatch{Type: memoryTypeStateOfMind},
+			Collections: []string{"mood_journal"},
+			Metadata:    map[string]interface{}{"privacy_level": "sensitive"},
+		},
+		{
+			Match:       RoutingMatch{Type: memoryTypeStateOfMind, Valence: "unpleasant"},
+			Collections: []string{"mood_journal", "follow_up"},
+		},
+		{
+			Match:       RoutingMatch{Workout: "outdoor walk"},
+			Collections: []string{"walks"},
+		},
+	}
+	defer func() { routingRules = nil }()
+
+	tests := []struct {
+		name            string
+		attrs           routeAttributes
+		wantCollections []string
+		wantPrivacy     string
+	}{
+		{
+			name:            "pleasant mood",
+			attrs:           routeAttributes{Type: memoryTypeStateOfMind, Valence: "pleasant"},
+			wantCollections: []string{"mood_journal"},
+			wantPrivacy:     "sensitive",
+		},
+		{
+			name:            "unpleasant mood matches both rules",
+			attrs:           routeAttributes{Type: memoryTypeStateOfMind, Valence: "unpleasant"},
+			wantCollections: []string{"mood_journal", "follow_up"},
+			wantPrivacy:     "sensitive",
+		},
+		{
+			name:            "workout name is case-insensitive",
+			attrs:           routeAttributes{Type: memoryTypeWorkout, Workout: "Outdoor Walk"},
+			wantCollections: []string{"walks"},
+			wantPrivacy:     "private",
+		},
+		{
+			name:            "unmatched memory keeps defaults",
+			attrs:           routeAttributes{Type: memoryTypeMetric, Metric: "step_count"},
+			wantCollections: []string{"default"},
+			wantPrivacy:     "private",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := Memory{
+				Metadata:    map[string]interface{}{"privacy_level": "private"},
+				Collections: []string{"default"},
+			}
+			applyRouting(&memory, tt.attrs)
+
+			if strings.Join(memory.Collections, ",") != strings.Join(tt.wantCollections, ",") {
+				t.Errorf("Collections = %v, want %v", memory.Collections, tt.wantCollections)
+			}
+			if memory.Metadata["privacy_level"] != tt.wantPrivacy {
+				t.Errorf("privacy_level = %v, want %v", memory.Metadata["privacy_level"], tt.wantPrivacy)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Schema versions of Health Auto Export JSON.
+const (
+	schemaV1 = "v1" // Legacy: heart rate series in heartRate, totals as plain numbers or objects
+	schemaV2 = "v2" // Current: heartRateData series, totals as {qty, units} objects
+)
+
+// workoutValueFields are the workout fields holding a {qty, units} value,
+// which legacy exports write as a plain number with an optional
+// "<field>Units" sibling.
+var workoutValueFields = []string{"activeEnergyBurned", "distance", "elevationUp", "humidity", "intensity", "temperature"}
+
+// workoutSummaryFields are legacy and current workout fields holding
+// summaries of the series, which are recomputed rather than imported.
+var workoutSummaryFields = []string{"heartRate", "avgHeartRate", "maxHeartRate"}
+
+// metricRecordQtyFields are the fields that hold a metric record's quantity
+// when it has no qty: the average of heart rate records and the total of
+// sleep analysis records.
+var metricRecordQtyFields = []string{"Avg", "totalSleep", "asleep"}
+
+// Known JSON fields, lower-cased, for reporting unknown ones.
+var (
+	knownDataFields        = jsonFieldNames(reflect.TypeOf(Data{}))
+	knownWorkoutFields     = jsonFieldNames(reflect.TypeOf(Workout{}), workoutSummaryFields...)
+	knownMetricFields      = jsonFieldNames(reflect.TypeOf(Metric{}))
+	knownMetricRecordField = jsonFieldNames(reflect.TypeOf(MetricRecord{}), "Min", "Max", "Avg", "totalSleep", "asleep", "inBed", "core", "deep", "rem", "awake", "sleepStart", "sleepEnd", "inBedStart", "inBedEnd")
+	knownStateOfMindFields = jsonFieldNames(reflect.TypeOf(StateOfMind{}))
+)
+
+// schemaReport describes what decoding an export found and changed.
+type schemaReport struct {
+	Version       string
+	Migrations    map[string]int // Migration name to number of records migrated
+	UnknownFields map[string]int // "workouts.field" to number of records carrying it
+}
+
+// decodeHealthAutoExportJSON decodes Health Auto Export JSON of any schema
+// version, migrating legacy fields onto the current structs and logging a
+// warning for fields the structs have no place for, which are kept as extras.
+func decodeHealthAutoExportJSON(r io.Reader) (HealthData, error) {
+	healthData, report, err := migrateHealthAutoExportJSON(r)
+	if err != nil {
+		return healthData, err
+	}
+
+	level := slog.LevelDebug
+	if report.Version != schemaV2 {
+		level = slog.LevelInfo
+	}
+	slog.Log(context.Background(), level, "Detected Health Auto Export schema", "version", report.Version, "migrations", report.Migrations)
+	if len(report.UnknownFields) > 0 {
+		slog.Warn("Export has fields this version does not interpret; they are kept as extras", "fields", formatFieldCounts(report.UnknownFields))
+	}
+	return healthData, nil
+}
+
+// migrateHealthAutoExportJSON decodes and migrates an export, returning what
+// it found and changed.
+func migrateHealthAutoExportJSON(r io.Reader) (HealthData, schemaReport, error) {
+	report := schemaReport{
+		Version:       schemaV2,
+		Migrations:    make(map[string]int),
+		UnknownFields: make(map[string]int),
+	}
+
+	var document map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&document); err != nil {
+		return HealthData{}, report, fmt.Errorf("decoding JSON: %w", err)
+	}
+	var documentExtras Extras
+	for key, value := range document {
+		if key == "data" {
+			continue
+		}
+		report.UnknownFields[key]++
+		if documentExtras == nil {
+			documentExtras = make(Extras)
+		}
+		documentExtras[key] = value
+	}
+
+	var raw map[string]json.RawMessage
+	if err := unmarshalIfPresent(document["data"], &raw); err != nil {
+		return HealthData{}, report, fmt.Errorf("decoding JSON: data: %w", err)
+	}
+	report.noteUnknown("data", raw, knownDataFields)
+
+	data := Data{Extras: extrasOf(raw, knownDataFields)}
+	if err := decodeWorkouts(raw["workouts"], &data, &report); err != nil {
+		return HealthData{}, report, err
+	}
+	if err := decodeMetrics(raw["metrics"], &data, &report); err != nil {
+		return HealthData{}, report, err
+	}
+
+	var moods []map[string]json.RawMessage
+	if err := unmarshalIfPresent(raw["stateOfMind"], &moods); err != nil {
+		return HealthData{}, report, fmt.Errorf("decoding JSON: stateOfMind: %w", err)
+	}
+	for _, mood := range moods {
+		report.noteUnknown("stateOfMind", mood, knownStateOfMindFields)
+	}
+
+	others := []struct {
+		key    string
+		target interface{}
+	}{
+		{"stateOfMind", &data.StateOfMind},
+		{"ecg", &data.ECG},
+		{"heartRateNotifications", &data.HeartRateNotifications},
+		{"symptoms", &data.Symptoms},
+	}
+	for _, other := range others {
+		if err := unmarshalIfPresent(raw[other.key], other.target); err != nil {
+			return HealthData{}, report, fmt.Errorf("decoding JSON: %s: %w", other.key, err)
+		}
+	}
+
+	return HealthData{Data: data, Extras: documentExtras}, report, nil
+}
+
+// decodeWorkouts migrates and decodes the workouts array.
+func decodeWorkouts(raw json.RawMessage, data *Data, report *schemaReport) error {
+	var workouts []map[string]json.RawMessage
+	if err := unmarshalIfPresent(raw, &workouts); err != nil {
+		return fmt.Errorf("decoding JSON: workouts: %w", err)
+	}
+
+	for i, fields := range workouts {
+		for _, migration := range migrateWorkout(fields) {
+			report.Migrations[migration]++
+			report.Version = schemaV1
+		}
+		report.noteUnknown("workouts", fields, knownWorkoutFields)
+
+		migrated, err := json.Marshal(fields)
+		if err != nil {
+			return fmt.Errorf("decoding JSON: workout %d: %w", i+1, err)
+		}
+		var workout Workout
+		if err := json.Unmarshal(migrated, &workout); err != nil {
+			return fmt.Errorf("decoding JSON: workout %d: %w", i+1, err)
+		}
+		if workout.ID == "" {
+			workout.ID = legacyWorkoutID(workout)
+			report.Migrations["workout id"]++
+		}
+		data.Workouts = append(data.Workouts, workout)
+	}
+	return nil
+}
+
+// migrateWorkout rewrites legacy workout fields in place and returns the
+// names of the migrations it applied.
+func migrateWorkout(fields map[string]json.RawMessage) []string {
+	var applied []string
+
+	// heartRate: legacy series, or a current summary object that is recomputed
+	if hr, ok := fields["heartRate"]; ok && jsonKind(hr) == '[' {
+		if _, exists := fields["heartRateData"]; !exists {
+			fields["heartRateData"] = hr
+		}
+		delete(fields, "heartRate")
+		applied = append(applied, "heartRate series")
+	}
+
+	// activeEnergy: legacy total object rather than a series
+	if energy, ok := fields["activeEnergy"]; ok && jsonKind(energy) == '{' {
+		if _, exists := fields["activeEnergyBurned"]; !exists {
+			fields["activeEnergyBurned"] = energy
+		}
+		delete(fields, "activeEnergy")
+		applied = append(applied, "activeEnergy total")
+	}
+
+	// stepCount: legacy total, kept as a single record at the workout start
+	if steps, ok := fields["stepCount"]; ok && (jsonKind(steps) == '{' || isJSONNumber(steps)) {
+		record := map[string]json.RawMessage{"date": fields["start"]}
+		if isJSONNumber(steps) {
+			record["qty"] = steps
+		} else {
+			var total map[string]json.RawMessage
+			json.Unmarshal(steps, &total)
+			record["qty"], record["units"] = total["qty"], total["units"]
+		}
+		fields["stepCount"], _ = json.Marshal([]map[string]json.RawMessage{record})
+		applied = append(applied, "stepCount total")
+	}
+
+	// Values written as plain numbers, with units in an optional sibling field
+	for _, name := range workoutValueFields {
+		value, ok := fields[name]
+		if !ok || !isJSONNumber(value) {
+			continue
+		}
+		object := map[string]json.RawMessage{"qty": value}
+		if units, ok := fields[name+"Units"]; ok {
+			object["units"] = units
+			delete(fields, name+"Units")
+		}
+		fields[name], _ = json.Marshal(object)
+		applied = append(applied, name+" number")
+	}
+
+	return applied
+}
+
+// decodeMetrics decodes the metrics array, taking a record's quantity from
+// its average or sleep total when it has no qty.
+func decodeMetrics(raw json.RawMessage, data *Data, report *schemaReport) error {
+	var metrics []map[string]json.RawMessage
+	if err := unmarshalIfPresent(raw, &metrics); err != nil {
+		return fmt.Errorf("decoding JSON: metrics: %w", err)
+	}
+
+	for _, fields := range metrics {
+		report.noteUnknown("metrics", fields, knownMetricFields)
+
+		var metric Metric
+		unmarshalIfPresent(fields["name"], &metric.Name)
+		unmarshalIfPresent(fields["units"], &metric.Units)
+		metric.Extras = extrasOf(fields, metricFieldNames)
+
+		var records []json.RawMessage
+		if err := unmarshalIfPresent(fields["data"], &records); err != nil {
+			return fmt.Errorf("decoding JSON: metric %s: %w", metric.Name, err)
+		}
+		metric.Data = make([]MetricRecord, 0, len(records))
+		for i, rawRecord := range records {
+			var record MetricRecord
+			if err := json.Unmarshal(rawRecord, &record); err != nil {
+				return fmt.Errorf("decoding JSON: metric %s record %d: %w", metric.Name, i+1, err)
+			}
+
+			// Records of a metric share their fields, so the first stands for all
+			if i == 0 {
+				var recordFields map[string]json.RawMessage
+				json.Unmarshal(rawRecord, &recordFields)
+				report.noteUnknown("metrics.data", recordFields, knownMetricRecordField)
+			}
+
+			if record.Qty == 0 {
+				if qty, field, ok := alternateQty(rawRecord); ok {
+					record.Qty = qty
+					report.Migrations["qty from "+field]++
+				}
+			}
+			metric.Data = append(metric.Data, record)
+		}
+		data.Metrics = append(data.Metrics, metric)
+	}
+	return nil
+}
+
+// alternateQty returns the quantity of a record without qty from the first
+// of metricRecordQtyFields it has.
+func alternateQty(raw json.RawMessage) (float64, string, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return 0, "", false
+	}
+	if _, ok := fields["qty"]; ok {
+		return 0, "", false
+	}
+	for _, name := range metricRecordQtyFields {
+		var qty float64
+		if value, ok := fields[name]; ok && json.Unmarshal(value, &qty) == nil {
+			return qty, name, true
+		}
+	}
+	return 0, "", false
+}
+
+// legacyWorkoutID derives a stable ID for a workout exported without one.
+func legacyWorkoutID(workout Workout) string {
+	sum := sha256.Sum256([]byte(workout.Name + "|" + workout.Start.String() + "|" + workout.End.String()))
+	return "hae-" + hex.EncodeToString(sum[:8])
+}
+
+// noteUnknown counts the fields of an object that are not in known.
+func (report *schemaReport) noteUnknown(location string, fields map[string]json.RawMessage, known map[string]bool) {
+	for key := range fields {
+		if !known[strings.ToLower(key)] {
+			report.UnknownFields[location+"."+key]++
+		}
+	}
+}
+
+// formatFieldCounts lists field counts sorted by field, for logging.
+func formatFieldCounts(counts map[string]int) string {
+	fields := make([]string, 0, len(counts))
+	for field, count := range counts {
+		fields = append(fields, fmt.Sprintf("%s (%d)", field, count))
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ", ")
+}
+
+// unmarshalIfPresent decodes raw into v unless raw is absent or null.
+func unmarshalIfPresent(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// jsonKind returns the first character of a JSON value: '{', '[', '"' and so on.
+func jsonKind(raw json.RawMessage) byte {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return 0
+	}
+	return raw[0]
+}
+
+// isJSONNumber reports whether raw is a JSON number.
+func isJSONNumber(raw json.RawMessage) bool {
+	kind := jsonKind(raw)
+	return kind == '-' || kind >= '0' && kind <= '9'
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrateHealthAutoExportJSONLegacy(t *testing.T) {
+	input := `{"data": {
+		"workouts": [{
+			"name": "Outdoor Run",
+			"start": "2025-11-10 07:00:00 -0500",
+			"end": "2025-11-10 07:30:00 -0500",
+			"duration": 1800,
+			"distance": 3.1,
+			"distanceUnits": "mi",
+			"elevationUp": 42,
+			"activeEnergy": {"qty": 310, "units": "kcal"},
+			"stepCount": {"qty": 4200, "units": "count"},
+			"heartRate": [{"date": "2025-11-10 07:05:00 -0500", "Min": 120, "Avg": 140, "Max": 150, "units": "bpm"}]
+		}],
+		"metrics": [
+			{"name": "heart_rate", "units": "count/min", "data": [{"date": "2025-11-10 08:00:00 -0500", "Min": 55, "Avg": 62, "Max": 70}]},
+			{"name": "sleep_analysis", "units": "hr", "data": [{"date": "2025-11-10 00:00:00 -0500", "totalSleep": 7.5, "deep": 1.2}]},
+			{"name": "step_count", "units": "count", "data": [{"date": "2025-11-10 08:00:00 -0500", "qty": 0}]}
+		]
+	}}`
+
+	healthData, report, err := migrateHealthAutoExportJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("migrateHealthAutoExportJSON() error = %v", err)
+	}
+
+	if report.Version != schemaV1 {
+		t.Errorf("Version = %q, want %q", report.Version, schemaV1)
+	}
+	if len(report.UnknownFields) != 0 {
+		t.Errorf("UnknownFields = %v, want none", report.UnknownFields)
+	}
+	wantMigrations := map[string]int{
+		"heartRate series":    1,
+		"activeEnergy total":  1,
+		"stepCount total":     1,
+		"distance number":     1,
+		"elevationUp number":  1,
+		"workout id":          1,
+		"qty from Avg":        1,
+		"qty from totalSleep": 1,
+	}
+	if !reflect.DeepEqual(report.Migrations, wantMigrations) {
+		t.Errorf("Migrations = %v, want %v", report.Migrations, wantMigrations)
+	}
+
+	workout := healthData.Data.Workouts[0]
+	if !strings.HasPrefix(workout.ID, "hae-") {
+		t.Errorf("workout ID = %q, want hae- prefix", workout.ID)
+	}
+	if workout.Distance != (ValueWithUnits{Qty: 3.1, Units: "mi"}) {
+		t.Errorf("Distance = %+v", workout.Distance)
+	}
+	if workout.ElevationUp != (ValueWithUnits{Qty: 42}) {
+		t.Errorf("ElevationUp = %+v", workout.ElevationUp)
+	}
+	if workout.ActiveEnergyBurned != (EnergyValue{Qty: 310, Units: "kcal"}) {
+		t.Errorf("ActiveEnergyBurned = %+v", workout.ActiveEnergyBurned)
+	}
+	if len(workout.HeartRateData) != 1 || workout.HeartRateData[0].Avg != 140 {
+		t.Errorf("HeartRateData = %+v", workout.HeartRateData)
+	}
+	if len(workout.StepCount) != 1 || workout.StepCount[0].Qty != 4200 || !workout.StepCount[0].Date.Equal(workout.Start) {
+		t.Errorf("StepCount = %+v", workout.StepCount)
+	}
+
+	wantQty := []float64{62, 7.5, 0}
+	for i, metric := range healthData.Data.Metrics {
+		if got := metric.Data[0].Qty; got != wantQty[i] {
+			t.Errorf("metric %s qty = %v, want %v", metric.Name, got, wantQty[i])
+		}
+	}
+}
+
+func TestMigrateHealthAutoExportJSONCurrent(t *testing.T) {
+	input := `{"data": {
+		"workouts": [{
+			"id": "W1",
+			"name": "Walking",
+			"start": "2025-11-10 07:00:00 -0500",
+			"end": "2025-11-10 07:30:00 -0500",
+			"distance": {"qty": 1.5, "units": "mi"},
+			"heartRate": {"avg": {"qty": 100}},
+			"heartRateData": [{"date": "2025-11-10 07:05:00 -0500", "Avg": 98}],
+			"cadence": 110
+		}],
+		"stateOfMind": [{"id": "S1", "start": "2025-11-10T12:00:00Z", "end": "2025-11-10T12:00:00Z", "valence": 0.5, "mood": "calm"}],
+		"medications": []
+	}, "exportedBy": "app"}`
+
+	healthData, report, err := migrateHealthAutoExportJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("migrateHealthAutoExportJSON() error = %v", err)
+	}
+
+	if report.Version != schemaV2 {
+		t.Errorf("Version = %q, want %q", report.Version, schemaV2)
+	}
+	if len(report.Migrations) != 0 {
+		t.Errorf("Migrations = %v, want none", report.Migrations)
+	}
+	wantUnknown := map[string]int{
+		"exportedBy":       1,
+		"data.medications": 1,
+		"workouts.cadence": 1,
+		"stateOfMind.mood": 1,
+	}
+	if !reflect.DeepEqual(report.UnknownFields, wantUnknown) {
+		t.Errorf("UnknownFields = %v, want %v", report.UnknownFields, wantUnknown)
+	}
+	if got := formatFieldCounts(report.UnknownFields); got != "data.medications (1), exportedBy (1), stateOfMind.mood (1), workouts.cadence (1)" {
+		t.Errorf("formatFieldCounts() = %q", got)
+	}
+
+	workout := healthData.Data.Workouts[0]
+	if workout.ID != "W1" || workout.Distance.Qty != 1.5 || len(workout.HeartRateData) != 1 {
+		t.Errorf("workout = %+v", workout)
+	}
+	if len(healthData.Data.StateOfMind) != 1 || healthData.Data.StateOfMind[0].Valence != 0.5 {
+		t.Errorf("StateOfMind = %+v", healthData.Data.StateOfMind)
+	}
+}
+
+func TestMigrateHealthAutoExportJSONUnknownCategories(t *testing.T) {
+	input := `{"data": {
+		"metrics": [{"name": "step_count", "units": "count", "data": [{"date": "2025-11-10 08:00:00 -0500", "qty": 100}]}],
+		"medications": [{"name": "Ibuprofen", "date": "2025-11-10 09:00:00 -0500", "dose": {"qty": 200, "units": "mg"}}]
+	}, "exportedBy": "app"}`
+
+	healthData, _, err := migrateHealthAutoExportJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("migrateHealthAutoExportJSON() error = %v", err)
+	}
+	if _, ok := healthData.Data.Extras["medications"]; !ok || len(healthData.Data.Extras) != 1 {
+		t.Errorf("Data.Extras = %s, want medications", healthData.Data.Extras)
+	}
+	if got := string(healthData.Extras["exportedBy"]); got != `"app"` || len(healthData.Extras) != 1 {
+		t.Errorf("Extras = %s, want exportedBy", healthData.Extras)
+	}
+
+	dir := t.TempDir()
+	if err := exportData(context.Background(), healthData, exportSource{}, dir); err != nil {
+		t.Fatalf("exportData() error = %v", err)
+	}
+
+	var medications []map[string]interface{}
+	if err := readJSONFile(filepath.Join(dir, otherDataDir, "data_medications.json"), &medications); err != nil {
+		t.Fatal(err)
+	}
+	if len(medications) != 1 || medications[0]["name"] != "Ibuprofen" {
+		t.Errorf("data_medications.json = %v", medications)
+	}
+	var document map[string]interface{}
+	if err := readJSONFile(filepath.Join(dir, otherDataDir, "document.json"), &document); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(document, map[string]interface{}{"exportedBy": "app"}) {
+		t.Errorf("document.json = %v", document)
+	}
+
+	manifest := &ExportManifest{}
+	if err := readJSONFile(filepath.Join(dir, manifestFileName), manifest); err != nil {
+		t.Fatal(err)
+	}
+	wantCounts := map[string]int{"data.medications": 1, "exportedBy": 1}
+	if !reflect.DeepEqual(manifest.Extras, wantCounts) {
+		t.Errorf("manifest extras = %v, want %v", manifest.Extras, wantCounts)
+	}
+	if _, ok := manifest.Files[otherDataDir+"/data_medications.json"]; !ok {
+		t.Errorf("manifest files = %v, want %s/data_medications.json", manifest.Files, otherDataDir)
+	}
+}
+
+func TestMigrateHealthAutoExportJSONInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"not JSON", `{"data":`, "decoding JSON"},
+		{"workouts not an array", `{"data": {"workouts": {}}}`, "decoding JSON: workouts"},
+		{"invalid workout date", `{"data": {"workouts": [{"start": "yesterday"}]}}`, "workout 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := migrateHealthAutoExportJSON(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("migrateHealthAutoExportJSON() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveSources []string
+	serveListen  string
+)
+
+// Limits for paginated API responses.
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// serveCmd runs the HTTP/JSON query API
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve health data over a local HTTP/JSON API",
+	Long: `Load one or more exports and serve them over a read-only HTTP/JSON API.
+
+Each --source is either a health export JSON file or an export directory
+written by the process command. Overlapping exports are merged, with
+duplicate workouts, state of mind entries and metric records dropped.
+
+Endpoints:
+  GET /workouts?type=&since=&until=     Workouts in start order
+  GET /workouts/{id}?series=true        Workout summary with detail series
+  GET /metrics                          Available metrics
+  GET /metrics/{name}?from=&to=&bucket= Metric series (bucket: none, hour, day, week, month)
+  GET /state-of-mind?from=&to=&kind=    State of mind timeline
+  GET /manifest                         Loaded exports, their manifests and an overview
+
+List endpoints accept limit and offset and return total and next for paging.
+Responses carry an ETag and honor If-None-Match.`,
+	Example: `  # Serve a source file and a processed export on the default address
+  apple-health-export-parser serve --source health-export.json --source exports/2025-11-10
+
+  # Query it
+  curl 'http://127.0.0.1:8080/workouts?type=Outdoor%20Walk&since=2025-11-01'
+  curl 'http://127.0.0.1:8080/metrics/heart_rate?bucket=day'`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringSliceVarP(&serveSources, "source", "s", nil, "export JSON file or export directory to serve (repeatable, required)")
+	serveCmd.Flags().StringVar(&serveListen, "listen", "127.0.0.1:8080", "address to listen on")
+	serveCmd.MarkFlagRequired("source")
+}
+
+// runServe executes the serve command
+func runServe(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	exports, data, err := loadExports(serveSources)
+	if err != nil {
+		return err
+	}
+	api := newAPIServer(exports, newHealthIndex(data))
+
+	server := &http.Server{
+		Addr:              serveListen,
+		Handler:           api,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return runHTTPServer(ctx, server)
+}
+
+// runHTTPServer serves until ctx is cancelled, then shuts down gracefully.
+func runHTTPServer(ctx context.Context, server *http.Server) error {
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("Listening", "addr", server.Addr)
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("serving HTTP: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down HTTP server: %w", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving HTTP: %w", err)
+	}
+	return nil
+}
+
+// apiServer serves the HTTP/JSON query API over an index.
+type apiServer struct {
+	exports []*LoadedExport
+	idx     *healthIndex
+	mux     *http.ServeMux
+}
+
+// newAPIServer creates the API handler for the loaded exports.
+func newAPIServer(exports []*LoadedExport, idx *healthIndex) *apiServer {
+	api := &apiServer{exports: exports, idx: idx, mux: http.NewServeMux()}
+	api.mux.HandleFunc("GET /workouts", api.handleWorkouts)
+	api.mux.HandleFunc("GET /workouts/{id}", api.handleWorkout)
+	api.mux.HandleFunc("GET /metrics", api.handleMetrics)
+	api.mux.HandleFunc("GET /metrics/{name}", api.handleMetricSeries)
+	api.mux.HandleFunc("GET /state-of-mind", api.handleStateOfMind)
+	api.mux.HandleFunc("GET /manifest", api.handleManifest)
+	return api
+}
+
+// ServeHTTP implements http.Handler, logging each request.
+func (api *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	api.mux.ServeHTTP(rec, r)
+	slog.Debug("Handled request", "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", time.Since(start))
+}
+
+// statusRecorder captures the response status for logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status before writing it.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// PageInfo describes one page of a paginated list.
+type PageInfo struct {
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Next   string `json:"next,omitempty"` // URL of the next page, if any
+}
+
+// ListResponse is a page of list items.
+type ListResponse struct {
+	PageInfo
+	Items interface{} `json:"items"`
+}
+
+// SeriesResponse is a page of metric series points.
+type SeriesResponse struct {
+	Name   string `json:"name"`
+	Units  string `json:"units"`
+	Bucket string `json:"bucket"`
+	PageInfo
+	Points []SeriesPoint `json:"points"`
+}
+
+// ManifestResponse describes the loaded exports.
+type ManifestResponse struct {
+	Exports  []*LoadedExport `json:"exports"`
+	Overview HealthOverview  `json:"overview"`
+}
+
+// handleWorkouts serves GET /workouts.
+func (api *apiServer) handleWorkouts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	rng, err := parseTimeRange(query.Get("since"), query.Get("until"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	matches := api.idx.listWorkouts(workoutFilter{Type: query.Get("type"), Range: rng})
+	start, end := pageBounds(len(matches), limit, offset)
+	items := make([]WorkoutListItem, 0, end-start)
+	for _, summary := range matches[start:end] {
+		items = append(items, newWorkoutListItem(summary))
+	}
+
+	writeJSON(w, r, ListResponse{PageInfo: newPageInfo(r, len(matches), limit, offset), Items: items})
+}
+
+// handleWorkout serves GET /workouts/{id}.
+func (api *apiServer) handleWorkout(w http.ResponseWriter, r *http.Request) {
+	series := true
+	if value := r.URL.Query().Get("series"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid series value: %s", value))
+			return
+		}
+		series = parsed
+	}
+
+	id := r.PathValue("id")
+	detail, ok := api.idx.workoutDetail(id, series)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("workout not found: %s", id))
+		return
+	}
+	writeJSON(w, r, detail)
+}
+
+// handleMetrics serves GET /metrics.
+func (api *apiServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, api.idx.overview().Metrics)
+}
+
+// handleMetricSeries serves GET /metrics/{name}.
+func (api *apiServer) handleMetricSeries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	rng, err := parseTimeRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	name := r.PathValue("name")
+	if _, ok := api.idx.metric(name); !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown metric: %s", name))
+		return
+	}
+	series, err := api.idx.metricSeries(name, rng, query.Get("bucket"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	start, end := pageBounds(len(series.Points), limit, offset)
+	writeJSON(w, r, SeriesResponse{
+		Name:     series.Name,
+		Units:    series.Units,
+		Bucket:   series.Bucket,
+		PageInfo: newPageInfo(r, len(series.Points), limit, offset),
+		Points:   series.Points[start:end],
+	})
+}
+
+// handleStateOfMind serves GET /state-of-mind.
+func (api *apiServer) handleStateOfMind(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	rng, err := parseTimeRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	entries := api.idx.moodTimeline(rng, query.Get("kind"))
+	start, end := pageBounds(len(entries), limit, offset)
+	writeJSON(w, r, ListResponse{PageInfo: newPageInfo(r, len(entries), limit, offset), Items: entries[start:end]})
+}
+
+// handleManifest serves GET /manifest.
+func (api *apiServer) handleManifest(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, ManifestResponse{Exports: api.exports, Overview: api.idx.overview()})
+}
+
+// parsePage reads the limit and offset query parameters.
+func parsePage(r *http.Request) (limit, offset int, err error) {
+	limit = defaultPageLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("invalid limit: %s", value)
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", value)
+		}
+	}
+	return limit, offset, nil
+}
+
+// pageBounds returns the slice bounds of a page within total items.
+func pageBounds(total, limit, offset int) (start, end int) {
+	start = min(offset, total)
+	end = min(start+limit, total)
+	return start, end
+}
+
+// newPageInfo describes a page, linking to the next page of the same request.
+func newPageInfo(r *http.Request, total, limit, offset int) PageInfo {
+	page := PageInfo{Total: total, Limit: limit, Offset: offset}
+	if offset+limit < total {
+		next := *r.URL
+		query := next.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset+limit))
+		next.RawQuery = query.Encode()
+		page.Next = next.RequestURI()
+	}
+	return page
+}
+
+// writeJSON writes v as JSON with an ETag derived from the body, answering
+// 304 Not Modified when the client already has the current representation.
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false) // Keep next links readable
+	if err := encoder.Encode(v); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("encoding response: %w", err))
+		return
+	}
+	body := buf.Bytes()
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// etagMatches reports whether an If-None-Match header matches etag,
+// using the weak comparison required for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		slog.Error("Request failed", "status", status, "error", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
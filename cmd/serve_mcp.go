@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/spf13/cobra"
+)
+
+// mcpSourceFile is the export file served by serve-mcp.
+var mcpSourceFile string
+
+// Limits for list_workouts pages.
+const (
+	defaultWorkoutLimit = 50
+	maxWorkoutLimit     = 500
+)
+
+// Resource URIs served by the MCP server.
+const (
+	summaryResourceURI    = "health://summary"
+	workoutResourceURI    = "health://workouts/{id}"
+	metricResourceURI     = "health://metrics/{name}"
+	workoutResourcePrefix = "health://workouts/"
+	metricResourcePrefix  = "health://metrics/"
+	markdownMIMEType      = "text/markdown"
+	jsonMIMEType          = "application/json"
+)
+
+// serveMCPCmd runs an MCP server over stdio
+var serveMCPCmd = &cobra.Command{
+	Use:   "serve-mcp",
+	Short: "Serve health data to AI assistants as an MCP server over stdio",
+	Long: `Run an MCP (Model Context Protocol) server over stdin/stdout that answers
+queries about a health export, so assistants query the data instead of
+loading exported files.
+
+Tools:
+  list_workouts   List workouts, filtered by type and date range
+  get_workout     Get a workout summary, optionally with its time series
+  metric_series   Get a metric's values, aggregated by hour, day, week or month
+  mood_timeline   List state of mind entries in a date range
+
+Resources:
+  health://summary         Overview of the export (date range, workouts, metrics, moods)
+  health://workouts/{id}   Markdown summary of a workout
+  health://metrics/{name}  Markdown summary of a metric
+
+Logs are written to stderr (or --log-output) so they never mix with the protocol.`,
+	Example: `  # Serve an export
+  apple-health-export-parser serve-mcp --source health-export.json
+
+  # Register with an MCP client (e.g. in its server configuration)
+  {"command": "apple-health-export-parser", "args": ["serve-mcp", "--source", "/path/to/health-export.json"]}`,
+	Args: cobra.NoArgs,
+	RunE: runServeMCP,
+}
+
+func init() {
+	rootCmd.AddCommand(serveMCPCmd)
+
+	serveMCPCmd.Flags().StringVarP(&mcpSourceFile, "source", "s", "", "source JSON file to serve (required)")
+	serveMCPCmd.MarkFlagRequired("source")
+}
+
+// runServeMCP executes the serve-mcp command
+func runServeMCP(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Standard input carries the MCP protocol, so it cannot carry the export
+	if mcpSourceFile == stdinSource {
+		return fmt.Errorf("serve-mcp cannot read the export from stdin, which carries the MCP protocol")
+	}
+
+	healthData, err := loadHealthData(mcpSourceFile, formatAuto)
+	if err != nil {
+		return err
+	}
+	idx := newHealthIndex(healthData.Data)
+
+	slog.Info("Starting MCP server",
+		"source", mcpSourceFile,
+		"workouts", len(idx.workouts),
+		"metrics", len(idx.metrics),
+		"state_of_mind", len(idx.moods),
+	)
+
+	if err := newMCPServer(idx).Run(ctx, &mcp.StdioTransport{}); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("running MCP server: %w", err)
+	}
+	slog.Info("MCP server stopped")
+	return nil
+}
+
+// newMCPServer creates an MCP server exposing idx as tools and resources.
+func newMCPServer(idx *healthIndex) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{
+		Name:    "apple-health-export-parser",
+		Version: GetVersion().Version,
+	}, nil)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "list_workouts",
+		Description: "List workouts in start order with duration, distance, energy and heart rate. Filter by workout type (e.g. \"Outdoor Walk\") and start date range.",
+	}, idx.handleListWorkouts)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_workout",
+		Description: "Get a workout's full summary and statistics by ID. Set series to include heart rate, energy, step and distance time series.",
+	}, idx.handleGetWorkout)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "metric_series",
+		Description: "Get a health metric's values in a date range, aggregated per bucket (count, min, max, avg, sum). Metric names are listed in the health://summary resource.",
+	}, idx.handleMetricSeries)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "mood_timeline",
+		Description: "List state of mind entries (valence, classification, labels, associations) in start order within a date range.",
+	}, idx.handleMoodTimeline)
+
+	server.AddResource(&mcp.Resource{
+		URI:         summaryResourceURI,
+		Name:        "summary",
+		Description: "Overview of the export: date range, workout types, available metrics and mood classifications",
+		MIMEType:    jsonMIMEType,
+	}, idx.readSummaryResource)
+
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: workoutResourceURI,
+		Name:        "workout",
+		Description: "Markdown summary of a workout",
+		MIMEType:    markdownMIMEType,
+	}, idx.readWorkoutResource)
+
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: metricResourceURI,
+		Name:        "metric",
+		Description: "Markdown summary of a metric",
+		MIMEType:    markdownMIMEType,
+	}, idx.readMetricResource)
+
+	return server
+}
+
+// ListWorkoutsInput holds the list_workouts arguments.
+type ListWorkoutsInput struct {
+	Type   string `json:"type,omitempty" jsonschema:"workout type, case-insensitive (e.g. Outdoor Walk)"`
+	Since  string `json:"since,omitempty" jsonschema:"earliest start, as a date (2025-11-01) or RFC3339 timestamp"`
+	Until  string `json:"until,omitempty" jsonschema:"latest start; a date includes the whole day"`
+	Limit  int    `json:"limit,omitempty" jsonschema:"maximum workouts to return (default 50, max 500)"`
+	Offset int    `json:"offset,omitempty" jsonschema:"number of matching workouts to skip"`
+}
+
+// ListWorkoutsOutput is the list_workouts result.
+type ListWorkoutsOutput struct {
+	Total    int               `json:"total"` // Matching workouts before paging
+	Workouts []WorkoutListItem `json:"workouts"`
+}
+
+// handleListWorkouts implements the list_workouts tool.
+func (idx *healthIndex) handleListWorkouts(ctx context.Context, req *mcp.CallToolRequest, in ListWorkoutsInput) (*mcp.CallToolResult, ListWorkoutsOutput, error) {
+	r, err := parseTimeRange(in.Since, in.Until)
+	if err != nil {
+		return nil, ListWorkoutsOutput{}, err
+	}
+
+	limit := in.Limit
+	if limit <= 0 {
+		limit = defaultWorkoutLimit
+	}
+	if limit > maxWorkoutLimit {
+		limit = maxWorkoutLimit
+	}
+
+	matches := idx.listWorkouts(workoutFilter{Type: in.Type, Range: r})
+	out := ListWorkoutsOutput{Total: len(matches), Workouts: []WorkoutListItem{}}
+	for i := max(in.Offset, 0); i < len(matches) && len(out.Workouts) < limit; i++ {
+		out.Workouts = append(out.Workouts, newWorkoutListItem(matches[i]))
+	}
+	return nil, out, nil
+}
+
+// GetWorkoutInput holds the get_workout arguments.
+type GetWorkoutInput struct {
+	ID     string `json:"id" jsonschema:"workout ID, as returned by list_workouts"`
+	Series bool   `json:"series,omitempty" jsonschema:"include heart rate, energy, step and distance time series"`
+}
+
+// handleGetWorkout implements the get_workout tool.
+func (idx *healthIndex) handleGetWorkout(ctx context.Context, req *mcp.CallToolRequest, in GetWorkoutInput) (*mcp.CallToolResult, WorkoutDetail, error) {
+	detail, ok := idx.workoutDetail(in.ID, in.Series)
+	if !ok {
+		return nil, WorkoutDetail{}, fmt.Errorf("workout not found: %s", in.ID)
+	}
+	return nil, *detail, nil
+}
+
+// MetricSeriesInput holds the metric_series arguments.
+type MetricSeriesInput struct {
+	Name   string `json:"name" jsonschema:"metric name (e.g. heart_rate, step_count)"`
+	From   string `json:"from,omitempty" jsonschema:"start of the range, as a date (2025-11-01) or RFC3339 timestamp"`
+	To     string `json:"to,omitempty" jsonschema:"end of the range; a date includes the whole day"`
+	Bucket string `json:"bucket,omitempty" jsonschema:"aggregation bucket: none, hour, day (default), week or month"`
+}
+
+// handleMetricSeries implements the metric_series tool.
+func (idx *healthIndex) handleMetricSeries(ctx context.Context, req *mcp.CallToolRequest, in MetricSeriesInput) (*mcp.CallToolResult, MetricSeries, error) {
+	r, err := parseTimeRange(in.From, in.To)
+	if err != nil {
+		return nil, MetricSeries{}, err
+	}
+
+	bucket := in.Bucket
+	if bucket == "" {
+		bucket = bucketDay
+	}
+	series, err := idx.metricSeries(in.Name, r, bucket)
+	if err != nil {
+		return nil, MetricSeries{}, err
+	}
+	return nil, *series, nil
+}
+
+// MoodTimelineInput holds the mood_timeline arguments.
+type MoodTimelineInput struct {
+	From string `json:"from,omitempty" jsonschema:"start of the range, as a date (2025-11-01) or RFC3339 timestamp"`
+	To   string `json:"to,omitempty" jsonschema:"end of the range; a date includes the whole day"`
+	Kind string `json:"kind,omitempty" jsonschema:"entry kind: daily_mood or momentary_emotion (default: both)"`
+}
+
+// MoodTimelineOutput is the mood_timeline result.
+type MoodTimelineOutput struct {
+	Entries []MoodEntry `json:"entries"`
+}
+
+// handleMoodTimeline implements the mood_timeline tool.
+func (idx *healthIndex) handleMoodTimeline(ctx context.Context, req *mcp.CallToolRequest, in MoodTimelineInput) (*mcp.CallToolResult, MoodTimelineOutput, error) {
+	r, err := parseTimeRange(in.From, in.To)
+	if err != nil {
+		return nil, MoodTimelineOutput{}, err
+	}
+	return nil, MoodTimelineOutput{Entries: idx.moodTimeline(r, in.Kind)}, nil
+}
+
+// readSummaryResource serves the export overview as JSON.
+func (idx *healthIndex) readSummaryResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	data, err := json.MarshalIndent(idx.overview(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding summary: %w", err)
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{{URI: req.Params.URI, MIMEType: jsonMIMEType, Text: string(data)}},
+	}, nil
+}
+
+// readWorkoutResource serves a workout's markdown summary.
+func (idx *healthIndex) readWorkoutResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	id, err := url.PathUnescape(strings.TrimPrefix(req.Params.URI, workoutResourcePrefix))
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	_, summary, ok := idx.workout(id)
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	return markdownResource(req.Params.URI, summary.MemoryContent.Markdown), nil
+}
+
+// readMetricResource serves a metric's markdown summary.
+func (idx *healthIndex) readMetricResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	name, err := url.PathUnescape(strings.TrimPrefix(req.Params.URI, metricResourcePrefix))
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	summary, ok := idx.metricSummary(name)
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	return markdownResource(req.Params.URI, summary.MemoryContent.Markdown), nil
+}
+
+// markdownResource wraps markdown text as a resource result.
+func markdownResource(uri, text string) *mcp.ReadResourceResult {
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{{URI: uri, MIMEType: markdownMIMEType, Text: text}},
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// connectTestMCPServer starts an MCP server over test data and returns a
+// connected client session.
+func connectTestMCPServer(t *testing.T) *mcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	serverSession, err := newMCPServer(newHealthIndex(testHealthData())).Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("connecting server: %v", err)
+	}
+	t.Cleanup(func() { serverSession.Close() })
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "v0.0.0"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("connecting client: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+func TestMCPServerTools(t *testing.T) {
+	session := connectTestMCPServer(t)
+
+	tests := []struct {
+		name      string
+		tool      string
+		args      map[string]interface{}
+		wantError bool
+		want      []string // Substrings of the JSON result
+	}{
+		{
+			name: "list workouts by type",
+			tool: "list_workouts",
+			args: map[string]interface{}{"type": "Outdoor Walk", "limit": 1},
+			want: []string{`"total":2`, `"id":"W1"`, `"avgHeartRate":100`},
+		},
+		{
+			name: "get workout with series",
+			tool: "get_workout",
+			args: map[string]interface{}{"id": "W1", "series": true},
+			want: []string{`"name":"Outdoor Walk"`, `"heartRate":[`},
+		},
+		{
+			name:      "get unknown workout",
+			tool:      "get_workout",
+			args:      map[string]interface{}{"id": "nope"},
+			wantError: true,
+			want:      []string{"workout not found: nope"},
+		},
+		{
+			name: "metric series defaults to daily buckets",
+			tool: "metric_series",
+			args: map[string]interface{}{"name": "step_count", "to": "2025-11-11"},
+			want: []string{`"bucket":"day"`, `"count":2`, `"sum":4000`},
+		},
+		{
+			name:      "metric series with invalid range",
+			tool:      "metric_series",
+			args:      map[string]interface{}{"name": "step_count", "from": "yesterday"},
+			wantError: true,
+			want:      []string{"invalid from time"},
+		},
+		{
+			name: "mood timeline",
+			tool: "mood_timeline",
+			args: map[string]interface{}{"kind": "momentary_emotion"},
+			want: []string{`"id":"S2"`, `"labels":["stressed"]`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: tt.tool, Arguments: tt.args})
+			if err != nil {
+				t.Fatalf("CallTool() error = %v", err)
+			}
+			if result.IsError != tt.wantError {
+				t.Errorf("IsError = %v, want %v", result.IsError, tt.wantError)
+			}
+
+			text := result.Content[0].(*mcp.TextContent).Text
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("result missing %q:\n%s", want, text)
+				}
+			}
+		})
+	}
+}
+
+func TestMCPServerResources(t *testing.T) {
+	session := connectTestMCPServer(t)
+	ctx := context.Background()
+
+	result, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: summaryResourceURI})
+	if err != nil {
+		t.Fatalf("ReadResource(summary) error = %v", err)
+	}
+	var overview HealthOverview
+	if err := json.Unmarshal([]byte(result.Contents[0].Text), &overview); err != nil {
+		t.Fatalf("decoding summary: %v", err)
+	}
+	if overview.Workouts.Total != 3 {
+		t.Errorf("summary workouts = %d, want 3", overview.Workouts.Total)
+	}
+
+	result, err = session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "health://workouts/W1"})
+	if err != nil {
+		t.Fatalf("ReadResource(workout) error = %v", err)
+	}
+	if text := result.Contents[0].Text; !strings.HasPrefix(text, "# Outdoor Walk") {
+		t.Errorf("workout resource = %q, want markdown heading", text)
+	}
+
+	for _, uri := range []string{"health://metrics/step_count", "health://metrics/Step%20Count"} {
+		if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri}); err != nil {
+			t.Errorf("ReadResource(%s) error = %v", uri, err)
+		}
+	}
+	if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "health://workouts/missing"}); err == nil {
+		t.Error("ReadResource(missing workout) expected error")
+	}
+}
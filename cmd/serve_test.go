@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIServer(t *testing.T) {
+	api := newAPIServer([]*LoadedExport{{Path: "test.json", Kind: exportKindSource}}, newHealthIndex(testHealthData()))
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       []string // Substrings of the response body
+	}{
+		{
+			name:       "workouts first page",
+			path:       "/workouts?limit=2",
+			wantStatus: http.StatusOK,
+			want:       []string{`"total":3`, `"next":"/workouts?limit=2&offset=2"`, `"id":"W1"`, `"id":"W2"`},
+		},
+		{
+			name:       "workouts last page",
+			path:       "/workouts?limit=2&offset=2",
+			wantStatus: http.StatusOK,
+			want:       []string{`"offset":2`, `"items":[{"id":"W3"`},
+		},
+		{
+			name:       "workouts by type and since",
+			path:       "/workouts?type=outdoor+walk&since=2025-11-15",
+			wantStatus: http.StatusOK,
+			want:       []string{`"total":1`, `"id":"W2"`},
+		},
+		{
+			name:       "workouts beyond the end",
+			path:       "/workouts?offset=10",
+			wantStatus: http.StatusOK,
+			want:       []string{`"total":3`, `"items":[]`},
+		},
+		{
+			name:       "invalid limit",
+			path:       "/workouts?limit=0",
+			wantStatus: http.StatusBadRequest,
+			want:       []string{`"error":"invalid limit: 0"`},
+		},
+		{
+			name:       "workout with series",
+			path:       "/workouts/W1",
+			wantStatus: http.StatusOK,
+			want:       []string{`"summary":{`, `"heartRate":[`},
+		},
+		{
+			name:       "workout without series",
+			path:       "/workouts/W1?series=false",
+			wantStatus: http.StatusOK,
+			want:       []string{`"summary":{`},
+		},
+		{
+			name:       "unknown workout",
+			path:       "/workouts/nope",
+			wantStatus: http.StatusNotFound,
+			want:       []string{"workout not found"},
+		},
+		{
+			name:       "metric list",
+			path:       "/metrics",
+			wantStatus: http.StatusOK,
+			want:       []string{`"name":"heart_rate"`, `"name":"step_count"`},
+		},
+		{
+			name:       "metric series by day",
+			path:       "/metrics/step_count?bucket=day",
+			wantStatus: http.StatusOK,
+			want:       []string{`"bucket":"day"`, `"total":3`, `"sum":4000`},
+		},
+		{
+			name:       "unknown metric",
+			path:       "/metrics/vo2_max",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid bucket",
+			path:       "/metrics/step_count?bucket=year",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "state of mind",
+			path:       "/state-of-mind?kind=daily_mood",
+			wantStatus: http.StatusOK,
+			want:       []string{`"total":1`, `"id":"S1"`},
+		},
+		{
+			name:       "manifest",
+			path:       "/manifest",
+			wantStatus: http.StatusOK,
+			want:       []string{`"path":"test.json"`, `"overview":{`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if rec.Code == http.StatusOK && !json.Valid(rec.Body.Bytes()) {
+				t.Errorf("body is not valid JSON: %s", rec.Body.String())
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("body missing %q:\n%s", want, rec.Body.String())
+				}
+			}
+		})
+	}
+
+	t.Run("post rejected", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/workouts", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func TestAPIServerETag(t *testing.T) {
+	api := newAPIServer(nil, newHealthIndex(testHealthData()))
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/workouts/W1", nil))
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("response has no ETag")
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "matching etag", path: "/workouts/W1", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "weak and listed etag", path: "/workouts/W1", ifNoneMatch: `"other", W/` + etag, wantStatus: http.StatusNotModified},
+		{name: "stale etag", path: "/workouts/W1", ifNoneMatch: `"stale"`, wantStatus: http.StatusOK},
+		{name: "different representation", path: "/workouts/W1?series=false", ifNoneMatch: etag, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("304 response has a body: %s", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// stdinSource is the source name that reads the export from standard input.
+const stdinSource = "-"
+
+// Leading bytes of the compressed formats accepted as sources.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// sourceExtensions are the file extensions of uncompressed sources.
+var sourceExtensions = []string{".json", ".xml", ".csv"}
+
+// compressedExtensions are the file extensions of compressed sources.
+var compressedExtensions = []string{".gz", ".zst", ".zip"}
+
+// loadHealthData reads and decodes a health export, or standard input when
+// source is "-". Gzip, zstd and zip compressed sources are recognised by their
+// content. The format of the decompressed input is format or, when format is
+// "auto", detected by the registered parsers.
+func loadHealthData(source, format string) (HealthData, error) {
+	return readHealthData(source, format, nil)
+}
+
+// loadHealthDataDigest is loadHealthData that also returns the SHA-256 of the
+// source as read, in hex.
+func loadHealthDataDigest(source, format string) (HealthData, string, error) {
+	hash := sha256.New()
+	healthData, err := readHealthData(source, format, hash)
+	if err != nil {
+		return HealthData{}, "", err
+	}
+	return healthData, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readHealthData implements loadHealthData, writing the source to hash, if
+// not nil, as it is decoded. Zip archives need random access and are hashed
+// in a pass of their own, through the same open file.
+func readHealthData(source, format string, hash io.Writer) (HealthData, error) {
+	var r io.Reader = os.Stdin
+	if source != stdinSource {
+		file, err := os.Open(source)
+		if err != nil {
+			return HealthData{}, fmt.Errorf("opening source file: %w", err)
+		}
+		defer file.Close()
+
+		// Zip archives are read in place rather than buffered in memory
+		magic := make([]byte, len(zipMagic))
+		n, _ := io.ReadFull(file, magic)
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return HealthData{}, fmt.Errorf("reading source file: %w", err)
+		}
+		if bytes.Equal(magic[:n], zipMagic) {
+			info, err := file.Stat()
+			if err != nil {
+				return HealthData{}, fmt.Errorf("reading source file: %w", err)
+			}
+			if hash != nil {
+				if _, err := io.Copy(hash, io.NewSectionReader(file, 0, info.Size())); err != nil {
+					return HealthData{}, fmt.Errorf("hashing source file: %w", err)
+				}
+			}
+			return decodeZip(file, info.Size(), format)
+		}
+		r = file
+	}
+	if hash == nil {
+		return decodeHealthData(r, format)
+	}
+
+	r = io.TeeReader(r, hash)
+	healthData, err := decodeHealthData(r, format)
+	if err != nil {
+		return HealthData{}, err
+	}
+	// Parsers may stop before the end of the input; hash the rest too
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return HealthData{}, fmt.Errorf("reading source: %w", err)
+	}
+	return healthData, nil
+}
+
+// decodeHealthData decompresses r if it starts with a gzip, zstd or zip
+// header and decodes it with the parser for format.
+func decodeHealthData(r io.Reader, format string) (HealthData, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	magic, _ := br.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return HealthData{}, fmt.Errorf("opening gzip stream: %w", err)
+		}
+		defer gz.Close()
+		return decodeHealthData(gz, format)
+
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return HealthData{}, fmt.Errorf("opening zstd stream: %w", err)
+		}
+		defer zr.Close()
+		return decodeHealthData(zr, format)
+
+	case bytes.HasPrefix(magic, zipMagic):
+		// Zip needs random access, so a streamed archive is read into memory
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return HealthData{}, fmt.Errorf("reading zip archive: %w", err)
+		}
+		return decodeZip(bytes.NewReader(data), int64(len(data)), format)
+	}
+
+	head, _ := br.Peek(sniffSize)
+	parser, err := selectParser(format, head)
+	if err != nil {
+		return HealthData{}, err
+	}
+	slog.Debug("Decoding input", "format", parser.Name())
+	return parser.Parse(br)
+}
+
+// decodeZip decodes a zip archive. An archive in a format read as a whole,
+// such as the Health app's export.zip, goes to its parser; otherwise every
+// entry in a supported format is decoded and the entries are merged.
+// Directories, hidden files, macOS resource forks and entries in other formats
+// are skipped.
+func decodeZip(r io.ReaderAt, size int64, format string) (HealthData, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return HealthData{}, fmt.Errorf("opening zip archive: %w", err)
+	}
+
+	if parser, ok := selectArchiveParser(format, zr); ok {
+		slog.Debug("Decoding zip archive", "format", parser.Name())
+		return parser.ParseArchive(zr)
+	}
+
+	var entries []*LoadedExport
+	var extras Extras
+	for _, entry := range zr.File {
+		name := entry.Name
+		if entry.FileInfo().IsDir() ||
+			strings.HasPrefix(name, "__MACOSX/") ||
+			strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+
+		healthData, ok, err := decodeZipEntry(entry, format)
+		if err != nil {
+			return HealthData{}, fmt.Errorf("zip entry '%s': %w", name, err)
+		}
+		if !ok {
+			slog.Debug("Skipping zip entry in an unsupported format", "entry", name)
+			continue
+		}
+		slog.Debug("Decoded zip entry", "entry", name, "workouts", len(healthData.Data.Workouts), "metrics", len(healthData.Data.Metrics))
+		entries = append(entries, &LoadedExport{Path: name, Kind: exportKindSource, Data: healthData.Data})
+		extras = mergeExtras(extras, healthData.Extras)
+	}
+
+	if len(entries) == 0 {
+		return HealthData{}, fmt.Errorf("zip archive contains no entries in a supported format; supported formats: %s", supportedFormats())
+	}
+	return HealthData{Data: mergeData(entries), Extras: extras}, nil
+}
+
+// decodeZipEntry decodes a single zip entry if it is in format or, when
+// format is "auto", in any supported format. ok is false for other entries.
+func decodeZipEntry(entry *zip.File, format string) (healthData HealthData, ok bool, err error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return HealthData{}, false, err
+	}
+	defer rc.Close()
+
+	br := bufio.NewReaderSize(rc, sniffSize)
+	head, _ := br.Peek(sniffSize)
+	parser, err := selectParser(format, head)
+	if err != nil || !parser.Sniff(head) {
+		return HealthData{}, false, nil
+	}
+	healthData, err = parser.Parse(br)
+	return healthData, err == nil, err
+}
+
+// isSourceFile reports whether name has the extension of a readable source:
+// .json, .xml or .csv, optionally compressed, or .zip.
+func isSourceFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return containsString(sourceExtensions, ext) || containsString(compressedExtensions, ext)
+}
+
+// sourceBaseName returns the file name of source without its format and
+// compression extensions, so "export.json.gz" becomes "export".
+func sourceBaseName(source string) string {
+	name := filepath.Base(source)
+	ext := filepath.Ext(name)
+	if containsString(compressedExtensions, strings.ToLower(ext)) {
+		name = strings.TrimSuffix(name, ext)
+		ext = filepath.Ext(name)
+	}
+	if containsString(sourceExtensions, strings.ToLower(ext)) {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
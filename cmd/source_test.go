@@ -0,0 +1,168 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestLoadHealthDataCompressed(t *testing.T) {
+	data := testHealthData()
+	plain, err := json.Marshal(HealthData{Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A second zip entry overlapping the first: W1 again plus one mood
+	second, err := json.Marshal(HealthData{Data: Data{Workouts: data.Workouts[:1], StateOfMind: data.StateOfMind[:1]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(plain)
+	gw.Close()
+
+	var zst bytes.Buffer
+	zw, err := zstd.NewWriter(&zst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write(plain)
+	zw.Close()
+
+	archive := func(entries map[string][]byte) []byte {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		for name, content := range entries {
+			f, err := w.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write(content)
+		}
+		w.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name         string
+		file         string
+		content      []byte
+		wantWorkouts int
+		wantErr      bool
+	}{
+		{name: "plain json", file: "export.json", content: plain, wantWorkouts: 3},
+		{name: "gzip", file: "export.json.gz", content: gz.Bytes(), wantWorkouts: 3},
+		{name: "zstd", file: "export.json.zst", content: zst.Bytes(), wantWorkouts: 3},
+		{name: "compressed without extension", file: "export", content: gz.Bytes(), wantWorkouts: 3},
+		{
+			name: "zip with several entries",
+			file: "export.zip",
+			content: archive(map[string][]byte{
+				"HealthAutoExport/metrics.json":  plain,
+				"HealthAutoExport/workouts.json": second,
+				"__MACOSX/._metrics.json":        []byte("resource fork"),
+				"HealthAutoExport/README.txt":    []byte("not an export"),
+				"HealthAutoExport/.hidden.json":  []byte("{"),
+			}),
+			wantWorkouts: 3,
+		},
+		{name: "zip without json", file: "empty.zip", content: archive(map[string][]byte{"notes.txt": []byte("x")}), wantErr: true},
+		{name: "zip with invalid entry", file: "bad.zip", content: archive(map[string][]byte{"bad.json": []byte("{")}), wantErr: true},
+		{name: "invalid json", file: "bad.json", content: []byte("{"), wantErr: true},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(source, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			healthData, err := loadHealthData(source, formatAuto)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadHealthData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := len(healthData.Data.Workouts); got != tt.wantWorkouts {
+				t.Errorf("loaded %d workouts, want %d", got, tt.wantWorkouts)
+			}
+			if got := len(healthData.Data.StateOfMind); got != 2 {
+				t.Errorf("loaded %d state of mind entries, want 2", got)
+			}
+
+			// The digest is of the file as stored, compressed or not
+			_, digest, err := loadHealthDataDigest(source, formatAuto)
+			if err != nil {
+				t.Fatalf("loadHealthDataDigest() error = %v", err)
+			}
+			if want := contentDigest(tt.content); digest != want {
+				t.Errorf("digest = %s, want %s", digest, want)
+			}
+		})
+	}
+}
+
+func TestLoadHealthDataStdin(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	json.NewEncoder(gw).Encode(HealthData{Data: testHealthData()})
+	gw.Close()
+
+	stdin := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(stdin, gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	saved := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = saved }()
+
+	healthData, err := loadHealthData(stdinSource, formatAuto)
+	if err != nil {
+		t.Fatalf("loadHealthData(-) error = %v", err)
+	}
+	if len(healthData.Data.Workouts) != 3 {
+		t.Errorf("loaded %d workouts, want 3", len(healthData.Data.Workouts))
+	}
+}
+
+func TestSourceBaseName(t *testing.T) {
+	tests := []struct {
+		source     string
+		want       string
+		wantSource bool
+	}{
+		{"in/export.json", "export", true},
+		{"export.json.gz", "export", true},
+		{"export.JSON.zst", "export", true},
+		{"HealthAutoExport-2025-11-17.zip", "HealthAutoExport-2025-11-17", true},
+		{"notes.txt", "notes.txt", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if got := sourceBaseName(tt.source); got != tt.want {
+				t.Errorf("sourceBaseName(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+			if got := isSourceFile(tt.source); got != tt.wantSource {
+				t.Errorf("isSourceFile(%q) = %v, want %v", tt.source, got, tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stagingPrefix names the directories inside an export directory that an
+// export is written to before it is moved into place.
+const stagingPrefix = ".staging-"
+
+// manifestFileName is the export manifest, moved into place last.
+const manifestFileName = "manifest.json"
+
+// otherDataDir holds the data categories and top-level fields of a source
+// that the parser does not interpret.
+const otherDataDir = "other"
+
+// isManifestFile reports whether rel is the manifest, plain or encrypted.
+func isManifestFile(rel string) bool {
+	return rel == manifestFileName || rel == manifestFileName+ageSuffix
+}
+
+// keptOnClean are files in an export directory that are written by import.sh
+// and the import command rather than by the export, and survive --clean.
+var keptOnClean = []string{
+	"import/" + importJournalFile,
+	"import/import.log",
+	"import/import_errors.log",
+}
+
+// exportOwnedDirs are the subdirectories of an export directory that the
+// export writes. --clean removes files in them that this export did not
+// write.
+var exportOwnedDirs = []string{"metrics", "workouts", "workout_details", "state_of_mind", "ecg", "heart_rate_notifications", "symptoms", otherDataDir, "import"}
+
+// isExportOwned reports whether rel, a slash-separated path in an export
+// directory, is where the export writes: an export subdirectory, the
+// manifest, the export key, or a staging directory of an interrupted run.
+func isExportOwned(rel string) bool {
+	first, _, _ := strings.Cut(rel, "/")
+	return containsString(exportOwnedDirs, first) || strings.HasPrefix(first, stagingPrefix) ||
+		isManifestFile(rel) || rel == identityFileName
+}
+
+// exportStage is a staging directory an export is written to. Committing it
+// replaces the export directory as a whole, so a failed or interrupted
+// export leaves the previous export in place.
+type exportStage struct {
+	dir    string // Staging directory, next to target, or inside it when swap is false
+	target string // Export directory
+	swap   bool   // Whether the export directory is replaced by renaming the stage
+}
+
+// newExportStage creates a staging directory next to the export directory
+// target, on the same file system so that it can be renamed into place. When
+// target holds anything but an export, is the working directory, or its
+// parent is not writable, the stage is created inside target instead and
+// committed file by file. A previous export left aside by an interrupted
+// commit is restored first.
+func newExportStage(target string) (*exportStage, error) {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return nil, fmt.Errorf("resolving export directory: %w", err)
+	}
+	if err := recoverInterruptedCommit(target); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return nil, fmt.Errorf("creating export directory: %w", err)
+	}
+
+	if parent := filepath.Dir(target); parent != target && holdsOnlyExport(target) {
+		if dir, err := os.MkdirTemp(parent, siblingPrefix(target, stagingPrefix)+"*"); err == nil {
+			if info, err := os.Stat(target); err == nil {
+				os.Chmod(dir, info.Mode().Perm())
+			}
+			return &exportStage{dir: dir, target: target, swap: true}, nil
+		}
+	}
+	dir, err := os.MkdirTemp(target, stagingPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("creating staging directory: %w", err)
+	}
+	return &exportStage{dir: dir, target: target}, nil
+}
+
+// holdsOnlyExport reports whether everything in the export directory target
+// is where the export writes, so that the directory can be replaced as a
+// whole. Other files, such as notes or a watched directory, and a target that
+// is or contains the working directory, whose processes would be left in the
+// replaced directory, are left alone by committing file by file.
+func holdsOnlyExport(target string) bool {
+	if wd, err := os.Getwd(); err == nil {
+		if inside, err := isInside(wd, target); err != nil || inside {
+			return false
+		}
+	}
+	entries, err := os.ReadDir(target)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !isExportOwned(entry.Name()) {
+			return false
+		}
+	}
+	return true
+}
+
+// siblingPrefix names the directories next to the export directory target
+// that hold a staged export (prefix stagingPrefix) or the previous export
+// during a commit (prefix previousPrefix).
+func siblingPrefix(target, prefix string) string {
+	return "." + filepath.Base(target) + prefix
+}
+
+// previousPrefix names the directory the previous export is moved to while
+// the staged export is renamed into place.
+const previousPrefix = ".previous-"
+
+// recoverInterruptedCommit restores the previous export of target when a
+// commit was interrupted between moving it aside and renaming the stage into
+// place, and removes previous exports left behind after the rename.
+func recoverInterruptedCommit(target string) error {
+	previous, err := filepath.Glob(filepath.Join(filepath.Dir(target), siblingPrefix(target, previousPrefix)+"*"))
+	if err != nil || len(previous) == 0 {
+		return err
+	}
+	if _, err := os.Stat(target); errors.Is(err, fs.ErrNotExist) {
+		sort.Strings(previous)
+		restore := previous[len(previous)-1]
+		if err := os.Rename(restore, target); err != nil {
+			return fmt.Errorf("restoring previous export from %s: %w", restore, err)
+		}
+		slog.Warn("Restored the previous export after an interrupted export", "dir", target)
+		previous = previous[:len(previous)-1]
+	}
+	for _, dir := range previous {
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn("Failed to remove previous export", "dir", dir, "error", err)
+		}
+	}
+	return nil
+}
+
+// commit puts the staged export in place of the export directory. Files of
+// the previous export are dropped: those its manifest lists and, with clean,
+// any others in the directories the export owns. Everything else in the
+// export directory, such as the import journal and files of the user, is
+// kept.
+//
+// When the export directory holds only an export, the files to keep are
+// linked into the stage, the export directory is moved aside, and the stage
+// renamed into its place, so the export directory holds either the previous
+// or the new export as a whole. Otherwise, or when the export directory
+// cannot be renamed, such as a mount point, the staged files are moved in
+// one by one, the manifest last, which is not atomic.
+func (s *exportStage) commit(clean bool) error {
+	if !s.swap || !holdsOnlyExport(s.target) {
+		return s.commitFiles(clean)
+	}
+
+	previous := previousExportFiles(s.target)
+	err := filepath.WalkDir(s.target, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == s.target {
+			return err
+		}
+		rel, err := filepath.Rel(s.target, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		staged := filepath.Join(s.dir, filepath.FromSlash(rel))
+		if d.IsDir() {
+			if clean && isExportOwned(rel) && !containsString(keptOnCleanDirs(), rel) {
+				return filepath.SkipDir
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(staged, info.Mode().Perm())
+		}
+		if _, err := os.Lstat(staged); err == nil || !keepFile(rel, previous, clean) {
+			return nil
+		}
+		return linkFile(path, staged)
+	})
+	if err != nil {
+		return fmt.Errorf("keeping files of the export directory: %w", err)
+	}
+	if clean {
+		removeStaleStages(s.target, s.dir)
+	}
+
+	aside := filepath.Join(filepath.Dir(s.target), siblingPrefix(s.target, previousPrefix)+strings.TrimPrefix(filepath.Base(s.dir), siblingPrefix(s.target, stagingPrefix)))
+	if err := os.Rename(s.target, aside); err != nil {
+		slog.Warn("Cannot replace the export directory as a whole; moving files into place one by one", "dir", s.target, "error", err)
+		return s.commitFiles(clean)
+	}
+	if err := os.Rename(s.dir, s.target); err != nil {
+		if restoreErr := os.Rename(aside, s.target); restoreErr != nil {
+			return fmt.Errorf("moving export into place: %w (previous export left in %s: %v)", err, aside, restoreErr)
+		}
+		return fmt.Errorf("moving export into place: %w", err)
+	}
+	if err := os.RemoveAll(aside); err != nil {
+		slog.Warn("Failed to remove previous export", "dir", aside, "error", err)
+	}
+	return nil
+}
+
+// keptOnCleanDirs returns the directories holding keptOnClean files.
+func keptOnCleanDirs() []string {
+	dirs := make([]string, 0, len(keptOnClean))
+	for _, rel := range keptOnClean {
+		dirs = append(dirs, path.Dir(rel))
+	}
+	return dirs
+}
+
+// keepFile reports whether the file rel of an export directory survives an
+// export that did not write it: import journals and logs always do, files of
+// the previous export never, and other files unless clean is set and they
+// are in a directory the export owns.
+func keepFile(rel string, previous map[string]bool, clean bool) bool {
+	switch {
+	case containsString(keptOnClean, rel):
+		return true
+	case previous[rel]:
+		return false
+	default:
+		return !clean || !isExportOwned(rel)
+	}
+}
+
+// previousExportFiles returns the files written by the export in dir, as
+// listed in its manifest, with and without the .age suffix. When the
+// manifest cannot be read because it is encrypted, every file in the
+// directories the export owns is taken to be the export's.
+func previousExportFiles(dir string) map[string]bool {
+	files := make(map[string]bool)
+	manifest := &ExportManifest{}
+	if err := readJSONFile(filepath.Join(dir, manifestFileName), manifest); err != nil {
+		if _, statErr := os.Stat(filepath.Join(dir, manifestFileName+ageSuffix)); statErr != nil {
+			return files
+		}
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				if rel, err := filepath.Rel(dir, path); err == nil && isExportOwned(filepath.ToSlash(rel)) {
+					files[filepath.ToSlash(rel)] = true
+				}
+			}
+			return nil
+		})
+		return files
+	}
+
+	files[manifestFileName], files[manifestFileName+ageSuffix] = true, true
+	listed := append(append(append([]string{}, manifest.Metrics...), manifest.Workouts...), manifest.StateOfMind...)
+	for rel := range manifest.Files {
+		listed = append(listed, rel)
+	}
+	for _, rel := range listed {
+		files[rel], files[rel+ageSuffix] = true, true
+	}
+	return files
+}
+
+// linkFile makes dst a hard link to src, or a copy where the file system
+// does not support links. Symbolic links are recreated.
+func linkFile(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, dst)
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst, info.Mode().Perm())
+}
+
+// copyFile copies src to the new file dst.
+func copyFile(src, dst string, perm os.FileMode) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// removeStaleStages removes the staging directories of interrupted exports
+// to target, other than the current stage.
+func removeStaleStages(target, current string) {
+	stages, _ := filepath.Glob(filepath.Join(filepath.Dir(target), siblingPrefix(target, stagingPrefix)+"*"))
+	for _, dir := range stages {
+		if dir != current {
+			if err := os.RemoveAll(dir); err != nil {
+				slog.Warn("Failed to remove staging directory", "dir", dir, "error", err)
+			}
+		}
+	}
+}
+
+// commitFiles moves the staged files into the export directory one by one,
+// the manifest last: until it is replaced, the previous manifest stays in
+// place. Files of the previous export that this export did not write are
+// removed afterwards, as commit drops them. This is not atomic: an
+// interrupted commit leaves a mix of previous and new files.
+func (s *exportStage) commitFiles(clean bool) error {
+	previous := previousExportFiles(s.target)
+
+	var files []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("listing staged files: %w", err)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return isManifestFile(files[j]) && !isManifestFile(files[i])
+	})
+
+	written := make(map[string]bool, len(files))
+	for _, rel := range files {
+		target := filepath.Join(s.target, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("creating directory for %s: %w", rel, err)
+		}
+		if err := moveFile(filepath.Join(s.dir, filepath.FromSlash(rel)), target); err != nil {
+			return fmt.Errorf("moving %s into place: %w", rel, err)
+		}
+		written[rel] = true
+	}
+
+	if err := removeStale(s.target, s.dir, written, previous, clean); err != nil {
+		return fmt.Errorf("removing stale files: %w", err)
+	}
+	if clean {
+		removeStaleStages(s.target, s.dir)
+	}
+	return nil
+}
+
+// moveFile renames src to dst, or copies it where they are on different file
+// systems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	os.Remove(tmp)
+	if err := copyFile(src, tmp, info.Mode().Perm()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// discard removes the staging directory and anything left in it.
+func (s *exportStage) discard() {
+	if err := os.RemoveAll(s.dir); err != nil {
+		slog.Warn("Failed to remove staging directory", "dir", s.dir, "error", err)
+	}
+}
+
+// removeStale removes the files in dir that this export did not write and
+// keepFile does not keep, and then the directories left empty. The staging
+// directory skip is left alone.
+func removeStale(dir, skip string, written, previous map[string]bool, clean bool) error {
+	var stale, dirs []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == skip {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if path != dir && isExportOwned(rel) {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if !written[rel] && !keepFile(rel, previous, clean) {
+			stale = append(stale, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		slog.Debug("Removed stale file", "file", path)
+	}
+
+	// Deepest first, so parents are empty by the time they are reached
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], string(filepath.Separator)) > strings.Count(dirs[j], string(filepath.Separator))
+	})
+	for _, path := range dirs {
+		if entries, err := os.ReadDir(path); err == nil && len(entries) == 0 {
+			os.Remove(path)
+		}
+	}
+
+	if len(stale) > 0 {
+		slog.Info("Removed stale files from previous exports", "dir", dir, "count", len(stale))
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file in the target directory and
+// renames it into place, so readers never see a partially written file.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
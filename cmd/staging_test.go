@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportDataFailureKeepsPreviousExport(t *testing.T) {
+	dir := t.TempDir()
+	if err := exportData(context.Background(), HealthData{Data: testHealthData()}, exportSource{}, dir); err != nil {
+		t.Fatalf("exportData() error = %v", err)
+	}
+	before, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := exportData(ctx, HealthData{Data: testHealthData()}, exportSource{}, dir); err == nil {
+		t.Fatal("exportData() with a cancelled context succeeded")
+	}
+
+	after, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Error("failed export replaced the manifest")
+	}
+	for _, d := range []string{dir, filepath.Dir(dir)} {
+		entries, _ := os.ReadDir(d)
+		for _, entry := range entries {
+			if strings.Contains(entry.Name(), stagingPrefix) || strings.Contains(entry.Name(), previousPrefix) {
+				t.Errorf("staging directory %s left behind", entry.Name())
+			}
+		}
+	}
+	if _, _, err := loadExportDir(dir); err != nil {
+		t.Errorf("loadExportDir() after failed export error = %v", err)
+	}
+}
+
+func TestExportDataClean(t *testing.T) {
+	tests := []struct {
+		clean     bool
+		wantStale bool
+	}{
+		{clean: false, wantStale: true},
+		{clean: true, wantStale: false},
+	}
+
+	for _, tt := range tests {
+		previous := exportClean
+		exportClean = tt.clean
+		dir := t.TempDir()
+		writeTestFile(t, dir, "workouts/2020-01-01_00-00-00_Old_summary.json", "{}")
+		writeTestFile(t, dir, stagingPrefix+"123/metrics/old.json", "{}")
+		writeTestFile(t, dir, "import/"+importJournalFile, "{}\n")
+		writeTestFile(t, dir, "src.json", "{}")
+		writeTestFile(t, dir, "notes.txt", "mine")
+
+		err := exportData(context.Background(), HealthData{Data: testHealthData()}, exportSource{}, dir)
+		exportClean = previous
+		if err != nil {
+			t.Fatalf("exportData() error = %v", err)
+		}
+
+		for _, stale := range []string{"workouts/2020-01-01_00-00-00_Old_summary.json", stagingPrefix + "123"} {
+			if _, err := os.Stat(filepath.Join(dir, stale)); (err == nil) != tt.wantStale {
+				t.Errorf("clean=%v: %s exists = %v, want %v", tt.clean, stale, err == nil, tt.wantStale)
+			}
+		}
+		for _, kept := range []string{"import/" + importJournalFile, "src.json", "notes.txt"} {
+			if _, err := os.Stat(filepath.Join(dir, kept)); err != nil {
+				t.Errorf("clean=%v: %s removed", tt.clean, kept)
+			}
+		}
+		manifest, _, err := loadExportDir(dir)
+		if err != nil {
+			t.Fatalf("loadExportDir() error = %v", err)
+		}
+		for _, rel := range append(append(manifest.Metrics, manifest.Workouts...), manifest.StateOfMind...) {
+			if _, err := os.Stat(filepath.Join(dir, rel)); err != nil {
+				t.Errorf("clean=%v: manifest file %s missing", tt.clean, rel)
+			}
+		}
+	}
+}
+
+func TestExportDataRemovesPreviousExportFiles(t *testing.T) {
+	dir := t.TempDir()
+	data := testHealthData()
+	if err := exportData(context.Background(), HealthData{Data: data}, exportSource{}, dir); err != nil {
+		t.Fatalf("exportData() error = %v", err)
+	}
+	first, _, err := loadExportDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data.Workouts = data.Workouts[:1]
+	if err := exportData(context.Background(), HealthData{Data: data}, exportSource{}, dir); err != nil {
+		t.Fatalf("exportData() error = %v", err)
+	}
+	second, _, err := loadExportDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for rel := range first.Files {
+		_, written := second.Files[rel]
+		if _, err := os.Stat(filepath.Join(dir, rel)); (err == nil) != written {
+			t.Errorf("%s exists = %v, want %v", rel, err == nil, written)
+		}
+	}
+}
+
+func TestExportDataKeepsDirectoryWithOtherFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dir string) string // Returns the --export argument
+	}{
+		{
+			name: "non-export file",
+			setup: func(t *testing.T, dir string) string {
+				writeTestFile(t, dir, "notes.txt", "mine")
+				return dir
+			},
+		},
+		{
+			name: "working directory",
+			setup: func(t *testing.T, dir string) string {
+				t.Chdir(dir)
+				return "."
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "export")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			export := tt.setup(t, dir)
+			before, err := os.Stat(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Twice, so that the second run replaces an export
+			for i := 0; i < 2; i++ {
+				if err := exportData(context.Background(), HealthData{Data: testHealthData()}, exportSource{}, export); err != nil {
+					t.Fatalf("exportData() error = %v", err)
+				}
+				after, err := os.Stat(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !os.SameFile(before, after) {
+					t.Fatalf("run %d replaced the export directory", i+1)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dir, manifestFileName)); err != nil {
+				t.Errorf("manifest missing: %v", err)
+			}
+			entries, _ := os.ReadDir(filepath.Dir(dir))
+			for _, entry := range entries {
+				if entry.Name() != "export" {
+					t.Errorf("%s left next to the export directory", entry.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestExportStageCommitInPlace(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "notes.txt", "mine")
+	writeTestFile(t, dir, "metrics/old.json", "{}")
+	writeTestFile(t, dir, manifestFileName, `{"files": {"metrics/old.json": "x"}}`)
+
+	stage := &exportStage{dir: filepath.Join(dir, stagingPrefix+"1"), target: dir}
+	writeTestFile(t, stage.dir, "metrics/new.json", "{}")
+	writeTestFile(t, stage.dir, manifestFileName, "{}")
+	if err := stage.commit(false); err != nil {
+		t.Fatalf("commit() error = %v", err)
+	}
+
+	for rel, want := range map[string]bool{"notes.txt": true, "metrics/new.json": true, "metrics/old.json": false} {
+		if _, err := os.Stat(filepath.Join(dir, rel)); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", rel, err == nil, want)
+		}
+	}
+}
+
+func TestNewExportStageRecoversInterruptedCommit(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "export")
+	aside := filepath.Join(filepath.Dir(dir), siblingPrefix(dir, previousPrefix)+"1")
+	writeTestFile(t, aside, manifestFileName, "{}")
+
+	stage, err := newExportStage(dir)
+	if err != nil {
+		t.Fatalf("newExportStage() error = %v", err)
+	}
+	defer stage.discard()
+
+	if _, err := os.Stat(filepath.Join(dir, manifestFileName)); err != nil {
+		t.Errorf("previous export not restored: %v", err)
+	}
+	if _, err := os.Stat(aside); err == nil {
+		t.Error("previous export left aside")
+	}
+	if !stage.swap || filepath.Dir(stage.dir) != filepath.Dir(dir) {
+		t.Errorf("stage %s, want a sibling of %s", stage.dir, dir)
+	}
+}
@@ -8,7 +8,8 @@ import (
 // HealthData represents the root structure of an Apple Health export JSON file.
 // It contains all health data exported from the HealthyApps.dev service.
 type HealthData struct {
-	Data Data `json:"data"`
+	Data   Data   `json:"data"`
+	Extras Extras `json:"-"` // Top-level fields other than data, kept as exported
 }
 
 // Data contains the categorized health data collections.
@@ -20,6 +21,7 @@ type Data struct {
 	StateOfMind            []StateOfMind `json:"stateOfMind"`            // Mental health state recordings
 	Symptoms               []interface{} `json:"symptoms"`               // Logged symptoms
 	Workouts               []Workout     `json:"workouts"`               // Exercise and workout sessions
+	Extras                 Extras        `json:"-"`                      // Categories not listed above, kept as exported
 }
 
 // Metric represents a health metric with multiple data points over time.
@@ -28,6 +30,7 @@ type Metric struct {
 	Name  string         `json:"name"`  // Metric name (e.g., "Heart Rate", "Steps")
 	Units string         `json:"units"` // Unit of measurement (e.g., "bpm", "count")
 	Data  []MetricRecord `json:"data"`  // Time-series data points
+	Extras Extras        `json:"-"`     // Fields not listed above, kept as exported
 }
 
 // MetricRecord represents a single data point for a health metric.
@@ -35,6 +38,7 @@ type MetricRecord struct {
 	Date   time.Time `json:"date"`   // Timestamp of the measurement
 	Qty    float64   `json:"qty"`    // Quantity/value of the measurement
 	Source string    `json:"source"` // Source device or app that recorded this data
+	Extras Extras    `json:"-"`      // Fields not listed above, such as heart rate Min/Avg/Max
 }
 
 // StateOfMind represents a mental health or mood recording.
@@ -48,6 +52,7 @@ type StateOfMind struct {
 	Start                 time.Time     `json:"start"`                 // Start time of the state recording
 	Valence               float64       `json:"valence"`               // Numerical valence score
 	ValenceClassification string        `json:"valenceClassification"` // Classification (e.g., "pleasant", "unpleasant")
+	Extras                Extras        `json:"-"`                     // Fields not listed above, kept as exported
 }
 
 // Workout represents a single exercise or workout session.
@@ -72,6 +77,7 @@ type Workout struct {
 	Start                   time.Time       `json:"start"`                   // Start time
 	StepCount               []StepRecord    `json:"stepCount"`               // Step count over time during workout
 	Temperature             ValueWithUnits  `json:"temperature"`             // Temperature during workout
+	Extras                  Extras          `json:"-"`                       // Fields not listed above, kept as exported
 }
 
 // EnergyRecord represents energy expenditure at a specific time.
@@ -80,6 +86,7 @@ type EnergyRecord struct {
 	Qty    float64   `json:"qty"`    // Energy quantity
 	Source string    `json:"source"` // Source device or app
 	Units  string    `json:"units"`  // Energy units (e.g., "kcal")
+	Extras Extras    `json:"-"`      // Fields not listed above
 }
 
 // EnergyValue represents a total energy value with units.
@@ -96,6 +103,7 @@ type HeartRateData struct {
 	Date   time.Time `json:"date"`   // Timestamp
 	Source string    `json:"source"` // Source device or app
 	Units  string    `json:"units"`  // Units (e.g., "bpm")
+	Extras Extras    `json:"-"`      // Fields not listed above
 }
 
 // ValueWithUnits represents a measurement value with its associated units.
@@ -110,6 +118,7 @@ type StepRecord struct {
 	Qty    float64   `json:"qty"`    // Number of steps
 	Source string    `json:"source"` // Source device or app
 	Units  string    `json:"units"`  // Units (typically "count")
+	Extras Extras    `json:"-"`      // Fields not listed above
 }
 
 // DistanceRecord represents distance covered at a specific time.
@@ -118,6 +127,7 @@ type DistanceRecord struct {
 	Qty    float64   `json:"qty"`    // Distance value
 	Source string    `json:"source"` // Source device or app
 	Units  string    `json:"units"`  // Distance units (e.g., "mi", "km")
+	Extras Extras    `json:"-"`      // Fields not listed above
 }
 
 // UnmarshalJSON custom unmarshaler for DistanceRecord to handle date format.
@@ -140,7 +150,8 @@ func (d *DistanceRecord) UnmarshalJSON(data []byte) error {
 	}
 	d.Date = parsedDate
 
-	return nil
+	d.Extras, err = decodeExtras(data, distanceRecordFieldNames)
+	return err
 }
 
 // Statistics represents aggregated statistical data for time-series measurements.
@@ -192,6 +203,7 @@ type WorkoutSummary struct {
 
 	// Metadata
 	Metadata interface{} `json:"metadata,omitempty"`
+	Extras   Extras      `json:"extras,omitempty"` // Workout fields not interpreted by the parser
 
 	// Import-ready metadata for MCP import
 	ImportMetadata ImportMetadata `json:"importMetadata"`
@@ -258,6 +270,7 @@ type ExportManifest struct {
 	GeneratedAt time.Time `json:"generatedAt"`
 	TraceID     string    `json:"traceId"`
 	SourceFile  string    `json:"sourceFile"`
+	SourceSHA256 string   `json:"sourceSha256,omitempty"` // Hex SHA-256 of the source as read
 	Version     string    `json:"version"`
 
 	// Date range analysis
@@ -277,6 +290,23 @@ type ExportManifest struct {
 	Workouts     []string `json:"workouts"`     // List of workout summary files
 	StateOfMind  []string `json:"stateOfMind"`  // List of state of mind files
 
+	// Number of records carrying fields the parser does not interpret, by
+	// record type and field (e.g. "workouts.cadence"), including unknown data
+	// categories ("data.medications") and top-level fields. The fields are
+	// kept in the exported files.
+	Extras map[string]int `json:"extras,omitempty"`
+
+	// Hex SHA-256 of every file of the export except the manifest, by path
+	// relative to the export directory, checked by the verify command
+	Files map[string]string `json:"files,omitempty"`
+
+	// Set when the other files are age-encrypted. Each file listed above is
+	// then stored under its name with a .age suffix.
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// The redaction policy applied to the records, if any
+	Redaction *RedactionPolicy `json:"redaction,omitempty"`
+
 	// Detail file directories
 	WorkoutDetails struct {
 		HeartRate       []string `json:"heartRate,omitempty"`
@@ -355,7 +385,13 @@ type BatchSummary struct {
 	StateOfMindBatches  int       `json:"state_of_mind_batches"`
 	MetricBatches       int       `json:"metric_batches"`
 	TargetCollections   []string  `json:"target_collections"`
+	GroupBy             string    `json:"group_by,omitempty"`
 	Timestamp           time.Time `json:"timestamp"`
+
+	// Batch file names in import order, relative to the import directory
+	WorkoutBatchFiles     []string `json:"workout_batch_files,omitempty"`
+	StateOfMindBatchFiles []string `json:"state_of_mind_batch_files,omitempty"`
+	MetricBatchFiles      []string `json:"metric_batch_files,omitempty"`
 }
 
 // parseDate attempts to parse a date string using multiple common formats.
@@ -398,7 +434,8 @@ func (m *MetricRecord) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	m.Extras, err = decodeExtras(data, metricRecordFieldNames)
+	return err
 }
 
 // UnmarshalJSON implements custom JSON unmarshaling for StateOfMind.
@@ -424,7 +461,8 @@ func (s *StateOfMind) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	s.Extras, err = decodeExtras(data, stateOfMindFieldNames)
+	return err
 }
 
 // UnmarshalJSON implements custom JSON unmarshaling for Workout.
@@ -450,7 +488,8 @@ func (w *Workout) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	w.Extras, err = decodeExtras(data, workoutFieldNames)
+	return err
 }
 
 // UnmarshalJSON implements custom JSON unmarshaling for EnergyRecord.
@@ -471,7 +510,8 @@ func (e *EnergyRecord) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	e.Extras, err = decodeExtras(data, energyRecordFieldNames)
+	return err
 }
 
 // UnmarshalJSON implements custom JSON unmarshaling for HeartRateData.
@@ -492,7 +532,8 @@ func (h *HeartRateData) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	h.Extras, err = decodeExtras(data, heartRateDataFieldNames)
+	return err
 }
 
 // UnmarshalJSON implements custom JSON unmarshaling for StepRecord.
@@ -513,5 +554,74 @@ func (s *StepRecord) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	s.Extras, err = decodeExtras(data, stepRecordFieldNames)
+	return err
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for Metric.
+// It keeps fields the struct has no place for in Extras.
+func (m *Metric) UnmarshalJSON(data []byte) error {
+	type Alias Metric
+	if err := json.Unmarshal(data, (*Alias)(m)); err != nil {
+		return err
+	}
+	var err error
+	m.Extras, err = decodeExtras(data, metricFieldNames)
+	return err
+}
+
+// MarshalJSON implements custom JSON marshaling for Metric.
+// It writes the fields in Extras after the struct's own.
+func (m Metric) MarshalJSON() ([]byte, error) {
+	type Alias Metric
+	return marshalWithExtras(Alias(m), m.Extras)
+}
+
+// MarshalJSON implements custom JSON marshaling for MetricRecord.
+// It writes the fields in Extras after the struct's own.
+func (m MetricRecord) MarshalJSON() ([]byte, error) {
+	type Alias MetricRecord
+	return marshalWithExtras(Alias(m), m.Extras)
+}
+
+// MarshalJSON implements custom JSON marshaling for StateOfMind.
+// It writes the fields in Extras after the struct's own.
+func (s StateOfMind) MarshalJSON() ([]byte, error) {
+	type Alias StateOfMind
+	return marshalWithExtras(Alias(s), s.Extras)
+}
+
+// MarshalJSON implements custom JSON marshaling for Workout.
+// It writes the fields in Extras after the struct's own.
+func (w Workout) MarshalJSON() ([]byte, error) {
+	type Alias Workout
+	return marshalWithExtras(Alias(w), w.Extras)
+}
+
+// MarshalJSON implements custom JSON marshaling for EnergyRecord.
+// It writes the fields in Extras after the struct's own.
+func (e EnergyRecord) MarshalJSON() ([]byte, error) {
+	type Alias EnergyRecord
+	return marshalWithExtras(Alias(e), e.Extras)
+}
+
+// MarshalJSON implements custom JSON marshaling for HeartRateData.
+// It writes the fields in Extras after the struct's own.
+func (h HeartRateData) MarshalJSON() ([]byte, error) {
+	type Alias HeartRateData
+	return marshalWithExtras(Alias(h), h.Extras)
+}
+
+// MarshalJSON implements custom JSON marshaling for StepRecord.
+// It writes the fields in Extras after the struct's own.
+func (s StepRecord) MarshalJSON() ([]byte, error) {
+	type Alias StepRecord
+	return marshalWithExtras(Alias(s), s.Extras)
+}
+
+// MarshalJSON implements custom JSON marshaling for DistanceRecord.
+// It writes the fields in Extras after the struct's own.
+func (d DistanceRecord) MarshalJSON() ([]byte, error) {
+	type Alias DistanceRecord
+	return marshalWithExtras(Alias(d), d.Extras)
 }
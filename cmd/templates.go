@@ -0,0 +1,154 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultTemplateFS holds the built-in memory content templates.
+//
+//go:embed templates/*.tmpl
+var defaultTemplateFS embed.FS
+
+// templateDir is the optional directory of user templates overriding the defaults.
+var templateDir string
+
+// memoryTemplateNames lists the templates used to render memory content.
+var memoryTemplateNames = []string{
+	"workout_title", "workout_summary", "workout_markdown",
+	"state_of_mind_title", "state_of_mind_summary", "state_of_mind_markdown",
+	"metric_title", "metric_summary", "metric_markdown",
+}
+
+var (
+	// defaultMemoryTemplates is the built-in template set, used as a fallback
+	// when a user template fails to render.
+	defaultMemoryTemplates = template.Must(parseDefaultTemplates())
+
+	// memoryTemplates is the active template set used to render memory content.
+	memoryTemplates = defaultMemoryTemplates
+)
+
+// templateFuncs returns the helper functions available to memory templates.
+// Date, number and message helpers follow the active locale.
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// Localized messages
+		"t":      func(key string, args ...interface{}) string { return activeLocale.T(key, args...) },
+		"lookup": func(group, value string) string { return activeLocale.Lookup(group, value) },
+
+		// Dates and times
+		"longDate":   func(t time.Time) string { return activeLocale.FormatDate(t, activeLocale.DateFormats.Long) },
+		"mediumDate": func(t time.Time) string { return activeLocale.FormatDate(t, activeLocale.DateFormats.Medium) },
+		"shortDate":  func(t time.Time) string { return activeLocale.FormatDate(t, activeLocale.DateFormats.Short) },
+		"clock":      func(t time.Time) string { return activeLocale.FormatDate(t, activeLocale.DateFormats.Clock) },
+		"isoDate":    func(t time.Time) string { return t.Format("2006-01-02") },
+		"weekday":    func(t time.Time) string { return activeLocale.Weekdays[t.Weekday()] },
+		"timeOfDay":  func(t time.Time) string { return activeLocale.T("time_of_day." + getTimeOfDay(t)) },
+
+		// Durations
+		"minutes": func(seconds float64) float64 { return seconds / 60.0 },
+		"hours":   func(seconds float64) float64 { return seconds / 3600.0 },
+		"days":    func(start, end time.Time) float64 { return end.Sub(start).Hours() / 24 },
+
+		// Numbers and units
+		"fixed": func(precision int, value float64) string { return activeLocale.FormatNumber(precision, value) },
+		"quantity": func(precision int, value float64, units string) string {
+			return activeLocale.FormatNumber(precision, value) + " " + units
+		},
+
+		// Text
+		"lower":     strings.ToLower,
+		"upper":     strings.ToUpper,
+		"humanize":  func(s string) string { return strings.ReplaceAll(s, "_", " ") },
+		"titleCase": titleCase,
+		"join":      strings.Join,
+	}
+}
+
+// formatFixed formats value with a fixed number of decimal places.
+func formatFixed(precision int, value float64) string {
+	return strconv.FormatFloat(value, 'f', precision, 64)
+}
+
+// titleCase converts an identifier such as "daily_mood" to "Daily Mood".
+func titleCase(s string) string {
+	words := strings.Fields(strings.ReplaceAll(s, "_", " "))
+	for i, word := range words {
+		if len(word) > 0 {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// parseDefaultTemplates parses the embedded memory content templates.
+func parseDefaultTemplates() (*template.Template, error) {
+	return template.New("memory").Funcs(templateFuncs()).ParseFS(defaultTemplateFS, "templates/*.tmpl")
+}
+
+// loadMemoryTemplates parses the *.tmpl files in dir on top of the embedded
+// defaults. Templates defined in dir replace the default templates of the same
+// name, so a directory may override only the templates it needs to change.
+func loadMemoryTemplates(dir string) (*template.Template, error) {
+	tmpl, err := parseDefaultTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("parsing default templates: %w", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("listing templates in '%s': %w", dir, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.tmpl files found in template directory '%s'", dir)
+	}
+
+	if _, err := tmpl.ParseFiles(files...); err != nil {
+		return nil, fmt.Errorf("parsing templates in '%s': %w", dir, err)
+	}
+
+	// Warn about templates that will never be rendered, usually a misspelled name
+	known := make(map[string]bool, len(memoryTemplateNames))
+	for _, name := range memoryTemplateNames {
+		known[name] = true
+	}
+	for _, t := range tmpl.Templates() {
+		name := t.Name()
+		if !known[name] && name != tmpl.Name() && !strings.HasSuffix(name, ".tmpl") {
+			slog.Warn("Ignoring unknown memory template", "template", name, "dir", dir)
+		}
+	}
+
+	slog.Info("Loaded memory templates", "dir", dir, "files", len(files))
+	return tmpl, nil
+}
+
+// renderMemoryTemplate renders the named template with data. If the active
+// template fails, the built-in default is rendered instead so a broken user
+// template never aborts an export.
+func renderMemoryTemplate(name string, data interface{}) string {
+	var out strings.Builder
+	err := memoryTemplates.ExecuteTemplate(&out, name, data)
+	if err == nil {
+		return out.String()
+	}
+	if memoryTemplates == defaultMemoryTemplates {
+		slog.Error("Failed to render memory template", "template", name, "error", err)
+		return ""
+	}
+	slog.Warn("Failed to render memory template, using default", "template", name, "error", err)
+
+	out.Reset()
+	if err := defaultMemoryTemplates.ExecuteTemplate(&out, name, data); err != nil {
+		slog.Error("Failed to render default memory template", "template", name, "error", err)
+		return ""
+	}
+	return out.String()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTitleCase(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "daily_mood", want: "Daily Mood"},
+		{input: "heart_rate_variability", want: "Heart Rate Variability"},
+		{input: "Heart Rate", want: "Heart Rate"},
+		{input: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := titleCase(tt.input); got != tt.want {
+				t.Errorf("titleCase() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateWorkoutMarkdown(t *testing.T) {
+	start := time.Date(2025, 11, 12, 17, 5, 4, 0, time.UTC)
+	summary := createWorkoutSummary(Workout{
+		ID:                 "W1",
+		Name:               "Outdoor Walk",
+		Start:              start,
+		End:                start.Add(25 * time.Minute),
+		Duration:           1500,
+		Temperature:        ValueWithUnits{Qty: 12.34, Units: "degC"},
+		Humidity:           ValueWithUnits{Qty: 67, Units: "%"},
+		Intensity:          ValueWithUnits{Qty: 3.456, Units: "kcal/hr·kg"},
+		Distance:           ValueWithUnits{Qty: 1.2345, Units: "mi"},
+		ActiveEnergyBurned: EnergyValue{Qty: 123.45, Units: "kcal"},
+		HeartRateData:      []HeartRateData{{Avg: 100}, {Avg: 121}},
+	})
+
+	want := `# Outdoor Walk - November 12, 2025
+
+**Duration:** 25.0 minutes
+**Start:** 17:05:04
+**End:** 17:30:04
+
+## Environmental Conditions
+- Temperature: 12.3degC
+- Humidity: 67%
+
+## Performance Summary
+- Distance: 1.23 mi
+- Total Energy: 123.5 kcal
+- Intensity: 3.46 kcal/hr·kg
+
+## Heart Rate
+- Average: 110 bpm
+- Range: 100-121 bpm
+- Data Points: 2
+
+---
+*Source: Apple Health (ID: W1)*
+`
+	if summary.MemoryContent.Markdown != want {
+		t.Errorf("Markdown =\n%s\nwant\n%s", summary.MemoryContent.Markdown, want)
+	}
+
+	wantSummary := "25.0 minute outdoor walk with covering 1.23 mi with average heart rate of 110 bpm with burning 123.5 kcal"
+	if summary.MemoryContent.Summary != wantSummary {
+		t.Errorf("Summary = %v, want %v", summary.MemoryContent.Summary, wantSummary)
+	}
+}
+
+func TestGenerateStateOfMindMarkdown(t *testing.T) {
+	summary := createStateOfMindSummary(StateOfMind{
+		ID:                    "S1",
+		Kind:                  "momentary_emotion",
+		Start:                 time.Date(2025, 11, 12, 21, 0, 0, 0, time.UTC),
+		Valence:               0.4567,
+		ValenceClassification: "pleasant",
+		Labels:                []interface{}{"calm", "happy"},
+	})
+
+	want := `# Momentary Emotion - November 12, 2025
+
+**Time:** 21:00:00
+
+## Classification
+- **Valence:** 0.457
+- **Classification:** pleasant
+
+## Labels
+- calm
+- happy
+
+---
+*Source: Apple Health (ID: S1)*
+`
+	if summary.MemoryContent.Markdown != want {
+		t.Errorf("Markdown =\n%s\nwant\n%s", summary.MemoryContent.Markdown, want)
+	}
+}
+
+func TestLoadMemoryTemplates(t *testing.T) {
+	defer func() { memoryTemplates = defaultMemoryTemplates }()
+
+	t.Run("partial override", func(t *testing.T) {
+		dir := t.TempDir()
+		override := `{{define "metric_title"}}{{.Name}} ({{isoDate .StartDate}}){{end}}`
+		if err := os.WriteFile(filepath.Join(dir, "custom.tmpl"), []byte(override), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		tmpl, err := loadMemoryTemplates(dir)
+		if err != nil {
+			t.Fatalf("loadMemoryTemplates() error = %v", err)
+		}
+		memoryTemplates = tmpl
+
+		summary := MetricSummary{
+			Name:      "heart_rate",
+			Units:     "bpm",
+			StartDate: time.Date(2025, 11, 17, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2025, 11, 18, 0, 0, 0, 0, time.UTC),
+		}
+		if got := generateMetricTitle(summary); got != "heart_rate (2025-11-17)" {
+			t.Errorf("generateMetricTitle() = %v, want heart_rate (2025-11-17)", got)
+		}
+		// The markdown heading uses the overridden title; other templates keep their defaults
+		if got := generateMetricMarkdown(summary); !strings.HasPrefix(got, "# heart_rate (2025-11-17)\n\n## Time Range\n") {
+			t.Errorf("generateMetricMarkdown() = %v", got)
+		}
+	})
+
+	t.Run("render error falls back to default", func(t *testing.T) {
+		dir := t.TempDir()
+		override := `{{define "state_of_mind_title"}}{{.NoSuchField}}{{end}}`
+		if err := os.WriteFile(filepath.Join(dir, "broken.tmpl"), []byte(override), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		tmpl, err := loadMemoryTemplates(dir)
+		if err != nil {
+			t.Fatalf("loadMemoryTemplates() error = %v", err)
+		}
+		memoryTemplates = tmpl
+
+		summary := StateOfMindSummary{Kind: "daily_mood", Start: time.Date(2025, 11, 17, 14, 30, 0, 0, time.UTC)}
+		if got := generateStateOfMindTitle(summary); got != "Daily Mood - November 17, 2025" {
+			t.Errorf("generateStateOfMindTitle() = %v, want default title", got)
+		}
+	})
+
+	t.Run("empty directory", func(t *testing.T) {
+		if _, err := loadMemoryTemplates(t.TempDir()); err == nil {
+			t.Error("loadMemoryTemplates() should fail for a directory without templates")
+		}
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "bad.tmpl"), []byte(`{{define "metric_title"}}{{.Name`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadMemoryTemplates(dir); err == nil {
+			t.Error("loadMemoryTemplates() should fail on a template syntax error")
+		}
+	})
+}
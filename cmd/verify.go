@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Supported values for the verify --format flag.
+var validVerifyFormats = []string{"text", "json"}
+
+var (
+	verifyDir    string
+	verifySource string
+	verifyFormat string
+)
+
+// verifyCmd checks an export directory against the hashes in its manifest
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check an export directory against the hashes in its manifest",
+	Long: `Re-hash every file of an export directory and compare it with the SHA-256
+recorded in manifest.json when the export was written.
+
+Files listed in the manifest but missing from the directory, files whose
+content changed, and files the manifest does not list are reported. Files
+outside the directories the export writes, such as the source file, are
+listed as untracked without failing the check. The import journal and logs
+written by import.sh are not part of the export and are ignored. With --source, the source file is checked against the hash of
+the source the export was made from.
+
+The command exits with an error when any discrepancy is found.`,
+	Example: `  # Verify an archived export
+  apple-health-export-parser verify --export exports/2025-11-17
+
+  # Also check that the export was made from this source file
+  apple-health-export-parser verify --export exports/2025-11-17 --source HealthAutoExport-2025-11-17.json`,
+	Args: cobra.NoArgs,
+	RunE: runVerify,
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().StringVarP(&verifyDir, "export", "e", "exports", "export directory to verify")
+	verifyCmd.Flags().StringVarP(&verifySource, "source", "s", "", "source file to check against the manifest")
+	verifyCmd.Flags().StringVarP(&verifyFormat, "format", "f", "text", "output format (text, json)")
+}
+
+// VerifyResult is the outcome of verifying an export directory.
+type VerifyResult struct {
+	ExportDir string   `json:"exportDir"`
+	Verified  int      `json:"verified"`            // Files whose hash matches the manifest
+	Missing   []string `json:"missing,omitempty"`   // Listed in the manifest but not found
+	Modified  []string `json:"modified,omitempty"`  // Content differs from the manifest
+	Extra     []string `json:"extra,omitempty"`     // Found where the export writes but not listed in the manifest
+	Untracked []string `json:"untracked,omitempty"` // Found elsewhere in the directory; not an error
+
+	// Set when a source file was checked
+	Source         string `json:"source,omitempty"`
+	SourceModified bool   `json:"sourceModified,omitempty"`
+}
+
+// OK reports whether the export matched its manifest.
+func (r *VerifyResult) OK() bool {
+	return len(r.Missing) == 0 && len(r.Modified) == 0 && len(r.Extra) == 0 && !r.SourceModified
+}
+
+// runVerify executes the verify command
+func runVerify(cmd *cobra.Command, args []string) error {
+	if !containsString(validVerifyFormats, verifyFormat) {
+		return fmt.Errorf("invalid format: %s (valid: %s)", verifyFormat, strings.Join(validVerifyFormats, ", "))
+	}
+
+	result, err := verifyExport(verifyDir, verifySource)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if verifyFormat == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	} else {
+		writeVerifyText(out, result)
+	}
+
+	if !result.OK() {
+		return fmt.Errorf("export '%s' does not match its manifest", verifyDir)
+	}
+	return nil
+}
+
+// verifyExport re-hashes the files of the export directory dir and compares
+// them with its manifest. A non-empty source is checked against the source
+// hash in the manifest.
+func verifyExport(dir, source string) (*VerifyResult, error) {
+	manifest := &ExportManifest{}
+	if err := readManifest(dir, manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Files == nil {
+		return nil, fmt.Errorf("manifest in '%s' has no file hashes; re-run process to record them", dir)
+	}
+
+	found, err := hashExportFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("hashing export files: %w", err)
+	}
+
+	result := &VerifyResult{ExportDir: dir}
+	for rel, want := range manifest.Files {
+		got, ok := found[rel]
+		switch {
+		case !ok:
+			result.Missing = append(result.Missing, rel)
+		case got != want:
+			result.Modified = append(result.Modified, rel)
+		default:
+			result.Verified++
+		}
+	}
+	for rel := range found {
+		if _, ok := manifest.Files[rel]; ok || containsString(keptOnClean, rel) {
+			continue
+		}
+		if isExportOwned(rel) {
+			result.Extra = append(result.Extra, rel)
+		} else {
+			result.Untracked = append(result.Untracked, rel)
+		}
+	}
+	sort.Strings(result.Missing)
+	sort.Strings(result.Modified)
+	sort.Strings(result.Extra)
+	sort.Strings(result.Untracked)
+
+	if source != "" {
+		if manifest.SourceSHA256 == "" {
+			return nil, fmt.Errorf("manifest in '%s' has no source hash", dir)
+		}
+		digest, err := hashFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("hashing source file: %w", err)
+		}
+		result.Source = source
+		result.SourceModified = digest != manifest.SourceSHA256
+	}
+
+	return result, nil
+}
+
+// writeVerifyText writes a verify result as plain text.
+func writeVerifyText(w io.Writer, result *VerifyResult) {
+	fmt.Fprintf(w, "Export: %s\n", result.ExportDir)
+	fmt.Fprintf(w, "Verified: %d files\n", result.Verified)
+	for _, group := range []struct {
+		label string
+		files []string
+	}{
+		{"Missing", result.Missing},
+		{"Modified", result.Modified},
+		{"Extra", result.Extra},
+		{"Untracked (ignored)", result.Untracked},
+	} {
+		if len(group.files) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %d files\n", group.label, len(group.files))
+		for _, file := range group.files {
+			fmt.Fprintf(w, "  %s\n", file)
+		}
+	}
+	if result.Source != "" {
+		status := "matches"
+		if result.SourceModified {
+			status = "does not match"
+		}
+		fmt.Fprintf(w, "Source: %s %s the manifest\n", result.Source, status)
+	}
+	if result.OK() {
+		fmt.Fprintln(w, "OK")
+	}
+}
+
+// hashExportFiles returns the hex SHA-256 of every file in the export
+// directory dir by slash-separated relative path, leaving out the manifest
+// and staging directories.
+func hashExportFiles(dir string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), stagingPrefix) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if isManifestFile(rel) {
+			return nil
+		}
+		hashes[rel], err = hashFile(path)
+		return err
+	})
+	return hashes, err
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// contentDigest returns the hex SHA-256 of data.
+func contentDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyExport(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeTestFile(t, sourceDir, "source.json", `{"data":{}}`)
+	writeTestFile(t, sourceDir, "other.json", `{"data":{"metrics":[]}}`)
+	source, other := filepath.Join(sourceDir, "source.json"), filepath.Join(sourceDir, "other.json")
+	digest, err := hashFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir string, manifest *ExportManifest)
+		source string
+		want   func(manifest *ExportManifest) VerifyResult
+		ok     bool
+	}{
+		{
+			name:   "intact",
+			source: source,
+			ok:     true,
+			want: func(manifest *ExportManifest) VerifyResult {
+				return VerifyResult{Verified: len(manifest.Files), Source: source}
+			},
+		},
+		{
+			name: "modified, missing and extra",
+			change: func(t *testing.T, dir string, manifest *ExportManifest) {
+				writeTestFile(t, dir, manifest.Workouts[0], "{}")
+				if err := os.Remove(filepath.Join(dir, manifest.Metrics[0])); err != nil {
+					t.Fatal(err)
+				}
+				writeTestFile(t, dir, "metrics/added.json", "{}")
+				writeTestFile(t, dir, "import/"+importJournalFile, "{}\n")
+			},
+			want: func(manifest *ExportManifest) VerifyResult {
+				return VerifyResult{
+					Verified: len(manifest.Files) - 2,
+					Missing:  []string{manifest.Metrics[0]},
+					Modified: []string{manifest.Workouts[0]},
+					Extra:    []string{"metrics/added.json"},
+				}
+			},
+		},
+		{
+			name: "exported again with untracked files",
+			change: func(t *testing.T, dir string, manifest *ExportManifest) {
+				writeTestFile(t, dir, "notes.txt", "mine")
+				if err := exportData(context.Background(), HealthData{Data: testHealthData()}, exportSource{Path: source, SHA256: digest}, dir); err != nil {
+					t.Fatalf("exportData() error = %v", err)
+				}
+			},
+			want: func(manifest *ExportManifest) VerifyResult {
+				return VerifyResult{Verified: len(manifest.Files), Untracked: []string{"notes.txt"}}
+			},
+			ok: true,
+		},
+		{
+			name:   "other source",
+			source: other,
+			want: func(manifest *ExportManifest) VerifyResult {
+				return VerifyResult{Verified: len(manifest.Files), Source: other, SourceModified: true}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := exportData(context.Background(), HealthData{Data: testHealthData()}, exportSource{Path: source, SHA256: digest}, dir); err != nil {
+				t.Fatalf("exportData() error = %v", err)
+			}
+			manifest := &ExportManifest{}
+			if err := readJSONFile(filepath.Join(dir, manifestFileName), manifest); err != nil {
+				t.Fatal(err)
+			}
+			if manifest.SourceSHA256 != digest || len(manifest.Files) == 0 {
+				t.Fatalf("manifest source hash = %q with %d file hashes, want %q with hashes", manifest.SourceSHA256, len(manifest.Files), digest)
+			}
+			if tt.change != nil {
+				tt.change(t, dir, manifest)
+			}
+
+			got, err := verifyExport(dir, tt.source)
+			if err != nil {
+				t.Fatalf("verifyExport() error = %v", err)
+			}
+			want := tt.want(manifest)
+			want.ExportDir = dir
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("verifyExport() = %+v, want %+v", *got, want)
+			}
+			if got.OK() != tt.ok {
+				t.Errorf("OK() = %v", got.OK())
+			}
+		})
+	}
+}
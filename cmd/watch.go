@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/xid"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchDir        string
+	watchExportDir  string
+	watchArchiveDir string
+	watchShared     bool
+	watchSettle     time.Duration
+)
+
+// watchCmd processes exports dropped into a directory
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch a directory and process health exports as they appear",
+	Long: `Watch a directory, such as a synced folder, for new health export files.
+
+Each *.json, *.csv or *.xml file, optionally .gz or .zst compressed, and each
+*.zip file is processed once it has not been written to for the settle delay,
+so partially synced files are not read. Processed files are moved to the
+archive directory, and files that fail to process to its failed/ subdirectory.
+Files already in the directory are processed at start.
+
+Every file gets its own export directory under --export, named after the file,
+unless --shared exports all files into --export itself.`,
+	Example: `  # Process exports dropped into a synced folder
+  apple-health-export-parser watch --dir ~/Sync/health --export exports
+
+  # Wait longer for slow syncs and keep a single export directory
+  apple-health-export-parser watch --dir ~/Sync/health --settle 30s --shared`,
+	Args: cobra.NoArgs,
+	RunE: runWatch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().StringVarP(&watchDir, "dir", "d", "", "directory to watch for export files (required)")
+	watchCmd.Flags().StringVarP(&watchExportDir, "export", "e", "exports", "directory to export processed data")
+	watchCmd.Flags().StringVar(&watchArchiveDir, "archive", "", "directory processed files are moved to (default: <dir>/processed)")
+	watchCmd.Flags().BoolVar(&watchShared, "shared", false, "export every file into the export directory instead of one subdirectory per file")
+	watchCmd.Flags().DurationVar(&watchSettle, "settle", 5*time.Second, "time a file must go unmodified before it is processed")
+	watchCmd.Flags().StringVar(&inputFormat, "input-format", formatAuto, "input format: "+formatAuto+" (detect), "+strings.Join(formatNames(), ", "))
+	watchCmd.Flags().IntVar(&exportWorkers, "workers", runtime.NumCPU(), "number of records exported concurrently")
+	addEncryptionFlags(watchCmd)
+	watchCmd.Flags().StringSliceVarP(&targetCollections, "collections", "c", []string{}, "target collections for MCP import (comma-separated)")
+
+	watchCmd.MarkFlagRequired("dir")
+}
+
+// runWatch executes the watch command
+func runWatch(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := configureExport(); err != nil {
+		return err
+	}
+
+	archiveDir := watchArchiveDir
+	if archiveDir == "" {
+		archiveDir = filepath.Join(watchDir, "processed")
+	}
+
+	fw := &folderWatcher{
+		dir:        filepath.Clean(watchDir),
+		exportDir:  watchExportDir,
+		archiveDir: archiveDir,
+		shared:     watchShared,
+		settle:     watchSettle,
+	}
+	return fw.run(ctx)
+}
+
+// folderWatcher processes export files written to a directory.
+type folderWatcher struct {
+	dir        string
+	exportDir  string
+	archiveDir string
+	shared     bool
+	settle     time.Duration
+}
+
+// run watches the directory until ctx is cancelled. Files are processed one at
+// a time, after they have gone unmodified for the settle delay.
+func (fw *folderWatcher) run(ctx context.Context) error {
+	info, err := os.Stat(fw.dir)
+	if err != nil {
+		return fmt.Errorf("reading watch directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", fw.dir)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(fw.dir); err != nil {
+		return fmt.Errorf("watching '%s': %w", fw.dir, err)
+	}
+
+	ready := make(chan string)
+	pending := make(map[string]*time.Timer)
+	schedule := func(path string) {
+		if timer, ok := pending[path]; ok {
+			timer.Reset(fw.settle)
+			return
+		}
+		pending[path] = time.AfterFunc(fw.settle, func() {
+			select {
+			case ready <- path:
+			case <-ctx.Done():
+			}
+		})
+	}
+	defer func() {
+		for _, timer := range pending {
+			timer.Stop()
+		}
+	}()
+
+	// Pick up files that arrived while nothing was watching
+	existing, err := filepath.Glob(filepath.Join(fw.dir, "*"))
+	if err != nil {
+		return fmt.Errorf("listing '%s': %w", fw.dir, err)
+	}
+	sort.Strings(existing)
+	for _, path := range existing {
+		if fw.isCandidate(path) {
+			schedule(path)
+		}
+	}
+
+	slog.Info("Watching for health exports",
+		"dir", fw.dir,
+		"export_dir", fw.exportDir,
+		"archive_dir", fw.archiveDir,
+		"settle", fw.settle,
+		"pending", len(pending))
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped watching", "dir", fw.dir)
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !fw.isCandidate(event.Name) {
+				continue
+			}
+			switch {
+			case event.Has(fsnotify.Create), event.Has(fsnotify.Write):
+				slog.Debug("Export file changed", "file", event.Name, "op", event.Op.String())
+				schedule(event.Name)
+			case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+				if timer, ok := pending[event.Name]; ok {
+					timer.Stop()
+					delete(pending, event.Name)
+				}
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("Watcher error", "error", err)
+
+		case path := <-ready:
+			delete(pending, path)
+			fw.processFile(ctx, path)
+		}
+	}
+}
+
+// isCandidate reports whether path is a visible source file directly inside the
+// watched directory. Hidden files are skipped, as sync clients use them for
+// partial downloads.
+func (fw *folderWatcher) isCandidate(path string) bool {
+	name := filepath.Base(path)
+	return filepath.Dir(path) == fw.dir && isSourceFile(name) && !strings.HasPrefix(name, ".")
+}
+
+// processFile exports one source file and archives it. Failures are logged and
+// the file is moved to the failed/ archive so it is not retried forever.
+func (fw *folderWatcher) processFile(ctx context.Context, source string) {
+	info, err := os.Stat(source)
+	if err != nil || info.IsDir() || info.Size() == 0 {
+		// Gone since it was scheduled, or still empty; a later write reschedules it
+		return
+	}
+
+	// Tag the pipeline's log lines with a trace ID for this file
+	logger, traceID := newTraceLogger()
+	ctx = withTraceID(ctx, traceID)
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(previous)
+
+	export := fw.exportDir
+	if !fw.shared {
+		export = filepath.Join(fw.exportDir, sourceBaseName(source))
+	}
+
+	start := time.Now()
+	logger.Info("Processing watched export", "source", source, "export_dir", export)
+
+	err = os.MkdirAll(export, 0755)
+	if err == nil {
+		err = processHealthData(ctx, source, export)
+	}
+	if err != nil && ctx.Err() != nil {
+		logger.Warn("Export interrupted; the source is processed again on the next start", "source", source, "error", err)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to process watched export", "source", source, "error", err)
+		if archived, err := archiveFile(source, filepath.Join(fw.archiveDir, "failed")); err != nil {
+			logger.Error("Failed to archive export", "source", source, "error", err)
+		} else {
+			logger.Info("Moved failed export", "archived", archived)
+		}
+		return
+	}
+
+	archived, err := archiveFile(source, fw.archiveDir)
+	if err != nil {
+		logger.Error("Failed to archive export", "source", source, "error", err)
+		return
+	}
+	logger.Info("Processed watched export",
+		"source", source,
+		"export_dir", export,
+		"archived", archived,
+		"duration", time.Since(start))
+}
+
+// archiveFile moves source into dir, adding a unique suffix if a file with the
+// same name was archived before, and returns the new path.
+func archiveFile(source, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating archive directory: %w", err)
+	}
+
+	name := filepath.Base(source)
+	target := filepath.Join(dir, name)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(name)
+		target = filepath.Join(dir, strings.TrimSuffix(name, ext)+"_"+xid.New().String()+ext)
+	}
+
+	if err := os.Rename(source, target); err != nil {
+		return "", fmt.Errorf("moving '%s' to archive: %w", source, err)
+	}
+	return target, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFolderWatcher(t *testing.T) {
+	dir := t.TempDir()
+	exportDir := t.TempDir()
+	archiveDir := filepath.Join(dir, "processed")
+
+	payload, err := json.Marshal(HealthData{Data: testHealthData()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One file is present before the watcher starts, one arrives later
+	writeTestFile(t, dir, "early.json", string(payload))
+
+	fw := &folderWatcher{
+		dir:        dir,
+		exportDir:  exportDir,
+		archiveDir: archiveDir,
+		settle:     50 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- fw.run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("run() error = %v", err)
+		}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	writeTestFile(t, dir, "late.json", string(payload))
+	writeTestFile(t, dir, "broken.json", "{")
+	writeTestFile(t, dir, ".partial.json", "{")
+	writeTestFile(t, dir, "notes.txt", "not an export")
+
+	wantFiles := []string{
+		filepath.Join(archiveDir, "early.json"),
+		filepath.Join(archiveDir, "late.json"),
+		filepath.Join(archiveDir, "failed", "broken.json"),
+		filepath.Join(exportDir, "early", "manifest.json"),
+		filepath.Join(exportDir, "late", "manifest.json"),
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, want := range wantFiles {
+		for {
+			if _, err := os.Stat(want); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s was not created", want)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	for _, name := range []string{".partial.json", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s should be left in place: %v", name, err)
+		}
+	}
+}
+
+func TestArchiveFile(t *testing.T) {
+	dir := t.TempDir()
+	archiveDir := filepath.Join(dir, "archive")
+
+	writeTestFile(t, dir, "export.json", "first")
+	first, err := archiveFile(filepath.Join(dir, "export.json"), archiveDir)
+	if err != nil {
+		t.Fatalf("archiveFile() error = %v", err)
+	}
+	writeTestFile(t, dir, "export.json", "second")
+	second, err := archiveFile(filepath.Join(dir, "export.json"), archiveDir)
+	if err != nil {
+		t.Fatalf("archiveFile() error = %v", err)
+	}
+
+	if first != filepath.Join(archiveDir, "export.json") {
+		t.Errorf("first archive = %s, want %s", first, filepath.Join(archiveDir, "export.json"))
+	}
+	if second == first {
+		t.Errorf("second archive overwrote %s", first)
+	}
+	if content, _ := os.ReadFile(second); string(content) != "second" {
+		t.Errorf("second archive content = %q, want %q", content, "second")
+	}
+}